@@ -0,0 +1,146 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code classifies an error independently of the transport that reports it
+type Code string
+
+const (
+	CodeInvalidArgument  Code = "invalid_argument"
+	CodeNotFound         Code = "not_found"
+	CodeConflict         Code = "conflict"
+	CodeUnsupported      Code = "unsupported"
+	CodeUnavailable      Code = "unavailable"
+	CodeUnauthenticated  Code = "unauthenticated"
+	CodePermissionDenied Code = "permission_denied"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeQuotaExceeded    Code = "quota_exceeded"
+	CodeUnprocessable    Code = "unprocessable"
+	CodeRateLimited      Code = "rate_limited"
+	CodeInternal         Code = "internal"
+)
+
+// Sentinels for errors.Is checks. Any *Error matches the sentinel of its code.
+var (
+	ErrInvalidArgument  = &Error{Code: CodeInvalidArgument}
+	ErrNotFound         = &Error{Code: CodeNotFound}
+	ErrConflict         = &Error{Code: CodeConflict}
+	ErrUnsupported      = &Error{Code: CodeUnsupported}
+	ErrUnavailable      = &Error{Code: CodeUnavailable}
+	ErrUnauthenticated  = &Error{Code: CodeUnauthenticated}
+	ErrPermissionDenied = &Error{Code: CodePermissionDenied}
+	ErrPayloadTooLarge  = &Error{Code: CodePayloadTooLarge}
+	ErrQuotaExceeded    = &Error{Code: CodeQuotaExceeded}
+	ErrUnprocessable    = &Error{Code: CodeUnprocessable}
+	ErrRateLimited      = &Error{Code: CodeRateLimited}
+)
+
+// Error is a domain error carrying a Code, a client-safe message and
+// optional structured details
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = string(e.Code)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches a target with the same code and either no message (the generic
+// sentinels above) or the same message (package-level sentinels elsewhere)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && (t.Message == "" || t.Message == e.Message)
+}
+
+// WithDetail returns a copy of e with key set in its details
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	out := *e
+	out.Details = make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		out.Details[k] = v
+	}
+	out.Details[key] = value
+	return &out
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap attaches a code and client-safe message to an underlying error
+func Wrap(code Code, err error, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func InvalidArgument(message string) *Error  { return New(CodeInvalidArgument, message) }
+func NotFound(message string) *Error         { return New(CodeNotFound, message) }
+func Conflict(message string) *Error         { return New(CodeConflict, message) }
+func Unsupported(message string) *Error      { return New(CodeUnsupported, message) }
+func Unavailable(message string) *Error      { return New(CodeUnavailable, message) }
+func Unauthenticated(message string) *Error  { return New(CodeUnauthenticated, message) }
+func PermissionDenied(message string) *Error { return New(CodePermissionDenied, message) }
+func PayloadTooLarge(message string) *Error  { return New(CodePayloadTooLarge, message) }
+func QuotaExceeded(message string) *Error    { return New(CodeQuotaExceeded, message) }
+func Unprocessable(message string) *Error    { return New(CodeUnprocessable, message) }
+func RateLimited(message string) *Error      { return New(CodeRateLimited, message) }
+
+// As returns the *Error in err's chain, if any
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+// CodeOf returns the code of err, or CodeInternal for untyped errors
+func CodeOf(err error) Code {
+	if appErr, ok := As(err); ok {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// HTTPStatus maps a code to its HTTP status
+func HTTPStatus(code Code) int {
+	switch code {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeUnsupported:
+		return http.StatusUnsupportedMediaType
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeQuotaExceeded, CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodeUnprocessable:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,65 @@
+//go:build kafka
+
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"video-service/services"
+	"video-service/tracing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes video events to a Kafka topic. Messages are keyed
+// by video ID, so all events of a video land on one partition in order.
+type KafkaPublisher struct {
+	Writer *kafka.Writer
+}
+
+// NewKafkaPublisher initializes a new KafkaPublisher
+func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers configured")
+	}
+
+	return &KafkaPublisher{Writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  3,
+	}}, nil
+}
+
+// Publish waits for all in-sync replicas to acknowledge the event
+func (p *KafkaPublisher) Publish(ctx context.Context, event services.VideoEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	headers := []kafka.Header{
+		{Key: "event-id", Value: []byte(event.ID)},
+		{Key: "event-type", Value: []byte(event.Type)},
+	}
+	for key, value := range tracing.Inject(ctx) {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	err = p.Writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(event.VideoID),
+		Value:   data,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish to Kafka: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the writer
+func (p *KafkaPublisher) Close() error {
+	return p.Writer.Close()
+}
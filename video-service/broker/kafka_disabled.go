@@ -0,0 +1,28 @@
+//go:build !kafka
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"video-service/services"
+)
+
+// errKafkaDisabled is returned when the binary was built without the kafka tag
+var errKafkaDisabled = errors.New("kafka support is not compiled in; build with -tags kafka")
+
+// KafkaPublisher is unavailable in builds without the kafka tag
+type KafkaPublisher struct{}
+
+// NewKafkaPublisher fails in builds without the kafka tag
+func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error) {
+	return nil, errKafkaDisabled
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event services.VideoEvent) error {
+	return errKafkaDisabled
+}
+
+func (p *KafkaPublisher) Close() error {
+	return nil
+}
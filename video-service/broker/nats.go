@@ -0,0 +1,71 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"video-service/services"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NATSPublisher publishes video events to a JetStream stream. Each event goes
+// to <prefix>.<event type>, e.g. videos.video.uploaded, and carries its ID as
+// the message ID so JetStream drops redeliveries within its dedupe window.
+type NATSPublisher struct {
+	Conn          *nats.Conn
+	JetStream     jetstream.JetStream
+	SubjectPrefix string
+}
+
+// NewNATSPublisher initializes a new NATSPublisher, creating or updating the
+// stream that captures the prefix's subjects
+func NewNATSPublisher(ctx context.Context, url, stream, subjectPrefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("video-service"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       stream,
+		Subjects:   []string{subjectPrefix + ".>"},
+		Duplicates: 10 * time.Minute,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set up stream %s: %w", stream, err)
+	}
+
+	return &NATSPublisher{Conn: conn, JetStream: js, SubjectPrefix: subjectPrefix}, nil
+}
+
+// Publish waits for the stream to acknowledge the event
+func (p *NATSPublisher) Publish(ctx context.Context, event services.VideoEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(p.SubjectPrefix + "." + string(event.Type))
+	msg.Data = data
+	msg.Header.Set("Video-Id", event.VideoID)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+	if _, err := p.JetStream.PublishMsg(ctx, msg, jetstream.WithMsgID(event.ID)); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the connection
+func (p *NATSPublisher) Close() error {
+	return p.Conn.Drain()
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"video-service/dto"
+	"video-service/models"
+	"video-service/services"
+	"video-service/utils"
+)
+
+// errUsage reports bad arguments once the command's usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+// parseArgs parses a command's flags and checks it was given want positional
+// arguments, or at most -want of them when want is negative
+func parseArgs(fs *flag.FlagSet, args []string, want int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if (want >= 0 && fs.NArg() != want) || (want < 0 && fs.NArg() > -want) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func runUpload(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("upload", "upload -owner ID -title TITLE [flags] FILE")
+	owner := fs.String("owner", "", "ID of the user who owns the video (required)")
+	title := fs.String("title", "", "video title (required)")
+	tags := fs.String("tags", "", "comma-separated tags")
+	visibility := fs.String("visibility", string(models.VisibilityPublic), "public, unlisted, private or password_protected")
+	allowedUsers := fs.String("allowed-users", "", "comma-separated users who may watch a private video")
+	password := fs.String("password", "", "password of a password_protected video")
+	publishAt := fs.String("publish-at", "", "RFC 3339 time the video becomes available")
+	expireAt := fs.String("expire-at", "", "RFC 3339 time the video stops being available")
+	thumbnail := fs.String("thumbnail", "", "image or video file to use as the thumbnail")
+	contentType := fs.String("content-type", "", "content type of FILE, detected from its extension or contents if empty")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	if *owner == "" || *title == "" {
+		fmt.Fprintln(fs.Output(), "-owner and -title are required")
+		fs.Usage()
+		return errUsage
+	}
+
+	details := services.VideoDetails{
+		OwnerID: *owner,
+		Title:   *title,
+		Tags:    splitList(*tags),
+		Visibility: services.VisibilitySettings{
+			Visibility:   models.Visibility(*visibility),
+			AllowedUsers: splitList(*allowedUsers),
+			Password:     *password,
+		},
+	}
+	var err error
+	if details.Schedule.PublishAt, err = parseTime("publish-at", *publishAt); err != nil {
+		return err
+	}
+	if details.Schedule.ExpireAt, err = parseTime("expire-at", *expireAt); err != nil {
+		return err
+	}
+	if err := details.Visibility.Validate(); err != nil {
+		return err
+	}
+	if err := details.Schedule.Validate(); err != nil {
+		return err
+	}
+
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+
+	video, err := openUpload(fs.Arg(0), *contentType)
+	if err != nil {
+		return err
+	}
+	defer video.Close()
+	size := video.size
+
+	var thumb *uploadFile
+	if *thumbnail != "" {
+		if thumb, err = openUpload(*thumbnail, ""); err != nil {
+			return err
+		}
+		defer thumb.Close()
+		size += thumb.size
+	}
+
+	// Uploads by operators count against the owner's quota like any other
+	if err := a.quotas.Reserve(ctx, *owner, size); err != nil {
+		return err
+	}
+	// Files already stored are removed if the upload is not saved
+	saved := false
+	var videoURL, thumbnailURL string
+	defer func() {
+		if !saved {
+			a.quotas.Release(context.WithoutCancel(ctx), *owner, size)
+			a.videos.RemoveFiles(ctx, videoURL, thumbnailURL)
+		}
+	}()
+
+	var duration int
+	videoURL, duration, err = a.videos.ProcessAndUploadVideo(ctx, services.NewObjectKey(*owner, video.Name()), video.contentType, video)
+	if err != nil {
+		return a.rejectUpload(ctx, details, video.contentType, err)
+	}
+	thumbnailType := ""
+	if thumb != nil {
+		if thumbnailURL, err = a.videos.UploadThumbnail(ctx, services.NewObjectKey(*owner, thumb.Name()), thumb.contentType, thumb); err != nil {
+			return a.rejectUpload(ctx, details, video.contentType, err)
+		}
+		thumbnailType = thumb.contentType
+	}
+
+	metadata, err := a.videos.CreateAndSaveMetadata(ctx, details, duration, size, videoURL, thumbnailURL, thumbnailType, video.contentType)
+	if err != nil {
+		return err
+	}
+	saved = true
+	return a.writeVideo(&metadata)
+}
+
+// rejectUpload saves a rejected video if err reports malware in an upload,
+// and returns err
+func (a *app) rejectUpload(ctx context.Context, details services.VideoDetails, contentType string, err error) error {
+	infected, ok := services.AsInfected(err)
+	if !ok {
+		return err
+	}
+	metadata, saveErr := a.videos.SaveRejectedVideo(ctx, details, contentType, infected)
+	if saveErr != nil {
+		return saveErr
+	}
+	return fmt.Errorf("video %s rejected: %w", metadata.ID.Hex(), err)
+}
+
+// uploadFile is a local file to upload
+type uploadFile struct {
+	*os.File
+	size        int64
+	contentType string
+}
+
+// openUpload opens path, detecting its content type unless one is given
+func openUpload(path, contentType string) (*uploadFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if contentType == "" {
+		contentType = utils.VideoContentTypeByExtension(path)
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return &uploadFile{File: f, size: info.Size(), contentType: contentType}, nil
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("list", "list [-q TEXT] [-tag TAG] [-owner ID] [-deleted] [-limit N] [-offset N]")
+	var search services.VideoSearch
+	fs.StringVar(&search.Query, "q", "", "case-insensitive title search")
+	fs.StringVar(&search.Tag, "tag", "", "only videos with this tag")
+	fs.StringVar(&search.OwnerID, "owner", "", "only videos of this owner")
+	fs.BoolVar(&search.IncludeDeleted, "deleted", false, "include deleted videos")
+	fs.Int64Var(&search.Limit, "limit", 50, "maximum number of videos, 0 for all")
+	fs.Int64Var(&search.Offset, "offset", 0, "number of videos to skip")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+
+	videos, err := a.videos.SearchVideos(ctx, search)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.writeJSON(dto.NewVideoList(videos, search.Limit, search.Offset))
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tOWNER\tTITLE\tVISIBILITY\tAVAILABILITY\tDURATION\tSIZE\tUPLOADED\tDELETED")
+	for i := range videos {
+		v := dto.NewVideo(&videos[i])
+		deleted := "-"
+		if v.DeletedAt != nil {
+			deleted = *v.DeletedAt
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%ds\t%d\t%s\t%s\n",
+			v.ID, v.OwnerID, v.Title, v.Visibility, v.Availability, v.DurationSeconds, v.SizeBytes, v.UploadedAt, deleted)
+	}
+	return w.Flush()
+}
+
+func runShow(ctx context.Context, a *app, args []string) error {
+	return a.runOnVideo(ctx, "show", args, (*services.VideoService).FindVideo)
+}
+
+func runReprocess(ctx context.Context, a *app, args []string) error {
+	return a.runOnVideo(ctx, "reprocess", args, (*services.VideoService).ReprocessVideo)
+}
+
+func runDelete(ctx context.Context, a *app, args []string) error {
+	return a.runOnVideo(ctx, "delete", args, (*services.VideoService).DeleteVideo)
+}
+
+func runRestore(ctx context.Context, a *app, args []string) error {
+	return a.runOnVideo(ctx, "restore", args, (*services.VideoService).RestoreVideo)
+}
+
+// runOnVideo runs a command taking a single video ID and prints the video
+// the service method op returns
+func (a *app) runOnVideo(ctx context.Context, name string, args []string, op func(*services.VideoService, context.Context, string) (*models.VideoMetadata, error)) error {
+	fs := newFlagSet(name, name+" ID")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+	metadata, err := op(a.videos, ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.writeVideo(metadata)
+}
+
+// writeVideo prints one video as JSON or as aligned fields
+func (a *app) writeVideo(metadata *models.VideoMetadata) error {
+	v := dto.NewVideo(metadata)
+	if a.json {
+		return a.writeJSON(v)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fields := [][2]string{
+		{"ID", v.ID},
+		{"Owner", v.OwnerID},
+		{"Title", v.Title},
+		{"Tags", strings.Join(v.Tags, ", ")},
+		{"Duration", fmt.Sprintf("%ds", v.DurationSeconds)},
+		{"Size", fmt.Sprintf("%d bytes", v.SizeBytes)},
+		{"Content type", v.ContentType},
+		{"URL", v.URL},
+		{"Thumbnail", v.ThumbnailURL},
+		{"Visibility", v.Visibility},
+		{"Allowed users", strings.Join(metadata.AllowedUsers, ", ")},
+		{"Availability", v.Availability},
+		{"Publish at", optional(v.PublishAt)},
+		{"Expire at", optional(v.ExpireAt)},
+		{"Uploaded at", v.UploadedAt},
+		{"Deleted at", optional(v.DeletedAt)},
+	}
+	for _, field := range fields {
+		fmt.Fprintf(w, "%s:\t%s\n", field[0], field[1])
+	}
+	return w.Flush()
+}
+
+func runReconcile(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reconcile", "reconcile")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+
+	report, err := a.videos.ReconcileStorage(ctx)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.writeJSON(report)
+	}
+
+	fmt.Fprintf(a.out, "Checked %d objects in %s against %d videos\n", report.Objects, a.cfg.Storage.Bucket, report.Videos)
+	fmt.Fprintf(a.out, "\nOrphaned objects: %d (%d bytes)\n", len(report.Orphaned), report.OrphanSize)
+	for _, object := range report.Orphaned {
+		fmt.Fprintf(a.out, "  %s\t%d\n", object.Key, object.Size)
+	}
+	fmt.Fprintf(a.out, "\nMissing objects: %d\n", len(report.Missing))
+	for _, missing := range report.Missing {
+		fmt.Fprintf(a.out, "  %s\t%s\t%s\n", missing.VideoID, missing.Field, missing.URL)
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("export", "export [-o FILE]")
+	output := fs.String("o", "", "file to write, standard output if empty")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		count, err := a.videos.ExportVideos(ctx, a.out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d videos\n", count)
+		return nil
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	count, err := a.videos.ExportVideos(ctx, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d videos\n", count)
+	return nil
+}
+
+func runImport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("import", "import [FILE]")
+	if err := parseArgs(fs, args, -1); err != nil {
+		return err
+	}
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	count, err := a.videos.ImportVideos(ctx, r)
+	if err != nil {
+		return fmt.Errorf("imported %d videos before failing: %w", count, err)
+	}
+	if a.json {
+		return a.writeJSON(map[string]int{"imported": count})
+	}
+	fmt.Fprintf(a.out, "Imported %d videos\n", count)
+	return nil
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTime parses an optional RFC 3339 flag
+func parseTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("-%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+// optional formats a time that may be unset
+func optional(value *string) string {
+	if value == nil {
+		return "-"
+	}
+	return *value
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"video-service/ingest"
+)
+
+func runIngest(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("ingest", "ingest [-watch] [-owner ID] [-concurrency N] [-ledger FILE] DIR")
+	watch := fs.Bool("watch", false, "keep watching DIR for new files until interrupted")
+	owner := fs.String("owner", "", "owner of videos whose sidecar has no owner_id")
+	concurrency := fs.Int("concurrency", 2, "files uploaded at once")
+	ledgerPath := fs.String("ledger", "", "progress ledger, DIR/.videoctl-ingest.jsonl if empty")
+	settle := fs.Duration("settle", 10*time.Second, "with -watch, how long a file must be unchanged before it is ingested")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	dir := fs.Arg(0)
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if *ledgerPath == "" {
+		*ledgerPath = filepath.Join(dir, ".videoctl-ingest.jsonl")
+	}
+
+	if err := a.connect(ctx); err != nil {
+		return err
+	}
+	if err := a.videos.EnsureVideoIndexes(ctx); err != nil {
+		return err
+	}
+	ledger, err := ingest.OpenLedger(*ledgerPath)
+	if err != nil {
+		return err
+	}
+	defer ledger.Close()
+
+	ingester := ingest.NewIngester(a.videos, a.quotas, ledger, *owner, *concurrency)
+	if !a.json {
+		ingester.OnResult = func(r ingest.Result) {
+			switch r.Status {
+			case ingest.StatusFailed, ingest.StatusRejected:
+				fmt.Fprintf(a.out, "%-9s %s: %s\n", r.Status, r.Path, r.Error)
+			case ingest.StatusIngested, ingest.StatusDuplicate:
+				fmt.Fprintf(a.out, "%-9s %s %s\n", r.Status, r.Path, r.VideoID)
+			}
+		}
+	}
+
+	var summary ingest.Summary
+	if *watch {
+		summary, err = ingester.Watch(ctx, dir, *settle)
+	} else {
+		summary, err = ingester.Scan(ctx, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		if err := a.writeJSON(summary); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(a.out, "Ingested %d, duplicates %d, rejected %d, already done %d, failed %d\n",
+			summary.Ingested, summary.Duplicates, summary.Rejected, summary.Skipped, summary.Failed)
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d files failed; run again to retry them", summary.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Command videoctl administers the video service directly through its
+// MongoDB database and S3 bucket, using the service's own configuration.
+//
+// Usage:
+//
+//	videoctl [-json] <command> [flags] [arguments]
+//
+// Run videoctl -h for the list of commands.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"video-service/config"
+	"video-service/logging"
+	"video-service/services"
+	"video-service/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// command is a videoctl subcommand. run parses its own flags, then calls
+// app.connect before touching the database or bucket.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = []command{
+	{"upload", "Upload a video file and save its metadata", runUpload},
+	{"list", "List and search videos of any visibility", runList},
+	{"show", "Show a video's metadata, deleted or not", runShow},
+	{"reprocess", "Probe a stored video again and update its duration", runReprocess},
+	{"delete", "Hide a video until it is restored; files are kept", runDelete},
+	{"restore", "Restore a deleted video", runRestore},
+	{"reconcile", "Report bucket objects without videos and videos without objects", runReconcile},
+	{"export", "Write all video metadata as Extended JSON lines", runExport},
+	{"import", "Store video metadata written by export, replacing videos with the same ID", runImport},
+	{"ingest", "Upload every video in a directory, optionally watching it for new files", runIngest},
+}
+
+// app holds what every command needs
+type app struct {
+	cfg    *config.Config
+	client *mongo.Client
+	videos *services.VideoService
+	quotas *services.QuotaService
+	out    io.Writer
+	json   bool
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "write results as JSON")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "videoctl: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	app := &app{out: os.Stdout, json: *jsonOutput}
+	err := cmd.run(ctx, app, flag.Args()[1:])
+	app.close()
+	if err != nil {
+		exit(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: videoctl [-json] <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nConfiguration is read like the service's: CONFIG_FILE, .env and the environment.\n")
+	fmt.Fprintf(os.Stderr, "Run videoctl <command> -h for a command's flags.\n")
+}
+
+// connect loads the configuration and connects to MongoDB and S3
+func (a *app) connect(ctx context.Context) error {
+	utils.LoadEnv()
+	cfg, err := config.Load(utils.GetEnv("CONFIG_FILE", ""))
+	if err != nil {
+		return err
+	}
+	if _, err := logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		return err
+	}
+	a.cfg = cfg
+
+	a.client, err = mongo.Connect(ctx, options.Client().ApplyURI(cfg.Database.URI))
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	a.videos, err = services.NewVideoService(ctx, a.client.Database(cfg.Database.Name), cfg.Storage.Region, cfg.Storage.Bucket)
+	if err != nil {
+		return err
+	}
+	a.videos.FFprobePath = cfg.Processing.FFprobePath
+	a.videos.ScratchDir = cfg.Processing.ScratchDir
+	if a.videos.Scanner, err = services.NewScanner(cfg.Scanning.Scanner, cfg.Scanning.ClamdAddress, cfg.Scanning.Timeout); err != nil {
+		return err
+	}
+	a.videos.QuarantinePrefix = cfg.Scanning.QuarantinePrefix
+	a.videos.Moderated = cfg.Moderation.Enabled
+
+	a.quotas = services.NewQuotaService(a.videos.DB, services.QuotaLimits{
+		MaxFileSize:        cfg.Limits.MaxUploadSize,
+		UserStorageBytes:   cfg.Limits.UserStorageQuota,
+		UserDailyUploads:   cfg.Limits.UserDailyUploads,
+		GlobalStorageBytes: cfg.Limits.GlobalStorageQuota,
+	})
+	return nil
+}
+
+// close disconnects from MongoDB if connect got that far
+func (a *app) close() {
+	if a.client != nil {
+		a.client.Disconnect(context.Background())
+	}
+}
+
+// exit reports err and exits with status 1, or 2 for bad arguments, whose
+// usage has already been printed
+func exit(err error) {
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stderr, "videoctl: %v\n", err)
+	os.Exit(1)
+}
+
+// newFlagSet returns the flags of a command, printing usage, such as
+// "show ID", on -h or a parse error
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: videoctl %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// writeJSON writes v as indented JSON
+func (a *app) writeJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,473 @@
+// Package config loads the service configuration from an optional YAML file
+// and environment variables, and validates it at startup
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"video-service/moderation"
+	"video-service/ratelimit"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete service configuration. Each setting can be given in
+// the YAML file under its yaml key and overridden by the environment variable
+// in its env tag. Settings tagged secret are redacted when printed.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Processing ProcessingConfig `yaml:"processing"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Limits     LimitsConfig     `yaml:"limits"`
+	Events     EventsConfig     `yaml:"events"`
+	Webhooks   WebhooksConfig   `yaml:"webhooks"`
+	Imports    ImportsConfig    `yaml:"imports"`
+	Scanning   ScanningConfig   `yaml:"scanning"`
+	Moderation ModerationConfig `yaml:"moderation"`
+	Health     HealthConfig     `yaml:"health"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+}
+
+// ServerConfig covers the listeners and request handling
+type ServerConfig struct {
+	HTTPPort               int           `yaml:"http_port" env:"HTTP_PORT"`
+	GRPCPort               int           `yaml:"grpc_port" env:"GRPC_PORT"`
+	ShutdownTimeout        time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	ShutdownDelay          time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	IdempotencyTTL         time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+	IdempotencyLockTimeout time.Duration `yaml:"idempotency_lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`
+	// TrustedProxies lists the proxy addresses or CIDRs whose X-Forwarded-For
+	// headers are believed; by default none are and the peer address is used
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// DatabaseConfig locates the MongoDB database holding metadata
+type DatabaseConfig struct {
+	URI  string `yaml:"uri" env:"MONGO_URI" secret:"url"`
+	Name string `yaml:"name" env:"MONGO_DATABASE"`
+}
+
+// StorageConfig locates the S3 bucket videos are stored in. AWS credentials
+// are read by the SDK from its usual sources.
+type StorageConfig struct {
+	Region string `yaml:"region" env:"AWS_REGION"`
+	Bucket string `yaml:"bucket" env:"AWS_S3_BUCKET"`
+}
+
+// ProcessingConfig covers the media tools and the scratch space uploads are
+// staged in
+type ProcessingConfig struct {
+	FFprobePath     string `yaml:"ffprobe_path" env:"FFPROBE_PATH"`
+	FFmpegPath      string `yaml:"ffmpeg_path" env:"FFMPEG_PATH"` // Used to sample frames for moderation
+	ScratchDir      string `yaml:"scratch_dir" env:"SCRATCH_DIR"` // Empty means the system temporary directory
+	MinScratchSpace int64  `yaml:"min_scratch_space" env:"MIN_SCRATCH_SPACE"`
+}
+
+// AuthConfig covers authentication and authorization
+type AuthConfig struct {
+	JWTSecret      string        `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	RBACPolicyFile string        `yaml:"rbac_policy_file" env:"RBAC_POLICY_FILE"`
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" env:"VIDEO_ACCESS_TOKEN_TTL"`
+}
+
+// LimitsConfig covers upload quotas and rate limits. Zero disables a limit.
+type LimitsConfig struct {
+	MaxUploadSize        int64           `yaml:"max_upload_size" env:"MAX_UPLOAD_SIZE"`
+	UserStorageQuota     int64           `yaml:"user_storage_quota" env:"USER_STORAGE_QUOTA"`
+	UserDailyUploads     int             `yaml:"user_daily_uploads" env:"USER_DAILY_UPLOAD_LIMIT"`
+	GlobalStorageQuota   int64           `yaml:"global_storage_quota" env:"GLOBAL_STORAGE_QUOTA"`
+	RateLimitBackend     string          `yaml:"rate_limit_backend" env:"RATE_LIMIT_BACKEND"`
+	RedisURL             string          `yaml:"redis_url" env:"REDIS_URL" secret:"url"`
+	RateLimitVideos      ratelimit.Limit `yaml:"rate_limit_videos" env:"RATE_LIMIT_VIDEOS"`
+	RateLimitWebhooks    ratelimit.Limit `yaml:"rate_limit_webhooks" env:"RATE_LIMIT_WEBHOOKS"`
+	RateLimitAdmin       ratelimit.Limit `yaml:"rate_limit_admin" env:"RATE_LIMIT_ADMIN"`
+	RateLimitUploads     ratelimit.Limit `yaml:"rate_limit_uploads" env:"RATE_LIMIT_UPLOADS"`
+	MaxConcurrentUploads int             `yaml:"max_concurrent_uploads" env:"MAX_CONCURRENT_UPLOADS"`
+}
+
+// EventsConfig covers the outbox, the scheduler and the event broker
+type EventsConfig struct {
+	Broker              string        `yaml:"broker" env:"EVENT_BROKER"`
+	NATSURL             string        `yaml:"nats_url" env:"NATS_URL" secret:"url"`
+	NATSStream          string        `yaml:"nats_stream" env:"NATS_STREAM"`
+	NATSSubjectPrefix   string        `yaml:"nats_subject_prefix" env:"NATS_SUBJECT_PREFIX"`
+	KafkaBrokers        []string      `yaml:"kafka_brokers" env:"KAFKA_BROKERS"`
+	KafkaTopic          string        `yaml:"kafka_topic" env:"KAFKA_TOPIC"`
+	OutboxRelayInterval time.Duration `yaml:"outbox_relay_interval" env:"OUTBOX_RELAY_INTERVAL"`
+	OutboxRetention     time.Duration `yaml:"outbox_retention" env:"OUTBOX_RETENTION"`
+	SchedulerInterval   time.Duration `yaml:"scheduler_interval" env:"SCHEDULER_INTERVAL"`
+}
+
+// WebhooksConfig covers webhook delivery and retries
+type WebhooksConfig struct {
+	WorkerInterval time.Duration `yaml:"worker_interval" env:"WEBHOOK_WORKER_INTERVAL"`
+	MaxAttempts    int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay" env:"WEBHOOK_RETRY_BASE_DELAY"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay" env:"WEBHOOK_RETRY_MAX_DELAY"`
+	DisableAfter   int           `yaml:"disable_after" env:"WEBHOOK_DISABLE_AFTER"`
+	// Webhook URLs on private and other non-public networks are refused
+	// unless listed here
+	AllowedNetworks []string `yaml:"allowed_networks" env:"WEBHOOK_ALLOWED_NETWORKS"`
+}
+
+// ImportsConfig covers downloading videos from remote URLs. Sources on
+// private and other non-public networks are refused unless listed in
+// AllowedNetworks.
+type ImportsConfig struct {
+	Concurrency     int           `yaml:"concurrency" env:"IMPORT_CONCURRENCY"`
+	Timeout         time.Duration `yaml:"timeout" env:"IMPORT_TIMEOUT"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" env:"IMPORT_CONNECT_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"IMPORT_IDLE_TIMEOUT"`
+	MaxRedirects    int           `yaml:"max_redirects" env:"IMPORT_MAX_REDIRECTS"`
+	AllowedNetworks []string      `yaml:"allowed_networks" env:"IMPORT_ALLOWED_NETWORKS"`
+}
+
+// ScanningConfig selects the malware scanner uploads pass through before
+// they are published. Infected files are moved under QuarantinePrefix.
+type ScanningConfig struct {
+	Scanner          string        `yaml:"scanner" env:"MALWARE_SCANNER"`
+	ClamdAddress     string        `yaml:"clamd_address" env:"CLAMD_ADDRESS"`
+	Timeout          time.Duration `yaml:"timeout" env:"CLAMD_TIMEOUT"`
+	QuarantinePrefix string        `yaml:"quarantine_prefix" env:"QUARANTINE_PREFIX"`
+}
+
+// ModerationConfig covers classifying new videos before they are released.
+// While enabled, new videos stay private until the rules or a moderator
+// approve them.
+type ModerationConfig struct {
+	Enabled           bool          `yaml:"enabled" env:"MODERATION_ENABLED"`
+	Classifiers       []string      `yaml:"classifiers" env:"MODERATION_CLASSIFIERS"`
+	BlockedTerms      []string      `yaml:"blocked_terms" env:"MODERATION_BLOCKED_TERMS"`
+	ClassifierURL     string        `yaml:"classifier_url" env:"MODERATION_CLASSIFIER_URL" secret:"url"`
+	ClassifierTimeout time.Duration `yaml:"classifier_timeout" env:"MODERATION_CLASSIFIER_TIMEOUT"`
+	Rules             []string      `yaml:"rules" env:"MODERATION_RULES"`
+	Frames            int           `yaml:"frames" env:"MODERATION_FRAMES"`
+	Interval          time.Duration `yaml:"interval" env:"MODERATION_INTERVAL"`
+	Timeout           time.Duration `yaml:"timeout" env:"MODERATION_TIMEOUT"`
+	MaxAttempts       int           `yaml:"max_attempts" env:"MODERATION_MAX_ATTEMPTS"`
+}
+
+// HealthConfig covers the readiness checks
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+}
+
+// LoggingConfig selects the log format and level
+type LoggingConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// TracingConfig selects the span exporter. The exporter itself reads the
+// standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+}
+
+// Default returns the configuration used for settings that are not given
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			HTTPPort:               8080,
+			GRPCPort:               9090,
+			ShutdownTimeout:        30 * time.Second,
+			IdempotencyTTL:         24 * time.Hour,
+			IdempotencyLockTimeout: 30 * time.Minute,
+		},
+		Database: DatabaseConfig{
+			URI:  "mongodb://localhost:27017",
+			Name: "video_service_meta",
+		},
+		Processing: ProcessingConfig{
+			FFprobePath:     "ffprobe",
+			FFmpegPath:      "ffmpeg",
+			MinScratchSpace: 1 << 30,
+		},
+		Auth: AuthConfig{
+			RBACPolicyFile: "config/policy.yaml",
+			AccessTokenTTL: 15 * time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxUploadSize:        5 << 30,
+			UserStorageQuota:     50 << 30,
+			UserDailyUploads:     50,
+			RateLimitBackend:     "memory",
+			RedisURL:             "redis://localhost:6379/0",
+			RateLimitVideos:      ratelimit.Limit{Limit: 300, Window: time.Minute},
+			RateLimitWebhooks:    ratelimit.Limit{Limit: 60, Window: time.Minute},
+			RateLimitAdmin:       ratelimit.Limit{Limit: 60, Window: time.Minute},
+			RateLimitUploads:     ratelimit.Limit{Limit: 20, Window: time.Hour},
+			MaxConcurrentUploads: 2,
+		},
+		Events: EventsConfig{
+			Broker:              "memory",
+			NATSURL:             "nats://localhost:4222",
+			NATSStream:          "VIDEO_EVENTS",
+			NATSSubjectPrefix:   "videos",
+			KafkaBrokers:        []string{"localhost:9092"},
+			KafkaTopic:          "video-events",
+			OutboxRelayInterval: time.Second,
+			OutboxRetention:     7 * 24 * time.Hour,
+			SchedulerInterval:   30 * time.Second,
+		},
+		Webhooks: WebhooksConfig{
+			WorkerInterval: 5 * time.Second,
+			MaxAttempts:    8,
+			RetryBaseDelay: 30 * time.Second,
+			RetryMaxDelay:  6 * time.Hour,
+			DisableAfter:   20,
+		},
+		Imports: ImportsConfig{
+			Concurrency:    4,
+			Timeout:        time.Hour,
+			ConnectTimeout: 10 * time.Second,
+			IdleTimeout:    time.Minute,
+			MaxRedirects:   5,
+		},
+		Scanning: ScanningConfig{
+			Scanner:          "none",
+			ClamdAddress:     "tcp://localhost:3310",
+			Timeout:          30 * time.Second,
+			QuarantinePrefix: "quarantine/",
+		},
+		Moderation: ModerationConfig{
+			Classifiers:       []string{"keywords"},
+			ClassifierTimeout: time.Minute,
+			Rules:             []string{"*>=0.9:reject", "*>=0.5:review"},
+			Frames:            8,
+			Interval:          10 * time.Second,
+			Timeout:           10 * time.Minute,
+			MaxAttempts:       3,
+		},
+		Health: HealthConfig{
+			CheckTimeout: 2 * time.Second,
+		},
+		Logging: LoggingConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path if
+// path is not empty, and the environment, in that order, then validates it
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that required settings are present and values are in
+// range, reporting all problems at once
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.port("server.http_port", c.Server.HTTPPort)
+	v.port("server.grpc_port", c.Server.GRPCPort)
+	v.positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	v.check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay", "must not be negative")
+	v.positive("server.idempotency_ttl", c.Server.IdempotencyTTL)
+	v.positive("server.idempotency_lock_timeout", c.Server.IdempotencyLockTimeout)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(proxy)
+		_, addrErr := netip.ParseAddr(proxy)
+		v.check(prefixErr == nil || addrErr == nil, "server.trusted_proxies", "must be IP addresses or CIDR networks, not "+strconv.Quote(proxy))
+	}
+
+	v.url("database.uri", c.Database.URI, "mongodb", "mongodb+srv")
+	v.required("database.name", c.Database.Name)
+
+	v.required("storage.region", c.Storage.Region)
+	v.required("storage.bucket", c.Storage.Bucket)
+
+	v.required("processing.ffprobe_path", c.Processing.FFprobePath)
+	v.check(c.Processing.MinScratchSpace >= 0, "processing.min_scratch_space", "must not be negative")
+	if c.Processing.ScratchDir != "" {
+		info, err := os.Stat(c.Processing.ScratchDir)
+		v.check(err == nil && info.IsDir(), "processing.scratch_dir", "must be an existing directory")
+	}
+
+	v.required("auth.jwt_secret", c.Auth.JWTSecret)
+	v.required("auth.rbac_policy_file", c.Auth.RBACPolicyFile)
+	v.positive("auth.access_token_ttl", c.Auth.AccessTokenTTL)
+
+	v.check(c.Limits.MaxUploadSize >= 0, "limits.max_upload_size", "must not be negative")
+	v.check(c.Limits.UserStorageQuota >= 0, "limits.user_storage_quota", "must not be negative")
+	v.check(c.Limits.UserDailyUploads >= 0, "limits.user_daily_uploads", "must not be negative")
+	v.check(c.Limits.GlobalStorageQuota >= 0, "limits.global_storage_quota", "must not be negative")
+	v.check(c.Limits.MaxConcurrentUploads >= 0, "limits.max_concurrent_uploads", "must not be negative")
+	v.oneOf("limits.rate_limit_backend", c.Limits.RateLimitBackend, "memory", "redis")
+	if c.Limits.RateLimitBackend == "redis" {
+		v.url("limits.redis_url", c.Limits.RedisURL, "redis", "rediss")
+	}
+
+	v.oneOf("events.broker", c.Events.Broker, "memory", "nats", "kafka")
+	switch c.Events.Broker {
+	case "nats":
+		v.url("events.nats_url", c.Events.NATSURL, "nats", "tls")
+		v.required("events.nats_stream", c.Events.NATSStream)
+		v.required("events.nats_subject_prefix", c.Events.NATSSubjectPrefix)
+	case "kafka":
+		v.check(len(c.Events.KafkaBrokers) > 0, "events.kafka_brokers", "is required")
+		v.required("events.kafka_topic", c.Events.KafkaTopic)
+	}
+	v.positive("events.outbox_relay_interval", c.Events.OutboxRelayInterval)
+	v.positive("events.outbox_retention", c.Events.OutboxRetention)
+	v.positive("events.scheduler_interval", c.Events.SchedulerInterval)
+
+	v.positive("webhooks.worker_interval", c.Webhooks.WorkerInterval)
+	v.check(c.Webhooks.MaxAttempts >= 1, "webhooks.max_attempts", "must be at least 1")
+	v.positive("webhooks.retry_base_delay", c.Webhooks.RetryBaseDelay)
+	v.check(c.Webhooks.RetryMaxDelay >= c.Webhooks.RetryBaseDelay, "webhooks.retry_max_delay", "must not be shorter than retry_base_delay")
+	v.check(c.Webhooks.DisableAfter >= 0, "webhooks.disable_after", "must not be negative")
+	for _, cidr := range c.Webhooks.AllowedNetworks {
+		_, err := netip.ParsePrefix(cidr)
+		v.check(err == nil, "webhooks.allowed_networks", "must be CIDR networks, not "+strconv.Quote(cidr))
+	}
+
+	v.check(c.Imports.Concurrency >= 1, "imports.concurrency", "must be at least 1")
+	v.positive("imports.timeout", c.Imports.Timeout)
+	v.positive("imports.connect_timeout", c.Imports.ConnectTimeout)
+	v.positive("imports.idle_timeout", c.Imports.IdleTimeout)
+	v.check(c.Imports.MaxRedirects >= 0, "imports.max_redirects", "must not be negative")
+	for _, cidr := range c.Imports.AllowedNetworks {
+		_, err := netip.ParsePrefix(cidr)
+		v.check(err == nil, "imports.allowed_networks", "must be CIDR networks, not "+strconv.Quote(cidr))
+	}
+
+	v.oneOf("scanning.scanner", c.Scanning.Scanner, "none", "clamav")
+	if c.Scanning.Scanner == "clamav" {
+		v.url("scanning.clamd_address", c.Scanning.ClamdAddress, "tcp", "unix")
+		v.positive("scanning.timeout", c.Scanning.Timeout)
+	}
+	v.check(strings.HasSuffix(c.Scanning.QuarantinePrefix, "/") && c.Scanning.QuarantinePrefix != "/",
+		"scanning.quarantine_prefix", "must be a key prefix ending in /")
+
+	if c.Moderation.Enabled {
+		for _, classifier := range c.Moderation.Classifiers {
+			v.oneOf("moderation.classifiers", classifier, "keywords", "http")
+			if classifier == "http" {
+				v.url("moderation.classifier_url", c.Moderation.ClassifierURL, "http", "https")
+			}
+		}
+		v.positive("moderation.classifier_timeout", c.Moderation.ClassifierTimeout)
+		for _, rule := range c.Moderation.Rules {
+			// The worker parses the rules with the same function
+			if _, err := moderation.ParseRules([]string{rule}); err != nil {
+				v.check(false, "moderation.rules", "has an "+err.Error())
+			}
+		}
+		v.check(c.Moderation.Frames >= 0, "moderation.frames", "must not be negative")
+		if c.Moderation.Frames > 0 {
+			v.required("processing.ffmpeg_path", c.Processing.FFmpegPath)
+		}
+		v.positive("moderation.interval", c.Moderation.Interval)
+		v.positive("moderation.timeout", c.Moderation.Timeout)
+		v.check(c.Moderation.MaxAttempts >= 1, "moderation.max_attempts", "must be at least 1")
+	}
+
+	v.positive("health.check_timeout", c.Health.CheckTimeout)
+
+	v.oneOf("logging.format", c.Logging.Format, "text", "json")
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), "debug", "info", "warn", "error")
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout")
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator collects problems, naming each setting by its YAML path and
+// environment variable
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, path, problem string) {
+	if ok {
+		return
+	}
+	if env := envNames[path]; env != "" {
+		path += " (" + env + ")"
+	}
+	v.problems = append(v.problems, path+" "+problem)
+}
+
+func (v *validator) required(path, value string) {
+	v.check(strings.TrimSpace(value) != "", path, "is required")
+}
+
+func (v *validator) positive(path string, d time.Duration) {
+	v.check(d > 0, path, "must be a positive duration")
+}
+
+func (v *validator) port(path string, port int) {
+	v.check(port > 0 && port < 65536, path, "must be between 1 and 65535")
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, path, "must be one of "+strings.Join(allowed, ", ")+", not "+strconv.Quote(value))
+}
+
+func (v *validator) url(path, value string, schemes ...string) {
+	if value == "" {
+		v.check(false, path, "is required")
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.check(false, path, "is not a valid URL")
+		return
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return
+		}
+	}
+	v.check(false, path, "must be a "+strings.Join(schemes, ":// or ")+":// URL")
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"video-service/ratelimit"
+)
+
+// validConfig is the default configuration with the required settings filled in
+func validConfig() Config {
+	cfg := Default()
+	cfg.Storage.Region = "eu-north-1"
+	cfg.Storage.Bucket = "videos"
+	cfg.Auth.JWTSecret = "secret"
+	return cfg
+}
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{
+		"HTTP_PORT":                " 8081 ",
+		"SHUTDOWN_DELAY":           "5s",
+		"MONGO_DATABASE":           "videos",
+		"MODERATION_ENABLED":       "true",
+		"KAFKA_BROKERS":            "kafka-1:9092, kafka-2:9092,,",
+		"RATE_LIMIT_UPLOADS":       "5/1m",
+		"WEBHOOK_ALLOWED_NETWORKS": "",
+	}
+	if err := applyEnv(&cfg, lookupIn(env)); err != nil {
+		t.Fatalf("applyEnv() error = %v", err)
+	}
+
+	if cfg.Server.HTTPPort != 8081 {
+		t.Errorf("HTTPPort = %d, want 8081", cfg.Server.HTTPPort)
+	}
+	if cfg.Server.ShutdownDelay != 5*time.Second {
+		t.Errorf("ShutdownDelay = %s, want 5s", cfg.Server.ShutdownDelay)
+	}
+	if cfg.Database.Name != "videos" {
+		t.Errorf("Database.Name = %q, want videos", cfg.Database.Name)
+	}
+	if !cfg.Moderation.Enabled {
+		t.Error("Moderation.Enabled = false, want true")
+	}
+	if want := []string{"kafka-1:9092", "kafka-2:9092"}; !reflect.DeepEqual(cfg.Events.KafkaBrokers, want) {
+		t.Errorf("KafkaBrokers = %q, want %q", cfg.Events.KafkaBrokers, want)
+	}
+	if want := (ratelimit.Limit{Limit: 5, Window: time.Minute}); cfg.Limits.RateLimitUploads != want {
+		t.Errorf("RateLimitUploads = %v, want %v", cfg.Limits.RateLimitUploads, want)
+	}
+	if cfg.Webhooks.AllowedNetworks != nil {
+		t.Errorf("AllowedNetworks = %q, want none", cfg.Webhooks.AllowedNetworks)
+	}
+	// Unset variables keep their defaults
+	if cfg.Server.GRPCPort != 9090 {
+		t.Errorf("GRPCPort = %d, want the default 9090", cfg.Server.GRPCPort)
+	}
+}
+
+func TestApplyEnvRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name, value string
+		wantErr     string
+	}{
+		{name: "HTTP_PORT", value: "http", wantErr: "invalid HTTP_PORT (server.http_port): must be an integer"},
+		{name: "SHUTDOWN_TIMEOUT", value: "30", wantErr: "invalid SHUTDOWN_TIMEOUT (server.shutdown_timeout): must be a duration"},
+		{name: "MODERATION_ENABLED", value: "yes", wantErr: "invalid MODERATION_ENABLED (moderation.enabled): must be true or false"},
+		{name: "RATE_LIMIT_VIDEOS", value: "300", wantErr: "invalid RATE_LIMIT_VIDEOS (limits.rate_limit_videos)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			err := applyEnv(&cfg, lookupIn(map[string]string{tt.name: tt.value}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyEnv(%s=%q) error = %v, want %q", tt.name, tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   []string // Problems, each naming its setting
+	}{
+		{name: "valid", change: func(*Config) {}},
+		{
+			name:   "missing required settings",
+			change: func(c *Config) { c.Storage.Bucket, c.Auth.JWTSecret = "", " " },
+			want:   []string{"storage.bucket (AWS_S3_BUCKET) is required", "auth.jwt_secret (JWT_SECRET) is required"},
+		},
+		{
+			name:   "port out of range",
+			change: func(c *Config) { c.Server.HTTPPort = 70000 },
+			want:   []string{"server.http_port (HTTP_PORT) must be between 1 and 65535"},
+		},
+		{
+			name:   "database URI scheme",
+			change: func(c *Config) { c.Database.URI = "postgres://localhost" },
+			want:   []string{"database.uri (MONGO_URI) must be a mongodb:// or mongodb+srv:// URL"},
+		},
+		{
+			name:   "unknown broker",
+			change: func(c *Config) { c.Events.Broker = "rabbitmq" },
+			want:   []string{`events.broker (EVENT_BROKER) must be one of memory, nats, kafka, not "rabbitmq"`},
+		},
+		{
+			name:   "kafka without brokers",
+			change: func(c *Config) { c.Events.Broker, c.Events.KafkaBrokers = "kafka", nil },
+			want:   []string{"events.kafka_brokers (KAFKA_BROKERS) is required"},
+		},
+		{
+			name:   "redis only checked when used",
+			change: func(c *Config) { c.Limits.RedisURL = "" },
+		},
+		{
+			name:   "retry delays",
+			change: func(c *Config) { c.Webhooks.RetryMaxDelay = time.Second },
+			want:   []string{"webhooks.retry_max_delay (WEBHOOK_RETRY_MAX_DELAY) must not be shorter than retry_base_delay"},
+		},
+		{
+			name:   "networks",
+			change: func(c *Config) { c.Imports.AllowedNetworks = []string{"10.0.0.1"} },
+			want:   []string{`imports.allowed_networks (IMPORT_ALLOWED_NETWORKS) must be CIDR networks, not "10.0.0.1"`},
+		},
+		{
+			name: "moderation rules",
+			change: func(c *Config) {
+				c.Moderation.Enabled = true
+				c.Moderation.Rules = []string{"*>=0.9:ban"}
+			},
+			want: []string{"moderation.rules (MODERATION_RULES) has an"},
+		},
+		{
+			name:   "log level is case-insensitive",
+			change: func(c *Config) { c.Logging.Level = "WARN" },
+		},
+		{
+			name: "every problem at once",
+			change: func(c *Config) {
+				c.Server.ShutdownTimeout = 0
+				c.Scanning.QuarantinePrefix = "quarantine"
+				c.Logging.Format = "xml"
+			},
+			want: []string{
+				"server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be a positive duration",
+				"scanning.quarantine_prefix (QUARANTINE_PREFIX) must be a key prefix ending in /",
+				"logging.format (LOG_FORMAT) must be one of text, json",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if len(validationErr.Problems) != len(tt.want) {
+				t.Fatalf("Validate() problems = %q, want %d", validationErr.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(validationErr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, validationErr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "server:\n  http_port: 8000\nstorage:\n  region: eu-north-1\n  bucket: videos\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("HTTP_PORT", "8001")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// The environment takes precedence over the file
+	if cfg.Server.HTTPPort != 8001 {
+		t.Errorf("HTTPPort = %d, want 8001", cfg.Server.HTTPPort)
+	}
+	if cfg.Storage.Bucket != "videos" {
+		t.Errorf("Bucket = %q, want videos", cfg.Storage.Bucket)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  http_prot: 8000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "http_prot") {
+		t.Errorf("Load() error = %v, want the unknown key named", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	cfg.Database.URI = "mongodb://app:hunter2@db:27017"
+	cfg.Moderation.ClassifierURL = "https://classifier.internal/score"
+
+	redactedCfg := cfg.Redacted()
+	if redactedCfg.Auth.JWTSecret != redacted {
+		t.Errorf("JWTSecret = %q, want it redacted", redactedCfg.Auth.JWTSecret)
+	}
+	if strings.Contains(redactedCfg.Database.URI, "hunter2") {
+		t.Errorf("Database.URI = %q still holds the password", redactedCfg.Database.URI)
+	}
+	if redactedCfg.Moderation.ClassifierURL != cfg.Moderation.ClassifierURL {
+		t.Errorf("ClassifierURL = %q, want it unchanged", redactedCfg.Moderation.ClassifierURL)
+	}
+	if cfg.Auth.JWTSecret != "secret" {
+		t.Error("Redacted() changed the original configuration")
+	}
+}
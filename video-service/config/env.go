@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets when the configuration is printed
+const redacted = "REDACTED"
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// envNames maps each setting's YAML path to its environment variable
+var envNames = map[string]string{}
+
+func init() {
+	walk(reflect.ValueOf(&Config{}).Elem(), "", func(path string, field reflect.StructField, _ reflect.Value) error {
+		envNames[path] = field.Tag.Get("env")
+		return nil
+	})
+}
+
+// walk calls fn for every leaf setting of v with its YAML path
+func walk(v reflect.Value, prefix string, fn func(path string, field reflect.StructField, value reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		value := v.Field(i)
+		if field.Type.Kind() == reflect.Struct && !reflect.PointerTo(field.Type).Implements(textUnmarshalerType) {
+			if err := walk(value, path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(path, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides every setting whose environment variable is set
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return walk(reflect.ValueOf(cfg).Elem(), "", func(path string, field reflect.StructField, value reflect.Value) error {
+		name := field.Tag.Get("env")
+		raw, ok := lookup(name)
+		if name == "" || !ok {
+			return nil
+		}
+		if err := setFromString(value, raw); err != nil {
+			return fmt.Errorf("invalid %s (%s): %w", name, path, err)
+		}
+		return nil
+	})
+}
+
+// setFromString parses raw into value according to its type. Lists are
+// comma-separated.
+func setFromString(value reflect.Value, raw string) error {
+	if u, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 5m")
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration that is safe to print:
+// secrets are replaced and passwords are removed from URLs
+func (c *Config) Redacted() *Config {
+	copied := *c
+	walk(reflect.ValueOf(&copied).Elem(), "", func(_ string, field reflect.StructField, value reflect.Value) error {
+		if value.Kind() != reflect.String || value.String() == "" {
+			return nil
+		}
+		switch field.Tag.Get("secret") {
+		case "true":
+			value.SetString(redacted)
+		case "url":
+			if u, err := url.Parse(value.String()); err == nil {
+				value.SetString(u.Redacted())
+			} else {
+				value.SetString(redacted)
+			}
+		}
+		return nil
+	})
+	return &copied
+}
+
+// YAML renders the configuration with secrets redacted, in the format Load
+// reads
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
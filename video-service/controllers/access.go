@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"time"
+	"video-service/middleware"
+	"video-service/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkAccess decides whether the current principal may watch a video. A
+// password-protected video is unlocked by an access token in the
+// X-Video-Access-Token header only: in a query string it would end up in
+// access logs, browser history and Referer headers.
+func (vc *VideoController) checkAccess(c *gin.Context, metadata *models.VideoMetadata) models.Access {
+	principal := middleware.CurrentPrincipal(c)
+	token := c.GetHeader("X-Video-Access-Token")
+	return metadata.AccessAt(models.Viewer{
+		UserID:     principal.UserID,
+		Privileged: vc.Policy.Allows(principal, middleware.PermViewPrivate),
+		Unlocked:   token != "" && vc.AccessTokens.Verify(token, metadata.ID.Hex()),
+	}, time.Now())
+}
+
+// canManage reports whether the current principal may change a video: its
+// owner, or anyone holding videos:moderate
+func (vc *VideoController) canManage(c *gin.Context, metadata *models.VideoMetadata) bool {
+	principal := middleware.CurrentPrincipal(c)
+	return metadata.IsOwnedBy(principal.UserID) || vc.Policy.Allows(principal, middleware.PermModerate)
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"video-service/middleware"
+	"video-service/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckAccessToken(t *testing.T) {
+	policy, err := middleware.LoadPolicy("../config/policy.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	tokens := middleware.NewAccessTokenIssuer("secret", time.Minute)
+	vc := NewVideoController(nil, nil, policy, tokens, nil)
+
+	metadata := &models.VideoMetadata{ID: primitive.NewObjectID(), OwnerID: "owner", Visibility: models.VisibilityPasswordProtected}
+	valid, _ := tokens.Issue(metadata.ID.Hex())
+	otherVideo, _ := tokens.Issue(primitive.NewObjectID().Hex())
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   models.Access
+	}{
+		{name: "header", header: valid, want: models.AccessGranted},
+		{name: "query string", query: valid, want: models.AccessNeedsPassword},
+		{name: "other video", header: otherVideo, want: models.AccessNeedsPassword},
+		{name: "garbage", header: "not-a-token", want: models.AccessNeedsPassword},
+		{name: "none", want: models.AccessNeedsPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/videos/"+metadata.ID.Hex()+"?access_token="+tt.query, nil)
+			if tt.header != "" {
+				c.Request.Header.Set("X-Video-Access-Token", tt.header)
+			}
+			if got := vc.checkAccess(c, metadata); got != tt.want {
+				t.Errorf("checkAccess() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
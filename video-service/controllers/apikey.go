@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/services"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	Service *services.APIKeyService
+}
+
+// NewAPIKeyController initializes a new APIKeyController
+func NewAPIKeyController(service *services.APIKeyService) *APIKeyController {
+	return &APIKeyController{Service: service}
+}
+
+// @Summary Create an API key
+// @Description Issues an API key that acts for owner_id with the given scopes. The key is only returned here.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body dto.APIKeyRequest true "API key"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 201 {object} dto.APIKey
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/admin/api-keys [post]
+func (kc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	var req dto.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	key, secret, err := kc.Service.CreateKey(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, req.Settings())
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	resp := dto.NewAPIKey(key)
+	resp.Key = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary List API keys
+// @Description Lists API keys, oldest first, including revoked ones
+// @Tags api-keys
+// @Produce json
+// @Param owner_id query string false "Only keys acting for this user"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of keys to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} dto.APIKeyList
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/admin/api-keys [get]
+func (kc *APIKeyController) ListAPIKeys(c *gin.Context) {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	keys, err := kc.Service.ListKeys(c.Request.Context(), c.Query("owner_id"), limit, offset)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewAPIKeyList(keys, limit, offset))
+}
+
+// @Summary Get an API key
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API key ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.APIKey
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/admin/api-keys/{id} [get]
+func (kc *APIKeyController) GetAPIKey(c *gin.Context) {
+	key, err := kc.Service.GetKey(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewAPIKey(key))
+}
+
+// @Summary Rotate an API key
+// @Description Issues a new secret for the key. The old secret keeps working for grace_period_seconds. The new key is only returned here.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param id path string true "API key ID"
+// @Param request body dto.RotateAPIKeyRequest false "Rotation settings"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.APIKey
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/admin/api-keys/{id}/rotate [post]
+func (kc *APIKeyController) RotateAPIKey(c *gin.Context) {
+	var req dto.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+			return
+		}
+	}
+	if req.GracePeriodSeconds < 0 {
+		utils.RespondWithError(c, apperrors.InvalidArgument("grace_period_seconds must not be negative"))
+		return
+	}
+
+	key, secret, err := kc.Service.RotateKey(c.Request.Context(), c.Param("id"), time.Duration(req.GracePeriodSeconds)*time.Second)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	resp := dto.NewAPIKey(key)
+	resp.Key = secret
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Revoke an API key
+// @Description Stops the key, and any rotated-out secret still in its grace period, from authenticating. The key stays listed.
+// @Tags api-keys
+// @Produce json
+// @Param id path string true "API key ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.APIKey
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/admin/api-keys/{id} [delete]
+func (kc *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	key, err := kc.Service.RevokeKey(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewAPIKey(key))
+}
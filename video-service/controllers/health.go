@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	Service  *services.HealthService
+	Shutdown *middleware.ShutdownGate
+}
+
+// NewHealthController initializes a new HealthController
+func NewHealthController(service *services.HealthService, shutdown *middleware.ShutdownGate) *HealthController {
+	return &HealthController{Service: service, Shutdown: shutdown}
+}
+
+// Healthz is the liveness probe. It checks no dependencies, so a failing
+// dependency never gets the process restarted. The probes live outside the
+// /api base path and are not part of the Swagger docs.
+func (hc *HealthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.Liveness{Status: "alive"})
+}
+
+// Readyz is the readiness probe. It answers 503 if any dependency check
+// fails, or without checking anything once the service is shutting down.
+func (hc *HealthController) Readyz(c *gin.Context) {
+	if hc.Shutdown.Closing() {
+		c.JSON(http.StatusServiceUnavailable, dto.Readiness{Status: "shutting_down"})
+		return
+	}
+
+	readiness := dto.NewReadiness(hc.Service.Run(c.Request.Context()))
+	status := http.StatusOK
+	if readiness.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportRequestLimit caps the body of an import request
+const ImportRequestLimit = 64 << 10
+
+// @Summary Import a video from a URL
+// @Description Accepts an http or https URL and downloads the video in the background, subject to the same size limit and quotas as uploads.
+// @Description The video is returned at once with status importing; poll it to follow bytes_downloaded until the status is ready or failed.
+// @Description Sources on private networks are refused.
+// @Tags videos-v2
+// @Accept json
+// @Produce json
+// @Param request body dto.ImportRequest true "Source and metadata"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 202 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 429 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Failure 503 {object} utils.ErrorBody
+// @Router /v2/videos/import [post]
+func (vc *VideoController) ImportVideoV2(c *gin.Context) {
+	var req dto.ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	metadata, err := vc.Importer.Start(c.Request.Context(), req.Request(middleware.CurrentPrincipal(c).UserID))
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v2/videos/"+metadata.ID.Hex())
+	c.JSON(http.StatusAccepted, dto.NewVideo(metadata))
+}
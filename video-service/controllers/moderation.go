@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/models"
+	"video-service/services"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationPreviewTTL is how long the preview links in the queue work
+const moderationPreviewTTL = 15 * time.Minute
+
+type ModerationController struct {
+	Service *services.VideoService
+}
+
+// NewModerationController initializes a new ModerationController
+func NewModerationController(service *services.VideoService) *ModerationController {
+	return &ModerationController{Service: service}
+}
+
+// @Summary List the moderation queue
+// @Description Lists videos awaiting a moderator (in_review) or the classifiers (moderating), oldest first, with their labels and short-lived preview links
+// @Tags moderation
+// @Produce json
+// @Param status query string false "Queue to list" Enums(in_review, moderating) default(in_review)
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of videos to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} dto.ModerationQueue
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/moderation/queue [get]
+func (mc *ModerationController) ListQueue(c *gin.Context) {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+	status := models.Status(c.DefaultQuery("status", string(models.StatusInReview)))
+
+	ctx := c.Request.Context()
+	videos, err := mc.Service.ModerationQueue(ctx, status, limit, offset)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	queue := dto.ModerationQueue{Items: make([]dto.ModerationItem, 0, len(videos)), Limit: limit, Offset: offset}
+	for i := range videos {
+		var preview dto.ModerationPreview
+		if preview.VideoURL, err = mc.Service.PresignVideo(ctx, videos[i].URL, moderationPreviewTTL); err != nil {
+			utils.RespondWithError(c, err)
+			return
+		}
+		if preview.ThumbnailURL, err = mc.Service.PresignVideo(ctx, videos[i].Thumbnail, moderationPreviewTTL); err != nil {
+			utils.RespondWithError(c, err)
+			return
+		}
+		queue.Items = append(queue.Items, dto.NewModerationItem(&videos[i], preview))
+	}
+	c.JSON(http.StatusOK, queue)
+}
+
+// @Summary Approve a video
+// @Description Publishes a video awaiting moderation and records a video.approved event
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body dto.ModerationDecisionRequest false "Decision"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/moderation/videos/{id}/approve [post]
+func (mc *ModerationController) ApproveVideo(c *gin.Context) {
+	var req dto.ModerationDecisionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+			return
+		}
+	}
+
+	video, err := mc.Service.ApproveVideo(c.Request.Context(), c.Param("id"), middleware.CurrentPrincipal(c).UserID, req.Reason)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideo(video))
+}
+
+// @Summary Reject a video
+// @Description Refuses a video awaiting moderation, keeping its files private, and records a video.rejected event
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body dto.ModerationDecisionRequest true "Decision"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/moderation/videos/{id}/reject [post]
+func (mc *ModerationController) RejectVideo(c *gin.Context) {
+	var req dto.ModerationDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	video, err := mc.Service.RejectVideo(c.Request.Context(), c.Param("id"), middleware.CurrentPrincipal(c).UserID, req.Reason)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideo(video))
+}
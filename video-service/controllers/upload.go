@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+	"video-service/apperrors"
+	"video-service/metrics"
+	"video-service/middleware"
+	"video-service/models"
+	"video-service/services"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadFormOverhead is the room left in an upload request, beyond the
+// maximum file size, for the thumbnail and form fields
+const UploadFormOverhead = 10 << 20
+
+// maxFieldSize caps a single text field of an upload form
+const maxFieldSize = 64 << 10
+
+// storedPart is a file part that has been streamed to storage
+type storedPart struct {
+	URL         string
+	ContentType string
+	Size        int64
+	Duration    int
+}
+
+// @Summary Upload a video
+// @Description Uploads a video and optional thumbnail to S3 and saves metadata.
+// @Description The body is consumed part by part, so all text fields must be sent before the file parts.
+// @Tags videos
+// @Accept multipart/form-data
+// @Produce json
+// @Param title formData string true "Video title"
+// @Param tags formData []string false "Video tags"
+// @Param file formData file true "Video file"
+// @Param thumbnail formData file false "Thumbnail (video or image)"
+// @Param visibility formData string false "Visibility: public, unlisted, private or password_protected" default(public)
+// @Param allowed_users formData []string false "Users allowed to watch a private video"
+// @Param password formData string false "Password for a password-protected video"
+// @Param publish_at formData string false "RFC 3339 time at which the video becomes available"
+// @Param expire_at formData string false "RFC 3339 time at which the video stops being available"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 413 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 429 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/upload [post]
+func (vc *VideoController) UploadVideo(c *gin.Context) {
+	res, err := vc.storeUpload(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	utils.RespondWithSuccess(c, http.StatusOK, gin.H{
+		"message":       "Video uploaded successfully",
+		"id":            res.ID.Hex(),
+		"title":         res.Title,
+		"url":           res.URL,
+		"thumbnail_url": res.Thumbnail,
+		"tags":          res.Tags,
+		"visibility":    res.Visibility,
+		"availability":  res.Availability,
+		"publish_at":    res.PublishAt,
+		"expire_at":     res.ExpireAt,
+	})
+}
+
+// storeUpload stores an upload and records its size and duration
+func (vc *VideoController) storeUpload(c *gin.Context) (*models.VideoMetadata, error) {
+	start := time.Now()
+	res, err := vc.receiveUpload(c)
+	metrics.UploadDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+	if err == nil {
+		metrics.UploadBytes.Observe(float64(res.Size))
+	}
+	return res, err
+}
+
+// receiveUpload consumes the multipart body, streaming each file to storage,
+// and saves the video's metadata
+func (vc *VideoController) receiveUpload(c *gin.Context) (*models.VideoMetadata, error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, apperrors.InvalidArgument("Expected a multipart/form-data body")
+	}
+
+	ctx := c.Request.Context()
+	ownerID := middleware.CurrentPrincipal(c).UserID
+	fields := url.Values{}
+	var details *services.VideoDetails
+	var video, thumbnail *storedPart
+
+	// Quota is reserved when the first file part arrives, sized from the
+	// request, and released again unless the upload is saved. Files stored
+	// by an upload that is not saved are removed.
+	var reserved int64
+	quotaHeld, saved := false, false
+	defer func() {
+		if saved {
+			return
+		}
+		if quotaHeld {
+			vc.Quotas.Release(ctx, ownerID, reserved)
+		}
+		for _, part := range []*storedPart{video, thumbnail} {
+			if part != nil {
+				vc.Service.RemoveFiles(ctx, part.URL)
+			}
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, readError(err)
+		}
+
+		if part.FileName() == "" {
+			if details != nil {
+				return nil, apperrors.InvalidArgument("Form fields must be sent before file parts")
+			}
+			value, err := utils.ReadFormValue(part, maxFieldSize)
+			if err != nil {
+				return nil, readError(err)
+			}
+			fields.Add(part.FormName(), value)
+			continue
+		}
+
+		if details == nil {
+			details, err = parseUploadDetails(fields, ownerID)
+			if err != nil {
+				return nil, err
+			}
+			reserved = vc.estimateUploadSize(c.Request)
+			if err := vc.Quotas.Reserve(ctx, ownerID, reserved); err != nil {
+				return nil, err
+			}
+			quotaHeld = true
+		}
+
+		switch part.FormName() {
+		case "file":
+			if video != nil {
+				return nil, apperrors.InvalidArgument("Only one video file may be uploaded")
+			}
+			video, err = vc.streamVideo(ctx, ownerID, part)
+		case "thumbnail":
+			if thumbnail != nil {
+				return nil, apperrors.InvalidArgument("Only one thumbnail may be uploaded")
+			}
+			thumbnail, err = vc.streamThumbnail(ctx, ownerID, part)
+		default:
+			return nil, apperrors.InvalidArgument(fmt.Sprintf("Unexpected file field: %s", part.FormName()))
+		}
+		if infected, ok := services.AsInfected(err); ok {
+			return nil, vc.rejectUpload(ctx, *details, part.Header.Get("Content-Type"), infected)
+		}
+		if err != nil {
+			return nil, streamError(err)
+		}
+	}
+
+	if details == nil {
+		if _, err := parseUploadDetails(fields, ownerID); err != nil {
+			return nil, err
+		}
+	}
+	if video == nil {
+		return nil, apperrors.InvalidArgument("Video file is required")
+	}
+
+	size := video.Size
+	thumbnailURL, thumbnailType := "", ""
+	if thumbnail != nil {
+		size += thumbnail.Size
+		thumbnailURL, thumbnailType = thumbnail.URL, thumbnail.ContentType
+	}
+
+	// Settle the reservation on the bytes actually stored
+	if err := vc.Quotas.Adjust(ctx, ownerID, size-reserved); err != nil {
+		return nil, err
+	}
+	reserved = size
+
+	res, err := vc.Service.CreateAndSaveMetadata(ctx, *details, video.Duration, size, video.URL, thumbnailURL, thumbnailType, video.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	saved = true
+
+	return &res, nil
+}
+
+// rejectUpload records an upload the scanner found malware in and returns
+// the error reported to the uploader
+func (vc *VideoController) rejectUpload(ctx context.Context, details services.VideoDetails, contentType string, infected *services.InfectedError) error {
+	res, err := vc.Service.SaveRejectedVideo(ctx, details, contentType, infected)
+	if err != nil {
+		return err
+	}
+	return services.ErrMalwareDetected.WithDetail("id", res.ID.Hex())
+}
+
+// streamVideo pipes the video part straight into storage and probing, under
+// a new key
+func (vc *VideoController) streamVideo(ctx context.Context, ownerID string, part *multipart.Part) (*storedPart, error) {
+	contentType := part.Header.Get("Content-Type")
+	if !utils.IsVideoContentType(contentType) {
+		return nil, apperrors.Unsupported(fmt.Sprintf("Unsupported file type: %s", contentType))
+	}
+
+	body := &utils.SizeLimitedReader{R: part, Limit: vc.Quotas.Limits.MaxFileSize}
+	videoURL, duration, err := vc.Service.ProcessAndUploadVideo(ctx, services.NewObjectKey(ownerID, part.FileName()), contentType, body)
+	if body.Exceeded() {
+		vc.Service.RemoveFiles(ctx, videoURL)
+		return nil, utils.ErrFileTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedPart{URL: videoURL, ContentType: contentType, Size: body.N, Duration: duration}, nil
+}
+
+// streamThumbnail pipes the thumbnail part straight into storage, under a
+// new key
+func (vc *VideoController) streamThumbnail(ctx context.Context, ownerID string, part *multipart.Part) (*storedPart, error) {
+	contentType := part.Header.Get("Content-Type")
+	if !utils.IsVideoContentType(contentType) && !utils.IsImageContentType(contentType) {
+		return nil, apperrors.Unsupported("Invalid thumbnail type: must be an image or a video")
+	}
+
+	body := &utils.SizeLimitedReader{R: part, Limit: vc.Quotas.Limits.MaxFileSize}
+	thumbnailURL, err := vc.Service.UploadThumbnail(ctx, services.NewObjectKey(ownerID, part.FileName()), contentType, body)
+	if body.Exceeded() {
+		vc.Service.RemoveFiles(ctx, thumbnailURL)
+		return nil, utils.ErrFileTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &storedPart{URL: thumbnailURL, ContentType: contentType, Size: body.N}, nil
+}
+
+// estimateUploadSize is the quota reserved before the size of an upload is
+// known: the declared request length, or the largest allowed upload
+func (vc *VideoController) estimateUploadSize(r *http.Request) int64 {
+	if r.ContentLength > 0 {
+		return r.ContentLength
+	}
+	if maxSize := vc.Quotas.Limits.MaxFileSize; maxSize > 0 {
+		return maxSize + UploadFormOverhead
+	}
+	return 0
+}
+
+// parseUploadDetails validates the text fields of an upload form
+func parseUploadDetails(fields url.Values, ownerID string) (*services.VideoDetails, error) {
+	title := fields.Get("title")
+	if title == "" {
+		return nil, apperrors.InvalidArgument("Title is required")
+	}
+
+	visibility := services.VisibilitySettings{
+		Visibility:   models.Visibility(fields.Get("visibility")),
+		AllowedUsers: fields["allowed_users"],
+		Password:     fields.Get("password"),
+	}
+	if visibility.Visibility == "" {
+		visibility.Visibility = models.VisibilityPublic
+	}
+	if err := visibility.Validate(); err != nil {
+		return nil, err
+	}
+
+	schedule, err := parseScheduleForm(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.VideoDetails{
+		OwnerID:    ownerID,
+		Title:      title,
+		Tags:       fields["tags"],
+		Visibility: visibility,
+		Schedule:   schedule,
+	}, nil
+}
+
+// parseScheduleForm reads the optional publish_at and expire_at form fields
+func parseScheduleForm(fields url.Values) (services.ScheduleSettings, error) {
+	var schedule services.ScheduleSettings
+	for field, dst := range map[string]**time.Time{"publish_at": &schedule.PublishAt, "expire_at": &schedule.ExpireAt} {
+		value := fields.Get(field)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return schedule, apperrors.InvalidArgument(fmt.Sprintf("%s must be an RFC 3339 timestamp", field))
+		}
+		*dst = &t
+	}
+	return schedule, schedule.Validate()
+}
+
+// streamError converts a failure while reading the upload stream. The body
+// limit set by middleware.LimitBodySize surfaces here as *http.MaxBytesError.
+func streamError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return utils.ErrFileTooLarge
+	}
+	return err
+}
+
+// readError converts a failure while parsing the multipart body itself, which
+// is the client's fault unless it already carries a code
+func readError(err error) error {
+	err = streamError(err)
+	if _, ok := apperrors.As(err); ok {
+		return err
+	}
+	return apperrors.Wrap(apperrors.CodeInvalidArgument, err, "Malformed multipart body")
+}
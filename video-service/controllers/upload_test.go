@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"video-service/apperrors"
+	"video-service/middleware"
+	"video-service/services"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// fakeBucket is a path-style S3 endpoint that tracks the objects put in and
+// deleted from the "videos" bucket
+type fakeBucket struct {
+	mu      sync.Mutex
+	objects map[string]bool
+	puts    int
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	key := strings.TrimPrefix(r.URL.Path, "/videos/")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut && !r.URL.Query().Has("acl"):
+		b.objects[key] = true
+		b.puts++
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPut:
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadPart is a part of a multipart upload body; parts without a file
+// name are form fields
+type uploadPart struct {
+	field, fileName, contentType string
+	body                         []byte
+}
+
+func multipartBody(t *testing.T, parts []uploadPart) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		var err error
+		var pw io.Writer
+		if p.fileName == "" {
+			pw, err = w.CreateFormField(p.field)
+		} else {
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.fileName+`"`)
+			h.Set("Content-Type", p.contentType)
+			pw, err = w.CreatePart(h)
+		}
+		if err != nil {
+			t.Fatalf("create part %s: %v", p.field, err)
+		}
+		pw.Write(p.body)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+	return &buf, w.FormDataContentType()
+}
+
+// writeFFprobe writes a stand-in for ffprobe that runs script
+func writeFFprobe(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffprobe")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("write ffprobe: %v", err)
+	}
+	return path
+}
+
+func TestReceiveUploadRemovesFilesOfFailedUploads(t *testing.T) {
+	probeOK := `echo '{"format":{"duration":"12.0"}}'`
+	title := uploadPart{field: "title", body: []byte("Holiday")}
+	video := uploadPart{field: "file", fileName: "clip.mp4", contentType: "video/mp4", body: bytes.Repeat([]byte("v"), 100)}
+
+	tests := []struct {
+		name       string
+		probe      string
+		parts      []uploadPart
+		wantCode   apperrors.Code // Empty for errors without a code
+		wantStored int            // Objects stored before the failure
+	}{
+		{
+			name:  "thumbnail too large",
+			probe: probeOK,
+			parts: []uploadPart{title, video,
+				{field: "thumbnail", fileName: "thumb.png", contentType: "image/png", body: bytes.Repeat([]byte("t"), 2048)}},
+			wantCode:   apperrors.CodePayloadTooLarge,
+			wantStored: 1,
+		},
+		{
+			name:  "unexpected file field",
+			probe: probeOK,
+			parts: []uploadPart{title, video,
+				{field: "subtitles", fileName: "clip.vtt", contentType: "text/vtt", body: []byte("WEBVTT")}},
+			wantCode:   apperrors.CodeInvalidArgument,
+			wantStored: 1,
+		},
+		{
+			name:       "second video file",
+			probe:      probeOK,
+			parts:      []uploadPart{title, video, video},
+			wantCode:   apperrors.CodeInvalidArgument,
+			wantStored: 1,
+		},
+		{
+			name:  "field after file",
+			probe: probeOK,
+			parts: []uploadPart{title, video,
+				{field: "tags", body: []byte("beach")}},
+			wantCode:   apperrors.CodeInvalidArgument,
+			wantStored: 1,
+		},
+		{
+			name:       "ffprobe fails",
+			probe:      "exit 1",
+			parts:      []uploadPart{title, video},
+			wantStored: 1,
+		},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			bucket := &fakeBucket{objects: map[string]bool{}}
+			server := httptest.NewServer(bucket)
+			defer server.Close()
+
+			client := s3.New(s3.Options{
+				Region:       "us-east-1",
+				BaseEndpoint: aws.String(server.URL),
+				UsePathStyle: true,
+				Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+			})
+			service := &services.VideoService{
+				DB:          mt.DB,
+				S3Client:    client,
+				Uploader:    manager.NewUploader(client),
+				Bucket:      "videos",
+				FFprobePath: writeFFprobe(t, tt.probe),
+				ScratchDir:  t.TempDir(),
+			}
+			quotas := services.NewQuotaService(mt.DB, services.QuotaLimits{MaxFileSize: 1024})
+			vc := NewVideoController(service, quotas, nil, nil, nil)
+
+			// Reserving takes four updates and releasing three
+			for i := 0; i < 7; i++ {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			}
+
+			body, contentType := multipartBody(t, tt.parts)
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/videos/upload", body)
+			c.Request.Header.Set("Content-Type", contentType)
+			c.Set("principal", &middleware.Principal{UserID: "owner"})
+
+			_, err := vc.receiveUpload(c)
+			if err == nil {
+				t.Fatal("receiveUpload() succeeded")
+			}
+			if appErr, ok := apperrors.As(err); tt.wantCode != "" && (!ok || appErr.Code != tt.wantCode) {
+				t.Errorf("receiveUpload() error = %v, want code %s", err, tt.wantCode)
+			}
+
+			if bucket.puts != tt.wantStored {
+				t.Errorf("stored %d objects, want %d", bucket.puts, tt.wantStored)
+			}
+			if len(bucket.objects) != 0 {
+				t.Errorf("objects left in bucket: %v", bucket.objects)
+			}
+
+			updates := 0
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "update" {
+					updates++
+				}
+			}
+			if updates != 7 {
+				t.Errorf("ran %d usage updates, want 7 (quota reserved and released)", updates)
+			}
+		})
+	}
+}
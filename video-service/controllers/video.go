@@ -1,9 +1,13 @@
 package controllers
 
 import (
-	"fmt"
-	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/models"
 	"video-service/services"
 
 	"video-service/utils"
@@ -12,88 +16,46 @@ import (
 )
 
 type VideoController struct {
-	Service *services.VideoService
+	Service      *services.VideoService
+	Quotas       *services.QuotaService
+	Policy       *middleware.Policy
+	AccessTokens *middleware.AccessTokenIssuer
+	Importer     *services.VideoImporter
 }
 
 // NewVideoController initializes a new VideoController
-func NewVideoController(service *services.VideoService) *VideoController {
-	return &VideoController{Service: service}
+func NewVideoController(service *services.VideoService, quotas *services.QuotaService, policy *middleware.Policy, accessTokens *middleware.AccessTokenIssuer, importer *services.VideoImporter) *VideoController {
+	return &VideoController{Service: service, Quotas: quotas, Policy: policy, AccessTokens: accessTokens, Importer: importer}
 }
 
-// @Summary Upload a video
-// @Description Uploads a video and optional thumbnail to S3 and saves metadata
+// @Summary Get upload usage
+// @Description Shows the caller's storage and daily upload consumption against their quotas. Limits of 0 are unlimited.
 // @Tags videos
-// @Accept multipart/form-data
 // @Produce json
-// @Param title formData string true "Video title"
-// @Param tags formData []string false "Video tags"
-// @Param file formData file true "Video file"
-// @Param thumbnail formData file false "Thumbnail (video or image)"
+// @Security BearerAuth
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /upload [post]
-func (vc *VideoController) UploadVideo(c *gin.Context) {
-    title, err := utils.ValidateRequiredField(c, "title", "Title is required")
-    if err != nil {
-        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
-        return
-    }
-
-    videoFile, videoHeader, err := utils.ValidateFile(c, "file")
-    if err != nil {
-        utils.RespondWithError(c, http.StatusBadRequest, err.Error())
-        return
-    }
-    defer videoFile.Close()
-
-    var thumbnailFile multipart.File
-    var thumbnailHeader *multipart.FileHeader
-    thumbnailType := ""
-
-    if c.Request.MultipartForm != nil {
-        thumbnailFile, thumbnailHeader, _ = c.Request.FormFile("thumbnail")
-        if thumbnailFile != nil {
-            defer thumbnailFile.Close()
-            thumbnailType = thumbnailHeader.Header.Get("Content-Type")
-            if !utils.IsVideoContentType(thumbnailType) && !utils.IsImageContentType(thumbnailType) {
-                utils.RespondWithError(c, http.StatusBadRequest, "Invalid thumbnail type: must be an image or a video")
-                return
-            }
-        }
-    }
-
-    videoURL, duration, err := vc.Service.ProcessAndUploadVideo(videoHeader.Filename, videoHeader.Header.Get("Content-Type"), videoFile)
-    if err != nil {
-        utils.RespondWithError(c, http.StatusInternalServerError, err.Error())
-        return
-    }
-
-    thumbnailURL := ""
-    if thumbnailFile != nil {
-        thumbnailURL, err = vc.Service.UploadThumbnail(thumbnailHeader.Filename, thumbnailType, thumbnailFile)
-        if err != nil {
-            utils.RespondWithError(c, http.StatusInternalServerError, "Failed to upload thumbnail")
-            return
-        }
-    }
-
-    res, err := vc.Service.CreateAndSaveMetadata(title, c.PostFormArray("tags"), duration, videoURL, thumbnailURL, thumbnailType, videoHeader.Header.Get("Content-Type"))
-    if err != nil {
-        utils.RespondWithError(c, http.StatusInternalServerError, "Failed to save metadata")
-        return
-    }
-
-	fmt.Println("res", res);
-
-    utils.RespondWithSuccess(c, http.StatusOK, gin.H{
-        "message":        "Video uploaded successfully",
-		"id": res.ID.Hex(),
-		"title": res.Title,
-        "url":            res.URL,
-        "thumbnail_url":  res.Thumbnail,
-		"tags": res.Tags,
-    })
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/usage [get]
+func (vc *VideoController) GetUsage(c *gin.Context) {
+	usage, err := vc.currentUsage(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	limits := vc.Quotas.Limits
+	utils.RespondWithSuccess(c, http.StatusOK, gin.H{
+		"storage_bytes":      usage.StorageBytes,
+		"storage_limit":      limits.UserStorageBytes,
+		"uploads_today":      usage.DayCount,
+		"daily_upload_limit": limits.UserDailyUploads,
+		"max_file_size":      limits.MaxFileSize,
+	})
+}
+
+func (vc *VideoController) currentUsage(c *gin.Context) (*services.Usage, error) {
+	return vc.Quotas.GetUsage(c.Request.Context(), middleware.CurrentPrincipal(c).UserID)
 }
 
 // @Summary Get video metadata
@@ -101,22 +63,273 @@ func (vc *VideoController) UploadVideo(c *gin.Context) {
 // @Tags videos
 // @Produce json
 // @Param id path string true "Video ID"
+// @Param X-Video-Access-Token header string false "Access token for a password-protected video"
+// @Security BearerAuth
 // @Success 200 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
-// @Router /{id} [get]
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/{id} [get]
 func (vc *VideoController) GetMetadata(c *gin.Context) {
-	id := c.Param("id")
+	metadata, err := vc.viewableVideo(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"metadata": dto.NewVideo(metadata)})
+}
 
-	metadata, err := vc.Service.GetVideoMetadata(id)
+// viewableVideo loads the video named by the id parameter, provided the
+// current principal may watch it. Files that are not public are linked with
+// time-limited URLs.
+func (vc *VideoController) viewableVideo(c *gin.Context) (*models.VideoMetadata, error) {
+	metadata, err := vc.Service.GetVideoMetadata(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		if err.Error() == "metadata not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Metadata not found"})
-			return
+		return nil, err
+	}
+
+	switch vc.checkAccess(c, metadata) {
+	case models.AccessDenied:
+		return nil, apperrors.NotFound("Video not found").WithDetail("id", metadata.ID.Hex())
+	case models.AccessNeedsPassword:
+		return nil, apperrors.PermissionDenied("Video is password protected")
+	}
+	if err := vc.Service.SignMediaLinks(c.Request.Context(), metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// batchVideos looks up several videos at once. Videos the current principal
+// may not watch are reported as missing, like malformed and unknown IDs.
+// Password-protected videos count as not watchable, since an access token
+// only ever covers a single video.
+func (vc *VideoController) batchVideos(c *gin.Context, ids []string) ([]models.VideoMetadata, []string, error) {
+	found, missing, err := vc.Service.GetVideosByIDs(c.Request.Context(), ids, func(metadata *models.VideoMetadata) bool {
+		return vc.checkAccess(c, metadata) == models.AccessGranted
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range found {
+		if err := vc.Service.SignMediaLinks(c.Request.Context(), &found[i]); err != nil {
+			return nil, nil, err
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch metadata"})
+	}
+	return found, missing, nil
+}
+
+// @Summary List videos
+// @Description Lists public videos, newest first. Unlisted, private and password-protected videos are never listed.
+// @Tags videos
+// @Produce json
+// @Param q query string false "Search in titles"
+// @Param tag query string false "Filter by tag"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of videos to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos [get]
+func (vc *VideoController) ListVideos(c *gin.Context) {
+	videos, _, _, err := vc.listVideos(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"metadata": metadata})
+	c.JSON(http.StatusOK, gin.H{"videos": dto.NewVideoList(videos, 0, 0).Videos})
+}
+
+// listVideos runs the search described by the query string, returning the
+// page bounds it used
+func (vc *VideoController) listVideos(c *gin.Context) ([]models.VideoMetadata, int64, int64, error) {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	videos, err := vc.Service.ListVideos(c.Request.Context(), c.Query("q"), c.Query("tag"), limit, offset)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return videos, limit, offset, nil
+}
+
+// parsePage reads the limit and offset query parameters
+func parsePage(c *gin.Context) (int64, int64, error) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit < 1 || limit > 100 {
+		return 0, 0, apperrors.InvalidArgument("limit must be between 1 and 100")
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, apperrors.InvalidArgument("offset must be a non-negative integer")
+	}
+	return limit, offset, nil
+}
+
+// @Summary Update video visibility
+// @Description Changes who can find and watch a video. Only the owner or a moderator may change it.
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param settings body services.VisibilitySettings true "Visibility settings"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/{id}/visibility [put]
+func (vc *VideoController) UpdateVisibility(c *gin.Context) {
+	var settings services.VisibilitySettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+	metadata, err := vc.updateVisibility(c, settings)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	utils.RespondWithSuccess(c, http.StatusOK, gin.H{
+		"id":            metadata.ID.Hex(),
+		"visibility":    metadata.Visibility,
+		"allowed_users": metadata.AllowedUsers,
+	})
+}
+
+func (vc *VideoController) updateVisibility(c *gin.Context, settings services.VisibilitySettings) (*models.VideoMetadata, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := vc.manageableVideo(c); err != nil {
+		return nil, err
+	}
+	return vc.Service.UpdateVisibility(c.Request.Context(), c.Param("id"), settings)
+}
+
+// @Summary Update video schedule
+// @Description Sets when a video is published and when it expires. Null times mean immediately and never. Only the owner or a moderator may change it.
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param settings body services.ScheduleSettings true "Publishing window"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/{id}/schedule [put]
+func (vc *VideoController) UpdateSchedule(c *gin.Context) {
+	var settings services.ScheduleSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+	metadata, err := vc.updateSchedule(c, settings)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	utils.RespondWithSuccess(c, http.StatusOK, gin.H{
+		"id":           metadata.ID.Hex(),
+		"availability": metadata.Availability,
+		"publish_at":   metadata.PublishAt,
+		"expire_at":    metadata.ExpireAt,
+	})
+}
+
+func (vc *VideoController) updateSchedule(c *gin.Context, settings services.ScheduleSettings) (*models.VideoMetadata, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := vc.manageableVideo(c); err != nil {
+		return nil, err
+	}
+	return vc.Service.UpdateSchedule(c.Request.Context(), c.Param("id"), settings)
+}
+
+// manageableVideo loads the video named by the id parameter, provided the
+// current principal may change it
+func (vc *VideoController) manageableVideo(c *gin.Context) (*models.VideoMetadata, error) {
+	metadata, err := vc.Service.GetVideoMetadata(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if !vc.canManage(c, metadata) {
+		return nil, apperrors.PermissionDenied("Only the owner can change this video")
+	}
+	return metadata, nil
+}
+
+type accessRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// @Summary Unlock a password-protected video
+// @Description Exchanges the video password for a short-lived access token, sent back as the X-Video-Access-Token header
+// @Tags videos
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body accessRequest true "Video password"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /videos/{id}/access [post]
+func (vc *VideoController) RequestAccess(c *gin.Context) {
+	var req accessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Password is required"))
+		return
+	}
+
+	token, err := vc.unlockVideo(c, req.Password)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	utils.RespondWithSuccess(c, http.StatusOK, gin.H{
+		"access_token": token,
+		"expires_in":   int(vc.AccessTokens.TTL.Seconds()),
+	})
+}
+
+// unlockVideo exchanges the password of the video named by the id parameter
+// for an access token
+func (vc *VideoController) unlockVideo(c *gin.Context, password string) (string, error) {
+	metadata, err := vc.Service.GetVideoMetadata(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return "", err
+	}
+	if metadata.EffectiveStatus() != models.StatusReady || !metadata.IsAvailableAt(time.Now()) {
+		return "", apperrors.NotFound("Video not found").WithDetail("id", metadata.ID.Hex())
+	}
+	if metadata.EffectiveVisibility() != models.VisibilityPasswordProtected {
+		return "", apperrors.InvalidArgument("Video is not password protected")
+	}
+	if !vc.Service.CheckVideoPassword(metadata, password) {
+		return "", apperrors.PermissionDenied("Invalid password")
+	}
+	return vc.AccessTokens.Issue(metadata.ID.Hex())
 }
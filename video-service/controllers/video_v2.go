@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"net/http"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The v2 handlers share their logic with v1 and differ only in representation:
+// explicit DTOs with snake_case fields, string IDs and RFC 3339 timestamps.
+
+// @Summary Upload a video
+// @Description Uploads a video and optional thumbnail to S3 and saves metadata.
+// @Description The body is consumed part by part, so all text fields must be sent before the file parts.
+// @Tags videos-v2
+// @Accept multipart/form-data
+// @Produce json
+// @Param title formData string true "Video title"
+// @Param tags formData []string false "Video tags"
+// @Param file formData file true "Video file"
+// @Param thumbnail formData file false "Thumbnail (video or image)"
+// @Param visibility formData string false "Visibility: public, unlisted, private or password_protected" default(public)
+// @Param allowed_users formData []string false "Users allowed to watch a private video"
+// @Param password formData string false "Password for a password-protected video"
+// @Param publish_at formData string false "RFC 3339 time at which the video becomes available"
+// @Param expire_at formData string false "RFC 3339 time at which the video stops being available"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 201 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 413 {object} utils.ErrorBody
+// @Failure 415 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 429 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos [post]
+func (vc *VideoController) UploadVideoV2(c *gin.Context) {
+	res, err := vc.storeUpload(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.NewVideo(res))
+}
+
+// @Summary List videos
+// @Description Lists public videos, newest first. Unlisted, private and password-protected videos are never listed.
+// @Tags videos-v2
+// @Produce json
+// @Param q query string false "Search in titles"
+// @Param tag query string false "Filter by tag"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of videos to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} dto.VideoList
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos [get]
+func (vc *VideoController) ListVideosV2(c *gin.Context) {
+	videos, limit, offset, err := vc.listVideos(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideoList(videos, limit, offset))
+}
+
+// @Summary Get a video
+// @Description Retrieves a video's metadata by ID
+// @Tags videos-v2
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param X-Video-Access-Token header string false "Access token for a password-protected video"
+// @Security BearerAuth
+// @Success 200 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/{id} [get]
+func (vc *VideoController) GetVideoV2(c *gin.Context) {
+	metadata, err := vc.viewableVideo(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideo(metadata))
+}
+
+// @Summary Get several videos
+// @Description Looks up to 100 videos in one call. Found videos are returned in request order; malformed, unknown and hidden IDs are listed in missing_ids.
+// @Tags videos-v2
+// @Accept json
+// @Produce json
+// @Param request body dto.BatchGetRequest true "Video IDs"
+// @Security BearerAuth
+// @Success 200 {object} dto.BatchGetResponse
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/batch [post]
+func (vc *VideoController) BatchGetVideosV2(c *gin.Context) {
+	var req dto.BatchGetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	videos, missing, err := vc.batchVideos(c, req.IDs)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewBatchGetResponse(videos, missing))
+}
+
+// @Summary Get upload usage
+// @Description Shows the caller's storage and daily upload consumption against their quotas. Limits of 0 are unlimited.
+// @Tags videos-v2
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.Usage
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/usage [get]
+func (vc *VideoController) GetUsageV2(c *gin.Context) {
+	usage, err := vc.currentUsage(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUsage(usage, vc.Quotas.Limits))
+}
+
+// @Summary Update video visibility
+// @Description Changes who can find and watch a video. Only the owner or a moderator may change it.
+// @Tags videos-v2
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body dto.VisibilityRequest true "Visibility settings"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/{id}/visibility [put]
+func (vc *VideoController) UpdateVisibilityV2(c *gin.Context) {
+	var req dto.VisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	metadata, err := vc.updateVisibility(c, req.Settings())
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideo(metadata))
+}
+
+// @Summary Update video schedule
+// @Description Sets when a video is published and when it expires. Null times mean immediately and never. Only the owner or a moderator may change it.
+// @Tags videos-v2
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body dto.ScheduleRequest true "Publishing window"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.Video
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/{id}/schedule [put]
+func (vc *VideoController) UpdateScheduleV2(c *gin.Context) {
+	var req dto.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	metadata, err := vc.updateSchedule(c, req.Settings())
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewVideo(metadata))
+}
+
+// @Summary Unlock a password-protected video
+// @Description Exchanges the video password for a short-lived access token, to be sent as the X-Video-Access-Token header
+// @Tags videos-v2
+// @Accept json
+// @Produce json
+// @Param id path string true "Video ID"
+// @Param request body dto.AccessRequest true "Video password"
+// @Security BearerAuth
+// @Success 200 {object} dto.AccessToken
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/videos/{id}/access [post]
+func (vc *VideoController) RequestAccessV2(c *gin.Context) {
+	var req dto.AccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Password is required"))
+		return
+	}
+
+	token, err := vc.unlockVideo(c, req.Password)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.AccessToken{
+		AccessToken:      token,
+		ExpiresInSeconds: int(vc.AccessTokens.TTL.Seconds()),
+	})
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"net/http"
+	"video-service/apperrors"
+	"video-service/dto"
+	"video-service/middleware"
+	"video-service/services"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	Service *services.WebhookService
+}
+
+// NewWebhookController initializes a new WebhookController
+func NewWebhookController(service *services.WebhookService) *WebhookController {
+	return &WebhookController{Service: service}
+}
+
+// @Summary Create a webhook
+// @Description Subscribes a URL to events for the caller's videos. The signing secret is only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body dto.WebhookRequest true "Webhook"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 201 {object} dto.Webhook
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks [post]
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	var req dto.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	sub, err := wc.Service.CreateSubscription(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, req.Settings())
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	resp := dto.NewWebhook(sub)
+	resp.Secret = sub.Secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary List webhooks
+// @Description Lists the caller's webhooks
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.WebhookList
+// @Failure 401 {object} utils.ErrorBody
+// @Failure 403 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks [get]
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	subs, err := wc.Service.ListSubscriptions(c.Request.Context(), middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewWebhookList(subs))
+}
+
+// @Summary Get a webhook
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Security BearerAuth
+// @Success 200 {object} dto.Webhook
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks/{id} [get]
+func (wc *WebhookController) GetWebhook(c *gin.Context) {
+	sub, err := wc.Service.GetSubscription(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, c.Param("id"))
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewWebhook(sub))
+}
+
+// @Summary Update a webhook
+// @Description Replaces the URL and event filters. Set active to true to re-enable a webhook disabled after repeated failures.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param request body dto.WebhookRequest true "Webhook"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 200 {object} dto.Webhook
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks/{id} [put]
+func (wc *WebhookController) UpdateWebhook(c *gin.Context) {
+	var req dto.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondWithError(c, apperrors.InvalidArgument("Invalid request body").WithDetail("reason", err.Error()))
+		return
+	}
+
+	sub, err := wc.Service.UpdateSubscription(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, c.Param("id"), req.Settings(), req.Active)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewWebhook(sub))
+}
+
+// @Summary Delete a webhook
+// @Description Deletes a webhook and its delivery log
+// @Tags webhooks
+// @Param id path string true "Webhook ID"
+// @Security BearerAuth
+// @Success 204
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks/{id} [delete]
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	if err := wc.Service.DeleteSubscription(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, c.Param("id")); err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List webhook deliveries
+// @Description Shows the delivery log of a webhook, newest first, with every attempt's outcome
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param limit query int false "Page size (max 100)" default(20)
+// @Param offset query int false "Number of deliveries to skip" default(0)
+// @Security BearerAuth
+// @Success 200 {object} dto.WebhookDeliveryList
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks/{id}/deliveries [get]
+func (wc *WebhookController) ListDeliveries(c *gin.Context) {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	deliveries, err := wc.Service.ListDeliveries(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, c.Param("id"), limit, offset)
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewWebhookDeliveryList(deliveries, limit, offset))
+}
+
+// @Summary Redeliver a webhook delivery
+// @Description Queues a delivery to be sent again right away, whatever its status
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request return the original response"
+// @Security BearerAuth
+// @Success 202 {object} dto.WebhookDelivery
+// @Failure 400 {object} utils.ErrorBody
+// @Failure 404 {object} utils.ErrorBody
+// @Failure 409 {object} utils.ErrorBody
+// @Failure 422 {object} utils.ErrorBody
+// @Failure 500 {object} utils.ErrorBody
+// @Router /v2/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (wc *WebhookController) Redeliver(c *gin.Context) {
+	delivery, err := wc.Service.Redeliver(c.Request.Context(), middleware.CurrentPrincipal(c).UserID, c.Param("id"), c.Param("delivery_id"))
+	if err != nil {
+		utils.RespondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.NewWebhookDelivery(delivery))
+}
@@ -0,0 +1,73 @@
+package dto
+
+import (
+	"video-service/services"
+)
+
+// APIKeyRequest creates an API key for a server-to-server client
+type APIKeyRequest struct {
+	OwnerID string   `json:"owner_id" binding:"required" example:"partner-42"`
+	Name    string   `json:"name" binding:"required" example:"Nightly ingest"`
+	Scopes  []string `json:"scopes" binding:"required" example:"videos:upload"`
+}
+
+// RotateAPIKeyRequest replaces an API key's secret
+type RotateAPIKeyRequest struct {
+	// How long the old secret keeps working. 0 revokes it at once.
+	GracePeriodSeconds int64 `json:"grace_period_seconds" minimum:"0" example:"86400"`
+}
+
+// APIKey describes an API key. Key is only returned when it is created or
+// rotated.
+type APIKey struct {
+	ID                string   `json:"id"`
+	OwnerID           string   `json:"owner_id"`
+	Name              string   `json:"name"`
+	Prefix            string   `json:"prefix" example:"vsk_1a2b3c4d"`
+	Scopes            []string `json:"scopes"`
+	CreatedAt         string   `json:"created_at" format:"date-time"`
+	CreatedBy         string   `json:"created_by"`
+	LastUsedAt        *string  `json:"last_used_at" format:"date-time"`
+	RotatedAt         *string  `json:"rotated_at" format:"date-time"`
+	PreviousExpiresAt *string  `json:"previous_expires_at" format:"date-time"`
+	RevokedAt         *string  `json:"revoked_at" format:"date-time"`
+	Key               string   `json:"key,omitempty"`
+}
+
+// APIKeyList is a page of API keys, oldest first
+type APIKeyList struct {
+	APIKeys []APIKey `json:"api_keys"`
+	Limit   int64    `json:"limit"`
+	Offset  int64    `json:"offset"`
+}
+
+// Settings converts the request to service settings
+func (r APIKeyRequest) Settings() services.APIKeySettings {
+	return services.APIKeySettings{OwnerID: r.OwnerID, Name: r.Name, Scopes: r.Scopes}
+}
+
+// NewAPIKey converts a stored key, leaving out its secret
+func NewAPIKey(k *services.APIKey) APIKey {
+	return APIKey{
+		ID:                k.ID.Hex(),
+		OwnerID:           k.OwnerID,
+		Name:              k.Name,
+		Prefix:            k.Prefix,
+		Scopes:            k.Scopes,
+		CreatedAt:         formatTime(k.CreatedAt),
+		CreatedBy:         k.CreatedBy,
+		LastUsedAt:        formatOptionalTime(k.LastUsedAt),
+		RotatedAt:         formatOptionalTime(k.RotatedAt),
+		PreviousExpiresAt: formatOptionalTime(k.PreviousExpiresAt),
+		RevokedAt:         formatOptionalTime(k.RevokedAt),
+	}
+}
+
+// NewAPIKeyList converts a page of stored keys
+func NewAPIKeyList(keys []services.APIKey, limit, offset int64) APIKeyList {
+	list := APIKeyList{APIKeys: make([]APIKey, 0, len(keys)), Limit: limit, Offset: offset}
+	for i := range keys {
+		list.APIKeys = append(list.APIKeys, NewAPIKey(&keys[i]))
+	}
+	return list
+}
@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"video-service/services"
+)
+
+// Liveness reports that the process is up
+type Liveness struct {
+	Status string `json:"status" example:"alive"`
+}
+
+// DependencyStatus is the outcome of checking one dependency
+type DependencyStatus struct {
+	Status    string  `json:"status" enums:"up,down"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Readiness reports whether the service can take traffic, and the state of
+// each dependency it relies on. Checks are left out while shutting down.
+type Readiness struct {
+	Status string                      `json:"status" enums:"ready,not_ready,shutting_down"`
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// NewReadiness converts health check results. The service is ready when
+// every check passed.
+func NewReadiness(results []services.HealthResult) Readiness {
+	readiness := Readiness{Status: "ready", Checks: make(map[string]DependencyStatus, len(results))}
+	for _, r := range results {
+		status := DependencyStatus{Status: "up", LatencyMS: float64(r.Latency.Microseconds()) / 1000}
+		if r.Err != nil {
+			status.Status = "down"
+			status.Error = r.Err.Error()
+			readiness.Status = "not_ready"
+		}
+		readiness.Checks[r.Name] = status
+	}
+	return readiness
+}
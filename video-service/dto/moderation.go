@@ -0,0 +1,66 @@
+package dto
+
+import (
+	"video-service/models"
+)
+
+// ModerationLabel is one classifier's finding about a video
+type ModerationLabel struct {
+	Name   string  `json:"name" example:"nudity"`
+	Score  float64 `json:"score" example:"0.72"`
+	Source string  `json:"source" example:"http"`
+}
+
+// ModerationPreview holds short-lived links to a video's files, which stay
+// private until it is approved
+type ModerationPreview struct {
+	VideoURL     string `json:"video_url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// ModerationItem is a video awaiting moderation
+type ModerationItem struct {
+	Video      Video             `json:"video"`
+	Labels     []ModerationLabel `json:"labels"`
+	Rule       string            `json:"rule,omitempty" example:"*>=0.5:review"`
+	Reason     string            `json:"reason,omitempty" example:"nudity scored 0.72 from http"`
+	Error      string            `json:"error,omitempty"`
+	Attempts   int               `json:"attempts"`
+	ReviewedBy string            `json:"reviewed_by,omitempty"`
+	QueuedAt   string            `json:"queued_at" format:"date-time"`
+	DecidedAt  *string           `json:"decided_at" format:"date-time"`
+	Preview    ModerationPreview `json:"preview"`
+}
+
+// ModerationQueue is a page of videos awaiting moderation, oldest first
+type ModerationQueue struct {
+	Items  []ModerationItem `json:"items"`
+	Limit  int64            `json:"limit"`
+	Offset int64            `json:"offset"`
+}
+
+// ModerationDecisionRequest records why a moderator approved or rejected a
+// video. A reason is required to reject.
+type ModerationDecisionRequest struct {
+	Reason string `json:"reason" example:"Graphic violence"`
+}
+
+// NewModerationItem converts a video awaiting moderation
+func NewModerationItem(m *models.VideoMetadata, preview ModerationPreview) ModerationItem {
+	item := ModerationItem{Video: NewVideo(m), Labels: []ModerationLabel{}, Preview: preview}
+	state := m.Moderation
+	if state == nil {
+		return item
+	}
+	for _, label := range state.Labels {
+		item.Labels = append(item.Labels, ModerationLabel{Name: label.Name, Score: label.Score, Source: label.Source})
+	}
+	item.Rule = state.Rule
+	item.Reason = state.Reason
+	item.Error = state.Error
+	item.Attempts = state.Attempts
+	item.ReviewedBy = state.ReviewedBy
+	item.QueuedAt = formatTime(state.QueuedAt)
+	item.DecidedAt = formatOptionalTime(state.DecidedAt)
+	return item
+}
@@ -0,0 +1,244 @@
+package dto
+
+import (
+	"time"
+	"video-service/models"
+	"video-service/services"
+)
+
+// Video is the v2 representation of a video's metadata
+type Video struct {
+	ID              string          `json:"id" example:"6571f0c2a1b2c3d4e5f60718"`
+	OwnerID         string          `json:"owner_id"`
+	Title           string          `json:"title"`
+	Tags            []string        `json:"tags"`
+	DurationSeconds int             `json:"duration_seconds"`
+	URL             string          `json:"url"`
+	ThumbnailURL    string          `json:"thumbnail_url"`
+	ThumbnailType   string          `json:"thumbnail_type"`
+	ContentType     string          `json:"content_type" example:"video/mp4"`
+	SizeBytes       int64           `json:"size_bytes"`
+	Visibility      string          `json:"visibility" enums:"public,unlisted,private,password_protected"`
+	Availability    string          `json:"availability" enums:"scheduled,live,expired"`
+	PublishAt       *string         `json:"publish_at" format:"date-time"`
+	ExpireAt        *string         `json:"expire_at" format:"date-time"`
+	UploadedAt      string          `json:"uploaded_at" format:"date-time"`
+	DeletedAt       *string         `json:"deleted_at,omitempty" format:"date-time"`
+	Status          string          `json:"status" enums:"importing,processing,moderating,in_review,ready,failed,rejected"`
+	Import          *ImportProgress `json:"import,omitempty"`
+	Rejection       *VideoRejection `json:"rejection,omitempty"`
+}
+
+// ImportProgress reports on a video imported from a URL
+type ImportProgress struct {
+	SourceURL       string `json:"source_url"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	BytesTotal      int64  `json:"bytes_total,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// VideoRejection explains why a video's file was refused
+type VideoRejection struct {
+	Reason     string `json:"reason"`
+	RejectedAt string `json:"rejected_at" format:"date-time"`
+}
+
+// VideoList is a page of videos
+type VideoList struct {
+	Videos []Video `json:"videos"`
+	Limit  int64   `json:"limit"`
+	Offset int64   `json:"offset"`
+}
+
+// BatchGetRequest names the videos to look up in one call
+type BatchGetRequest struct {
+	IDs []string `json:"ids" binding:"required" maxItems:"100"`
+}
+
+// BatchGetResponse holds the videos found, in request order, and the IDs that
+// are malformed, unknown or not visible to the caller
+type BatchGetResponse struct {
+	Videos     []Video  `json:"videos"`
+	MissingIDs []string `json:"missing_ids"`
+}
+
+// Usage is a user's upload consumption against their quotas. Limits of 0 are unlimited.
+type Usage struct {
+	StorageBytes     int64 `json:"storage_bytes"`
+	StorageLimit     int64 `json:"storage_limit"`
+	UploadsToday     int   `json:"uploads_today"`
+	DailyUploadLimit int   `json:"daily_upload_limit"`
+	MaxFileSize      int64 `json:"max_file_size"`
+}
+
+// AccessToken unlocks a password-protected video
+type AccessToken struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresInSeconds int    `json:"expires_in_seconds"`
+}
+
+// VisibilityRequest changes who can find and watch a video
+type VisibilityRequest struct {
+	Visibility   string   `json:"visibility" binding:"required" enums:"public,unlisted,private,password_protected"`
+	AllowedUsers []string `json:"allowed_users"`
+	Password     string   `json:"password"`
+}
+
+// ScheduleRequest sets a video's publishing window. Null means immediately / never.
+type ScheduleRequest struct {
+	PublishAt *time.Time `json:"publish_at" format:"date-time"`
+	ExpireAt  *time.Time `json:"expire_at" format:"date-time"`
+}
+
+// ImportRequest asks for a video to be downloaded from a URL. Headers, such
+// as Authorization, are sent to the source and never stored.
+type ImportRequest struct {
+	SourceURL    string            `json:"source_url" binding:"required" example:"https://example.com/videos/keynote.mp4"`
+	Headers      map[string]string `json:"headers"`
+	Title        string            `json:"title"`
+	Tags         []string          `json:"tags"`
+	Visibility   string            `json:"visibility" enums:"public,unlisted,private,password_protected"`
+	AllowedUsers []string          `json:"allowed_users"`
+	Password     string            `json:"password"`
+	PublishAt    *time.Time        `json:"publish_at" format:"date-time"`
+	ExpireAt     *time.Time        `json:"expire_at" format:"date-time"`
+}
+
+// AccessRequest exchanges a video password for an access token
+type AccessRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// NewVideo converts stored metadata to its v2 representation
+func NewVideo(m *models.VideoMetadata) Video {
+	tags := m.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	availability := m.Availability
+	if availability == "" {
+		availability = models.AvailabilityLive
+	}
+
+	return Video{
+		ID:              m.ID.Hex(),
+		OwnerID:         m.OwnerID,
+		Title:           m.Title,
+		Tags:            tags,
+		DurationSeconds: m.Duration,
+		URL:             m.URL,
+		ThumbnailURL:    m.Thumbnail,
+		ThumbnailType:   m.ThumbnailType,
+		ContentType:     m.ContentType,
+		SizeBytes:       m.Size,
+		Visibility:      string(m.EffectiveVisibility()),
+		Availability:    string(availability),
+		PublishAt:       formatOptionalTime(m.PublishAt),
+		ExpireAt:        formatOptionalTime(m.ExpireAt),
+		UploadedAt:      formatTime(m.UploadedAt),
+		DeletedAt:       formatOptionalTime(m.DeletedAt),
+		Status:          string(m.EffectiveStatus()),
+		Import:          newImportProgress(m.Import),
+		Rejection:       newVideoRejection(m.Rejection),
+	}
+}
+
+func newImportProgress(state *models.ImportState) *ImportProgress {
+	if state == nil {
+		return nil
+	}
+	return &ImportProgress{
+		SourceURL:       state.SourceURL,
+		BytesDownloaded: state.BytesDownloaded,
+		BytesTotal:      state.BytesTotal,
+		Error:           state.Error,
+	}
+}
+
+// newVideoRejection leaves out the signature and quarantine key, which are
+// for operators
+func newVideoRejection(rejection *models.Rejection) *VideoRejection {
+	if rejection == nil {
+		return nil
+	}
+	return &VideoRejection{Reason: rejection.Reason, RejectedAt: formatTime(rejection.RejectedAt)}
+}
+
+// NewVideoList converts a page of stored metadata
+func NewVideoList(videos []models.VideoMetadata, limit, offset int64) VideoList {
+	list := VideoList{Videos: make([]Video, 0, len(videos)), Limit: limit, Offset: offset}
+	for i := range videos {
+		list.Videos = append(list.Videos, NewVideo(&videos[i]))
+	}
+	return list
+}
+
+// NewBatchGetResponse converts the result of a batch lookup
+func NewBatchGetResponse(videos []models.VideoMetadata, missingIDs []string) BatchGetResponse {
+	resp := BatchGetResponse{Videos: NewVideoList(videos, 0, 0).Videos, MissingIDs: missingIDs}
+	if resp.MissingIDs == nil {
+		resp.MissingIDs = []string{}
+	}
+	return resp
+}
+
+// NewUsage combines tracked usage with the configured limits
+func NewUsage(usage *services.Usage, limits services.QuotaLimits) Usage {
+	return Usage{
+		StorageBytes:     usage.StorageBytes,
+		StorageLimit:     limits.UserStorageBytes,
+		UploadsToday:     usage.DayCount,
+		DailyUploadLimit: limits.UserDailyUploads,
+		MaxFileSize:      limits.MaxFileSize,
+	}
+}
+
+// Settings converts the request to service settings
+func (r VisibilityRequest) Settings() services.VisibilitySettings {
+	return services.VisibilitySettings{
+		Visibility:   models.Visibility(r.Visibility),
+		AllowedUsers: r.AllowedUsers,
+		Password:     r.Password,
+	}
+}
+
+// Request converts the request to a service import request for ownerID.
+// Visibility defaults to public.
+func (r ImportRequest) Request(ownerID string) services.ImportRequest {
+	visibility := models.Visibility(r.Visibility)
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	return services.ImportRequest{
+		SourceURL: r.SourceURL,
+		Headers:   r.Headers,
+		Details: services.VideoDetails{
+			OwnerID: ownerID,
+			Title:   r.Title,
+			Tags:    r.Tags,
+			Visibility: services.VisibilitySettings{
+				Visibility:   visibility,
+				AllowedUsers: r.AllowedUsers,
+				Password:     r.Password,
+			},
+			Schedule: services.ScheduleSettings{PublishAt: r.PublishAt, ExpireAt: r.ExpireAt},
+		},
+	}
+}
+
+// Settings converts the request to service settings
+func (r ScheduleRequest) Settings() services.ScheduleSettings {
+	return services.ScheduleSettings{PublishAt: r.PublishAt, ExpireAt: r.ExpireAt}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := formatTime(*t)
+	return &s
+}
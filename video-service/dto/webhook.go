@@ -0,0 +1,130 @@
+package dto
+
+import (
+	"video-service/services"
+)
+
+// WebhookRequest creates or updates a webhook subscription
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required" example:"https://partner.example.com/hooks/videos"`
+	Events []string `json:"events" example:"video.uploaded"`
+	// Only used on update. Setting it re-enables a disabled webhook.
+	Active *bool `json:"active,omitempty"`
+}
+
+// Webhook is a webhook subscription. Secret is only returned on creation.
+type Webhook struct {
+	ID                  string   `json:"id"`
+	URL                 string   `json:"url"`
+	Events              []string `json:"events"`
+	Active              bool     `json:"active"`
+	ConsecutiveFailures int      `json:"consecutive_failures"`
+	DisabledAt          *string  `json:"disabled_at" format:"date-time"`
+	CreatedAt           string   `json:"created_at" format:"date-time"`
+	Secret              string   `json:"secret,omitempty"`
+}
+
+// WebhookList holds a user's webhooks
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// WebhookAttempt is one try at delivering a webhook
+type WebhookAttempt struct {
+	At         string `json:"at" format:"date-time"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID            string           `json:"id"`
+	EventID       string           `json:"event_id"`
+	EventType     string           `json:"event_type"`
+	VideoID       string           `json:"video_id"`
+	Status        string           `json:"status" enums:"pending,succeeded,failed"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt *string          `json:"next_attempt_at" format:"date-time"`
+	DeliveredAt   *string          `json:"delivered_at" format:"date-time"`
+	CreatedAt     string           `json:"created_at" format:"date-time"`
+	AttemptLog    []WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookDeliveryList is a page of deliveries, newest first
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Limit      int64             `json:"limit"`
+	Offset     int64             `json:"offset"`
+}
+
+// Settings converts the request to service settings
+func (r WebhookRequest) Settings() services.WebhookSettings {
+	events := make([]services.EventType, 0, len(r.Events))
+	for _, e := range r.Events {
+		events = append(events, services.EventType(e))
+	}
+	return services.WebhookSettings{URL: r.URL, Events: events}
+}
+
+// NewWebhook converts a stored subscription, leaving out its secret
+func NewWebhook(s *services.WebhookSubscription) Webhook {
+	events := make([]string, 0, len(s.Events))
+	for _, e := range s.Events {
+		events = append(events, string(e))
+	}
+	return Webhook{
+		ID:                  s.ID.Hex(),
+		URL:                 s.URL,
+		Events:              events,
+		Active:              s.Active,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		DisabledAt:          formatOptionalTime(s.DisabledAt),
+		CreatedAt:           formatTime(s.CreatedAt),
+	}
+}
+
+// NewWebhookList converts stored subscriptions
+func NewWebhookList(subs []services.WebhookSubscription) WebhookList {
+	list := WebhookList{Webhooks: make([]Webhook, 0, len(subs))}
+	for i := range subs {
+		list.Webhooks = append(list.Webhooks, NewWebhook(&subs[i]))
+	}
+	return list
+}
+
+// NewWebhookDelivery converts a stored delivery
+func NewWebhookDelivery(d *services.WebhookDelivery) WebhookDelivery {
+	out := WebhookDelivery{
+		ID:          d.ID.Hex(),
+		EventID:     d.EventID,
+		EventType:   string(d.EventType),
+		VideoID:     d.VideoID,
+		Status:      string(d.Status),
+		Attempts:    d.Attempts,
+		DeliveredAt: formatOptionalTime(d.DeliveredAt),
+		CreatedAt:   formatTime(d.CreatedAt),
+		AttemptLog:  make([]WebhookAttempt, 0, len(d.AttemptLog)),
+	}
+	if d.Status == services.DeliveryPending {
+		out.NextAttemptAt = formatOptionalTime(&d.NextAttemptAt)
+	}
+	for _, a := range d.AttemptLog {
+		out.AttemptLog = append(out.AttemptLog, WebhookAttempt{
+			At:         formatTime(a.At),
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			DurationMS: a.DurationMS,
+		})
+	}
+	return out
+}
+
+// NewWebhookDeliveryList converts a page of stored deliveries
+func NewWebhookDeliveryList(deliveries []services.WebhookDelivery, limit, offset int64) WebhookDeliveryList {
+	list := WebhookDeliveryList{Deliveries: make([]WebhookDelivery, 0, len(deliveries)), Limit: limit, Offset: offset}
+	for i := range deliveries {
+		list.Deliveries = append(list.Deliveries, NewWebhookDelivery(&deliveries[i]))
+	}
+	return list
+}
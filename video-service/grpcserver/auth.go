@@ -0,0 +1,90 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/middleware"
+	"video-service/proto/videopb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type principalKey struct{}
+
+// servicePrefix selects the methods that require authentication, leaving the
+// health and reflection services open to probes and tooling
+var servicePrefix = "/" + videopb.VideoService_ServiceDesc.ServiceName + "/"
+
+// authenticate resolves the bearer token in the call metadata and checks
+// that the caller holds videos:view
+func authenticate(ctx context.Context, authenticator *middleware.JWTAuthenticator, policy *middleware.Policy) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, toStatus(ctx, apperrors.Unauthenticated("Missing bearer token"))
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return nil, toStatus(ctx, apperrors.Unauthenticated("Missing bearer token"))
+	}
+
+	principal, err := authenticator.ParseToken(token)
+	if err != nil {
+		return nil, toStatus(ctx, apperrors.Unauthenticated("Invalid credentials"))
+	}
+	if !policy.Allows(principal, middleware.PermView) {
+		return nil, toStatus(ctx, apperrors.PermissionDenied(fmt.Sprintf("Missing permission: %s", middleware.PermView)))
+	}
+
+	ctx = logging.With(ctx, slog.String("user_id", principal.UserID))
+	return context.WithValue(ctx, principalKey{}, principal), nil
+}
+
+func unaryAuthInterceptor(authenticator *middleware.JWTAuthenticator, policy *middleware.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, servicePrefix) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, authenticator, policy)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuthInterceptor(authenticator *middleware.JWTAuthenticator, policy *middleware.Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !strings.HasPrefix(info.FullMethod, servicePrefix) {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), authenticator, policy)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedStream carries the principal in the stream's context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// principalFromContext returns the principal resolved by the auth interceptors
+func principalFromContext(ctx context.Context) *middleware.Principal {
+	if p, ok := ctx.Value(principalKey{}).(*middleware.Principal); ok {
+		return p
+	}
+	return &middleware.Principal{Roles: []string{middleware.RoleAnonymous}}
+}
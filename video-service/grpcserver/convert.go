@@ -0,0 +1,97 @@
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/models"
+	"video-service/proto/videopb"
+	"video-service/services"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toProtoVideo(m *models.VideoMetadata) *videopb.Video {
+	availability := m.Availability
+	if availability == "" {
+		availability = models.AvailabilityLive
+	}
+
+	return &videopb.Video{
+		Id:              m.ID.Hex(),
+		OwnerId:         m.OwnerID,
+		Title:           m.Title,
+		Tags:            m.Tags,
+		DurationSeconds: int64(m.Duration),
+		Url:             m.URL,
+		ThumbnailUrl:    m.Thumbnail,
+		ThumbnailType:   m.ThumbnailType,
+		ContentType:     m.ContentType,
+		SizeBytes:       m.Size,
+		Visibility:      string(m.EffectiveVisibility()),
+		Availability:    string(availability),
+		PublishAt:       optionalTimestamp(m.PublishAt),
+		ExpireAt:        optionalTimestamp(m.ExpireAt),
+		UploadedAt:      timestamppb.New(m.UploadedAt),
+	}
+}
+
+func toProtoEvent(event services.VideoEvent) *videopb.VideoEvent {
+	return &videopb.VideoEvent{
+		Id:         event.ID,
+		Type:       string(event.Type),
+		VideoId:    event.VideoID,
+		OwnerId:    event.OwnerID,
+		Sequence:   event.Sequence,
+		OccurredAt: timestamppb.New(event.OccurredAt),
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// grpcCodes maps domain error codes to their gRPC equivalents
+var grpcCodes = map[apperrors.Code]codes.Code{
+	apperrors.CodeInvalidArgument:  codes.InvalidArgument,
+	apperrors.CodeNotFound:         codes.NotFound,
+	apperrors.CodeConflict:         codes.AlreadyExists,
+	apperrors.CodeUnsupported:      codes.InvalidArgument,
+	apperrors.CodeUnavailable:      codes.Unavailable,
+	apperrors.CodeUnauthenticated:  codes.Unauthenticated,
+	apperrors.CodePermissionDenied: codes.PermissionDenied,
+	apperrors.CodePayloadTooLarge:  codes.ResourceExhausted,
+	apperrors.CodeQuotaExceeded:    codes.ResourceExhausted,
+	apperrors.CodeUnprocessable:    codes.FailedPrecondition,
+	apperrors.CodeRateLimited:      codes.ResourceExhausted,
+}
+
+// toStatus converts an error to a gRPC status, hiding the cause of internal
+// errors from the caller as the HTTP API does
+func toStatus(ctx context.Context, err error) error {
+	appErr, ok := apperrors.As(err)
+	if !ok {
+		slog.ErrorContext(ctx, "Internal error", logging.Err(err))
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	code, ok := grpcCodes[appErr.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	attrs := []any{slog.String("code", string(appErr.Code)), logging.Err(err)}
+	switch {
+	case apperrors.HTTPStatus(appErr.Code) >= http.StatusInternalServerError:
+		slog.ErrorContext(ctx, "Call failed", attrs...)
+	case appErr.Err != nil:
+		slog.WarnContext(ctx, "Call failed", attrs...)
+	}
+	return status.Error(code, appErr.Message)
+}
@@ -0,0 +1,179 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"video-service/apperrors"
+	"video-service/middleware"
+	"video-service/models"
+	"video-service/proto/videopb"
+	"video-service/services"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// eventBuffer is how many events a slow StreamVideoEvents client may lag
+// behind before events are dropped for it
+const eventBuffer = 64
+
+// Server implements videopb.VideoServiceServer on top of services.VideoService
+type Server struct {
+	videopb.UnimplementedVideoServiceServer
+	Service *services.VideoService
+	Events  *services.EventHub
+	Policy  *middleware.Policy
+	Health  *health.Server // Set by NewGRPCServer
+}
+
+// NewServer initializes a new Server
+func NewServer(service *services.VideoService, events *services.EventHub, policy *middleware.Policy) *Server {
+	return &Server{Service: service, Events: events, Policy: policy}
+}
+
+// NewGRPCServer builds a gRPC server exposing the video service together with
+// the standard health and reflection services. Calls to the video service
+// must carry a bearer token in the authorization metadata.
+func NewGRPCServer(server *Server, authenticator *middleware.JWTAuthenticator) *grpc.Server {
+	// The stats handler continues the caller's trace from the request metadata
+	s := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unaryAuthInterceptor(authenticator, server.Policy)),
+		grpc.ChainStreamInterceptor(streamAuthInterceptor(authenticator, server.Policy)),
+	)
+	videopb.RegisterVideoServiceServer(s, server)
+
+	server.Health = health.NewServer()
+	server.Health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	server.Health.SetServingStatus(videopb.VideoService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, server.Health)
+
+	reflection.Register(s)
+	return s
+}
+
+// Drain reports NOT_SERVING to health checks from now on, like the HTTP
+// readiness endpoint once the shutdown gate closes, so load balancers stop
+// sending calls here
+func (s *Server) Drain() {
+	if s.Health != nil {
+		s.Health.Shutdown()
+	}
+}
+
+func (s *Server) GetVideo(ctx context.Context, req *videopb.GetVideoRequest) (*videopb.Video, error) {
+	metadata, err := s.Service.GetVideoMetadata(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	// Videos the caller may not see are indistinguishable from missing ones
+	if !s.canView(principalFromContext(ctx), metadata) {
+		return nil, toStatus(ctx, apperrors.NotFound("Video not found").WithDetail("id", req.GetId()))
+	}
+	if err := s.Service.SignMediaLinks(ctx, metadata); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toProtoVideo(metadata), nil
+}
+
+func (s *Server) BatchGetVideos(ctx context.Context, req *videopb.BatchGetVideosRequest) (*videopb.BatchGetVideosResponse, error) {
+	principal := principalFromContext(ctx)
+	found, missing, err := s.Service.GetVideosByIDs(ctx, req.GetIds(), func(metadata *models.VideoMetadata) bool {
+		return s.canView(principal, metadata)
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	resp := &videopb.BatchGetVideosResponse{MissingIds: missing}
+	for i := range found {
+		if err := s.Service.SignMediaLinks(ctx, &found[i]); err != nil {
+			return nil, toStatus(ctx, err)
+		}
+		resp.Videos = append(resp.Videos, toProtoVideo(&found[i]))
+	}
+	return resp, nil
+}
+
+func (s *Server) ListVideos(ctx context.Context, req *videopb.ListVideosRequest) (*videopb.ListVideosResponse, error) {
+	limit := req.GetLimit()
+	if limit == 0 {
+		limit = 20
+	}
+	if limit < 1 || limit > 100 {
+		return nil, toStatus(ctx, apperrors.InvalidArgument("limit must be between 1 and 100"))
+	}
+	if req.GetOffset() < 0 {
+		return nil, toStatus(ctx, apperrors.InvalidArgument("offset must be a non-negative integer"))
+	}
+
+	videos, err := s.Service.ListVideos(ctx, req.GetQuery(), req.GetTag(), limit, req.GetOffset())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	resp := &videopb.ListVideosResponse{Limit: limit, Offset: req.GetOffset()}
+	for i := range videos {
+		resp.Videos = append(resp.Videos, toProtoVideo(&videos[i]))
+	}
+	return resp, nil
+}
+
+// StreamVideoEvents sends the events of every video, whoever may see it, so
+// it is reserved to callers holding events:stream
+func (s *Server) StreamVideoEvents(req *videopb.StreamVideoEventsRequest, stream grpc.ServerStreamingServer[videopb.VideoEvent]) error {
+	ctx := stream.Context()
+	if !s.Policy.Allows(principalFromContext(ctx), middleware.PermStreamEvents) {
+		return toStatus(ctx, apperrors.PermissionDenied(fmt.Sprintf("Missing permission: %s", middleware.PermStreamEvents)))
+	}
+
+	types := toSet(req.GetTypes())
+	videoIDs := toSet(req.GetVideoIds())
+
+	events, unsubscribe := s.Events.Subscribe(eventBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return toStatus(ctx, apperrors.Unavailable("Server is shutting down"))
+			}
+			if !matches(types, string(event.Type)) || !matches(videoIDs, event.VideoID) {
+				continue
+			}
+			if err := stream.Send(toProtoEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// canView applies the HTTP API's viewing rules. Password-protected videos
+// have no access-token flow over gRPC, so only privileged callers see them.
+func (s *Server) canView(principal *middleware.Principal, metadata *models.VideoMetadata) bool {
+	return metadata.AccessAt(models.Viewer{
+		UserID:     principal.UserID,
+		Privileged: s.Policy.Allows(principal, middleware.PermViewPrivate),
+	}, time.Now()) == models.AccessGranted
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// matches reports whether value passes a filter; an empty filter passes all
+func matches(filter map[string]bool, value string) bool {
+	return len(filter) == 0 || filter[value]
+}
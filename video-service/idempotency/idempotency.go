@@ -0,0 +1,26 @@
+// Package idempotency defines the storage contract for Idempotency-Key
+// handling, shared by the middleware that enforces keys and the services
+// that persist them
+package idempotency
+
+import "context"
+
+// Record is the state of a key that is already in use
+type Record struct {
+	Fingerprint string
+	Completed   bool
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store persists idempotency keys and the responses they produced
+type Store interface {
+	// Begin claims key for a request. It returns nil if the caller now holds
+	// the key, or the existing record if another request already used it.
+	Begin(ctx context.Context, key, fingerprint string) (*Record, error)
+	// Complete stores the response of the request holding key
+	Complete(ctx context.Context, key string, status int, contentType string, body []byte) error
+	// Release frees key without a response so the request can be retried
+	Release(ctx context.Context, key string) error
+}
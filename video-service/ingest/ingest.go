@@ -0,0 +1,436 @@
+// Package ingest uploads directories of video files in bulk, reading their
+// metadata from sidecar files, skipping files whose contents were already
+// ingested, and keeping a ledger so an interrupted run can resume
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/models"
+	"video-service/services"
+	"video-service/utils"
+)
+
+// Result is the outcome of one file
+type Result struct {
+	Path    string `json:"path"`
+	Status  Status `json:"status"`
+	VideoID string `json:"video_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Summary counts the outcomes of a run
+type Summary struct {
+	Ingested   int `json:"ingested"`
+	Duplicates int `json:"duplicates"`
+	Rejected   int `json:"rejected"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+// Ingester feeds the video files of a directory through the video service
+type Ingester struct {
+	Videos      *services.VideoService
+	Quotas      *services.QuotaService
+	Ledger      *Ledger
+	OwnerID     string // Owner of videos whose sidecar names none
+	Concurrency int    // Files processed at once
+	// OnResult, if set, is called after each file from the worker that handled it
+	OnResult func(Result)
+
+	mu       sync.Mutex
+	summary  Summary
+	inFlight map[string]bool          // Paths being processed
+	hashes   map[string]chan struct{} // Hashes being processed, closed when done
+}
+
+// NewIngester initializes a new Ingester
+func NewIngester(videos *services.VideoService, quotas *services.QuotaService, ledger *Ledger, ownerID string, concurrency int) *Ingester {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Ingester{
+		Videos:      videos,
+		Quotas:      quotas,
+		Ledger:      ledger,
+		OwnerID:     ownerID,
+		Concurrency: concurrency,
+		inFlight:    map[string]bool{},
+		hashes:      map[string]chan struct{}{},
+	}
+}
+
+// Scan ingests every video file under root once. It stops early, leaving
+// the rest for the next run, if ctx is cancelled.
+func (in *Ingester) Scan(ctx context.Context, root string) (Summary, error) {
+	jobs := make(chan string)
+	wait := in.startWorkers(ctx, root, jobs)
+
+	err := walkVideos(root, func(path string) error {
+		select {
+		case jobs <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wait()
+
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return in.Summary(), err
+}
+
+// Summary returns the outcomes so far
+func (in *Ingester) Summary() Summary {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.summary
+}
+
+// startWorkers processes the paths sent on jobs until it is closed. The
+// returned function waits for the workers to finish.
+func (in *Ingester) startWorkers(ctx context.Context, root string, jobs <-chan string) func() {
+	var wg sync.WaitGroup
+	for i := 0; i < in.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				result := in.process(ctx, root, path)
+				if result == nil {
+					continue
+				}
+				in.count(result.Status)
+				if in.OnResult != nil {
+					in.OnResult(*result)
+				}
+			}
+		}()
+	}
+	return wg.Wait
+}
+
+func (in *Ingester) count(status Status) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	switch status {
+	case StatusIngested:
+		in.summary.Ingested++
+	case StatusDuplicate:
+		in.summary.Duplicates++
+	case StatusRejected:
+		in.summary.Rejected++
+	case StatusSkipped:
+		in.summary.Skipped++
+	case StatusFailed:
+		in.summary.Failed++
+	}
+}
+
+// claim marks path as being processed, reporting false if it already was
+func (in *Ingester) claim(path string) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.inFlight[path] {
+		return false
+	}
+	in.inFlight[path] = true
+	return true
+}
+
+func (in *Ingester) unclaim(path string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delete(in.inFlight, path)
+}
+
+// lockHash waits until no other worker is processing a file with the given
+// hash, so that a second copy is checked only once the first is stored
+func (in *Ingester) lockHash(ctx context.Context, hash string) (func(), error) {
+	for {
+		in.mu.Lock()
+		busy, ok := in.hashes[hash]
+		if !ok {
+			done := make(chan struct{})
+			in.hashes[hash] = done
+			in.mu.Unlock()
+			return func() {
+				in.mu.Lock()
+				delete(in.hashes, hash)
+				in.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		in.mu.Unlock()
+
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// process ingests one file and records the outcome in the ledger. It returns
+// nil if the file is already being processed or ctx was cancelled, in which
+// case nothing is recorded and the next run tries again.
+func (in *Ingester) process(ctx context.Context, root, path string) *Result {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	if !in.claim(rel) {
+		return nil
+	}
+	defer in.unclaim(rel)
+	ctx = logging.With(ctx, slog.String("path", rel))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return in.fail(ctx, LedgerEntry{Path: rel}, err)
+	}
+	entry := LedgerEntry{Path: rel, Size: info.Size(), ModTime: info.ModTime()}
+	if in.Ledger.Done(rel, info) {
+		return &Result{Path: rel, Status: StatusSkipped}
+	}
+
+	details, err := in.details(path)
+	if err != nil {
+		return in.fail(ctx, entry, err)
+	}
+	if entry.Hash, err = hashFile(path); err != nil {
+		return in.fail(ctx, entry, err)
+	}
+	details.ContentHash = entry.Hash
+
+	// Files with the same contents are only uploaded once, whichever
+	// path or run they come from
+	unlock, err := in.lockHash(ctx, entry.Hash)
+	if err != nil {
+		return nil
+	}
+	defer unlock()
+	if id, ok := in.Ledger.VideoForHash(entry.Hash); ok {
+		return in.duplicate(ctx, entry, id)
+	}
+	existing, err := in.Videos.FindVideoByContentHash(ctx, entry.Hash)
+	if err == nil && existing.Status == models.StatusRejected {
+		return in.reject(ctx, entry, existing.ID.Hex(), rejectionError(existing))
+	}
+	if err == nil {
+		return in.duplicate(ctx, entry, existing.ID.Hex())
+	}
+	if apperrors.CodeOf(err) != apperrors.CodeNotFound {
+		return in.fail(ctx, entry, err)
+	}
+
+	metadata, err := in.upload(ctx, path, info.Size(), details)
+	if _, ok := services.AsInfected(err); ok && metadata != nil {
+		return in.reject(ctx, entry, metadata.ID.Hex(), err)
+	}
+	if err != nil {
+		return in.fail(ctx, entry, err)
+	}
+	entry.Status = StatusIngested
+	entry.VideoID = metadata.ID.Hex()
+	if err := in.record(entry); err != nil {
+		slog.ErrorContext(ctx, "Ingested video but could not record it", slog.String("video_id", entry.VideoID), logging.Err(err))
+	}
+	slog.InfoContext(ctx, "Ingested video", slog.String("video_id", entry.VideoID))
+	return &Result{Path: rel, Status: StatusIngested, VideoID: entry.VideoID}
+}
+
+// details builds the metadata of the video at path from its sidecar
+func (in *Ingester) details(path string) (services.VideoDetails, error) {
+	sidecar, err := readSidecar(path)
+	if err != nil {
+		return services.VideoDetails{}, err
+	}
+
+	details := services.VideoDetails{
+		OwnerID: sidecar.OwnerID,
+		Title:   sidecar.Title,
+		Tags:    sidecar.Tags,
+		Visibility: services.VisibilitySettings{
+			Visibility:   sidecar.Visibility,
+			AllowedUsers: sidecar.AllowedUsers,
+			Password:     sidecar.Password,
+		},
+		Schedule: services.ScheduleSettings{PublishAt: sidecar.PublishAt, ExpireAt: sidecar.ExpireAt},
+	}
+	if details.OwnerID == "" {
+		details.OwnerID = in.OwnerID
+	}
+	if details.OwnerID == "" {
+		return details, apperrors.InvalidArgument("No owner: set owner_id in the sidecar or give a default owner")
+	}
+	if details.Title == "" {
+		name := filepath.Base(path)
+		details.Title = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if details.Visibility.Visibility == "" {
+		details.Visibility.Visibility = models.VisibilityPublic
+	}
+	if err := details.Visibility.Validate(); err != nil {
+		return details, err
+	}
+	return details, details.Schedule.Validate()
+}
+
+// upload stores the file and its metadata, counting it against the owner's
+// quota like an API upload. A file the scanner finds malware in is saved as
+// a rejected video, returned along with the *services.InfectedError.
+func (in *Ingester) upload(ctx context.Context, path string, size int64, details services.VideoDetails) (*models.VideoMetadata, error) {
+	if maxSize := in.Quotas.Limits.MaxFileSize; maxSize > 0 && size > maxSize {
+		return nil, utils.ErrFileTooLarge
+	}
+	if err := in.Quotas.Reserve(ctx, details.OwnerID, size); err != nil {
+		return nil, err
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			in.Quotas.Release(context.WithoutCancel(ctx), details.OwnerID, size)
+		}
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	contentType := utils.VideoContentTypeByExtension(path)
+	// Files in different folders often share a name, so each gets its own key
+	videoURL, duration, err := in.Videos.ProcessAndUploadVideo(ctx, services.NewObjectKey(details.OwnerID, path), contentType, file)
+	if infected, ok := services.AsInfected(err); ok {
+		metadata, saveErr := in.Videos.SaveRejectedVideo(ctx, details, contentType, infected)
+		if saveErr != nil {
+			return nil, saveErr
+		}
+		return &metadata, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := in.Videos.CreateAndSaveMetadata(ctx, details, duration, size, videoURL, "", "", contentType)
+	if err != nil {
+		in.Videos.RemoveFiles(ctx, videoURL)
+		return nil, err
+	}
+	saved = true
+	return &metadata, nil
+}
+
+func (in *Ingester) duplicate(ctx context.Context, entry LedgerEntry, videoID string) *Result {
+	entry.Status = StatusDuplicate
+	entry.VideoID = videoID
+	if err := in.record(entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to record duplicate", logging.Err(err))
+	}
+	slog.InfoContext(ctx, "Skipped duplicate video", slog.String("video_id", videoID))
+	return &Result{Path: entry.Path, Status: StatusDuplicate, VideoID: videoID}
+}
+
+// reject records a file containing malware, or refused by moderation, which
+// is not retried. Copies of a rejected file are rejected without being
+// uploaded again.
+func (in *Ingester) reject(ctx context.Context, entry LedgerEntry, videoID string, err error) *Result {
+	entry.Status = StatusRejected
+	entry.VideoID = videoID
+	entry.Error = err.Error()
+	if recordErr := in.record(entry); recordErr != nil {
+		slog.ErrorContext(ctx, "Failed to record rejection", logging.Err(recordErr))
+	}
+	slog.WarnContext(ctx, "Rejected video", slog.String("video_id", videoID), logging.Err(err))
+	return &Result{Path: entry.Path, Status: StatusRejected, VideoID: videoID, Error: entry.Error}
+}
+
+// rejectionError explains why an existing video was rejected: malware, or a
+// moderation decision
+func rejectionError(video *models.VideoMetadata) error {
+	if video.Rejection == nil || video.Rejection.Signature != "" {
+		return services.ErrMalwareDetected
+	}
+	return apperrors.Unprocessable(video.Rejection.Reason)
+}
+
+// fail records a failed file so it is retried, unless the failure was
+// caused by cancellation, in which case nothing is recorded
+func (in *Ingester) fail(ctx context.Context, entry LedgerEntry, err error) *Result {
+	if ctx.Err() != nil {
+		return nil
+	}
+	entry.Status = StatusFailed
+	entry.Error = err.Error()
+	if recordErr := in.record(entry); recordErr != nil {
+		slog.ErrorContext(ctx, "Failed to record failure", logging.Err(recordErr))
+	}
+	slog.ErrorContext(ctx, "Failed to ingest video", logging.Err(err))
+	return &Result{Path: entry.Path, Status: StatusFailed, Error: err.Error()}
+}
+
+func (in *Ingester) record(entry LedgerEntry) error {
+	entry.At = time.Now()
+	return in.Ledger.Record(entry)
+}
+
+// hashFile returns the hex SHA-256 of the file at path
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isCandidate reports whether a file name is a supported video. Hidden
+// files, such as the ledger and partial copies, are ignored.
+func isCandidate(name string) bool {
+	return !strings.HasPrefix(name, ".") && utils.VideoContentTypeByExtension(name) != ""
+}
+
+// walkVideos calls fn with the path of every candidate file under root,
+// skipping hidden directories
+func walkVideos(root string, fn func(path string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && isCandidate(d.Name()) {
+			return fn(path)
+		}
+		return nil
+	})
+}
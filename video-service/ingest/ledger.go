@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of ingesting a file
+type Status string
+
+const (
+	StatusIngested  Status = "ingested"  // Uploaded and saved as a new video
+	StatusDuplicate Status = "duplicate" // Same contents as an existing video
+	StatusRejected  Status = "rejected"  // Malware was found or moderation refused it; not retried
+	StatusSkipped   Status = "skipped"   // Already handled by an earlier run; never written to the ledger
+	StatusFailed    Status = "failed"    // Will be retried by the next run
+)
+
+// LedgerEntry records what happened to one file. Size and ModTime identify
+// the version of the file that was handled, so a replaced file is ingested
+// again.
+type LedgerEntry struct {
+	Path    string    `json:"path"` // Relative to the ingested directory
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash,omitempty"`
+	Status  Status    `json:"status"`
+	VideoID string    `json:"video_id,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Ledger is an append-only JSON-lines file of LedgerEntry records, which
+// lets an interrupted ingest resume where it stopped. The latest entry for a
+// path wins.
+type Ledger struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]LedgerEntry
+	hashes  map[string]string // Hash to video ID of every ingested file
+}
+
+// OpenLedger reads the ledger at path, creating it if needed, and opens it
+// for appending. A partly written last line, left by a crash, is ignored.
+func OpenLedger(path string) (*Ledger, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+
+	l := &Ledger{file: file, entries: map[string]LedgerEntry{}, hashes: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Path == "" {
+			continue
+		}
+		l.remember(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+
+	// End a partly written line so the next entry starts on its own
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			file.Write([]byte{'\n'})
+		}
+	}
+	return l, nil
+}
+
+// Done reports whether this version of the file at path was already ingested
+// or found to be a duplicate
+func (l *Ledger) Done(path string, info os.FileInfo) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[path]
+	return ok && entry.Status != StatusFailed &&
+		entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime())
+}
+
+// VideoForHash returns the video ingested from a file with the given hash
+func (l *Ledger) VideoForHash(hash string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	id, ok := l.hashes[hash]
+	return id, ok
+}
+
+// Record appends entry and syncs it to disk
+func (l *Ledger) Record(entry LedgerEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	l.remember(entry)
+	return nil
+}
+
+// Close closes the ledger file
+func (l *Ledger) Close() error {
+	return l.file.Close()
+}
+
+func (l *Ledger) remember(entry LedgerEntry) {
+	l.entries[entry.Path] = entry
+	if entry.Status == StatusIngested && entry.Hash != "" {
+		l.hashes[entry.Hash] = entry.VideoID
+	}
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-service/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sidecar holds the metadata of a video file, read from a JSON or YAML file
+// next to it. Every field is optional.
+type Sidecar struct {
+	Title        string            `yaml:"title" json:"title"`
+	Tags         []string          `yaml:"tags" json:"tags"`
+	OwnerID      string            `yaml:"owner_id" json:"owner_id"`
+	Visibility   models.Visibility `yaml:"visibility" json:"visibility"`
+	AllowedUsers []string          `yaml:"allowed_users" json:"allowed_users"`
+	Password     string            `yaml:"password" json:"password"`
+	PublishAt    *time.Time        `yaml:"publish_at" json:"publish_at"`
+	ExpireAt     *time.Time        `yaml:"expire_at" json:"expire_at"`
+}
+
+// sidecarExtensions are tried in order, first after the full file name
+// (clip.mp4.json) and then in place of the video's extension (clip.json)
+var sidecarExtensions = []string{".json", ".yaml", ".yml"}
+
+// readSidecar returns the sidecar of the video at path, or an empty one if
+// there is none. JSON sidecars are read as YAML, of which JSON is a subset.
+func readSidecar(path string) (Sidecar, error) {
+	var sidecar Sidecar
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, prefix := range []string{path, base} {
+		for _, ext := range sidecarExtensions {
+			data, err := os.ReadFile(prefix + ext)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return sidecar, fmt.Errorf("failed to read sidecar: %w", err)
+			}
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			if err := decoder.Decode(&sidecar); err != nil && !errors.Is(err, io.EOF) {
+				return sidecar, fmt.Errorf("invalid sidecar %s: %w", filepath.Base(prefix+ext), err)
+			}
+			return sidecar, nil
+		}
+	}
+	return sidecar, nil
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"video-service/logging"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch ingests every video file under root, then keeps watching root and
+// its subdirectories with inotify and ingests files as they appear, until
+// ctx is cancelled. A file is picked up once it has not changed for settle,
+// so files still being copied are not ingested half-written. Sidecars should
+// be copied before their videos.
+func (in *Ingester) Watch(ctx context.Context, root string, settle time.Duration) (Summary, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return in.Summary(), fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watches are added before listing, so no file can slip in between
+	var queue []string
+	if err := watchTree(watcher, root, &queue); err != nil {
+		return in.Summary(), err
+	}
+
+	jobs := make(chan string)
+	wait := in.startWorkers(ctx, root, jobs)
+	defer wait()
+	defer close(jobs)
+
+	tick := settle / 2
+	if tick <= 0 || tick > time.Second {
+		tick = time.Second
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	pending := map[string]time.Time{} // Last change of files that are not settled yet
+	for {
+		// Only offer a job when there is one, so a busy pool never stops
+		// the watcher from draining events
+		var send chan<- string
+		var next string
+		if len(queue) > 0 {
+			send, next = jobs, queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return in.Summary(), nil
+		case send <- next:
+			queue = queue[1:]
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return in.Summary(), nil
+			}
+			in.handleEvent(ctx, watcher, event, pending, &queue)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return in.Summary(), nil
+			}
+			// Overflowed events are recovered by listing the tree again
+			slog.WarnContext(ctx, "Watch error, rescanning", logging.Err(err))
+			if err := watchTree(watcher, root, &queue); err != nil {
+				slog.ErrorContext(ctx, "Failed to rescan", logging.Err(err))
+			}
+		case now := <-ticker.C:
+			for path, changed := range pending {
+				if now.Sub(changed) >= settle {
+					delete(pending, path)
+					queue = append(queue, path)
+				}
+			}
+		}
+	}
+}
+
+// handleEvent watches new directories and tracks changes to video files
+func (in *Ingester) handleEvent(ctx context.Context, watcher *fsnotify.Watcher, event fsnotify.Event, pending map[string]time.Time, queue *[]string) {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+	name := filepath.Base(event.Name)
+	if strings.HasPrefix(name, ".") {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) {
+			// Files moved in along with the directory produce no events of their own
+			var found []string
+			if err := watchTree(watcher, event.Name, &found); err != nil {
+				slog.ErrorContext(ctx, "Failed to watch directory", slog.String("dir", event.Name), logging.Err(err))
+			}
+			for _, path := range found {
+				pending[path] = time.Now()
+			}
+		}
+		return
+	}
+	if info.Mode().IsRegular() && isCandidate(name) {
+		pending[event.Name] = time.Now()
+	}
+}
+
+// watchTree watches root and its non-hidden subdirectories and appends the
+// video files found in them to queue
+func watchTree(watcher *fsnotify.Watcher, root string, queue *[]string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && isCandidate(d.Name()) {
+			*queue = append(*queue, path)
+		}
+		return nil
+	})
+}
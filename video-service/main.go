@@ -2,13 +2,34 @@ package main
 
 import (
     "context"
-    "log"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+    "video-service/broker"
+    "video-service/config"
     "video-service/controllers"
+    "video-service/grpcserver"
+    "video-service/logging"
+    "video-service/metrics"
+    "video-service/middleware"
+    "video-service/moderation"
+    "video-service/ratelimit"
     "video-service/routes"
     "video-service/services"
+    "video-service/tracing"
     "video-service/utils"
 
     "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
     "github.com/swaggo/gin-swagger"
     "github.com/swaggo/files"
     _"video-service/docs"
@@ -20,35 +41,412 @@ import (
 // @version 1.0
 // @description API for video uploads and metadata management
 // @host localhost:8080
-// @BasePath /api/videos
+// @BasePath /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+
+// shutdownGrace is how long aborted work gets to unwind and clean up after
+// the shutdown deadline
+const shutdownGrace = 5 * time.Second
 
 func main() {
+    printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+    flag.Parse()
+
     utils.LoadEnv()
+    cfg, err := config.Load(utils.GetEnv("CONFIG_FILE", ""))
+    if err != nil {
+        fatal("Invalid configuration", err)
+    }
+    if *printConfig {
+        out, err := cfg.YAML()
+        if err != nil {
+            fatal("Failed to print configuration", err)
+        }
+        os.Stdout.Write(out)
+        return
+    }
+    if _, err := logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level); err != nil {
+        fatal("Invalid logging settings", err)
+    }
+    slog.Debug("Loaded configuration", slog.Any("config", cfg.Redacted()))
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+    if err != nil {
+        fatal("Failed to set up tracing", err)
+    }
+
+    // Background loops run until shutdown cancels this context
+    background, stopBackground := context.WithCancel(context.Background())
+    var workers sync.WaitGroup
+    runWorker := func(run func(context.Context)) {
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            run(background)
+        }()
+    }
 
-    clientOptions := options.Client().ApplyURI(utils.GetEnv("MONGO_URI", "mongodb://localhost:27017"))
+    clientOptions := options.Client().
+        ApplyURI(cfg.Database.URI).
+        SetMonitor(tracing.MongoMonitor(metrics.MongoMonitor()))
     client, err := mongo.Connect(context.Background(), clientOptions)
     if err != nil {
-        log.Fatalf("Failed to connect to MongoDB: %v", err)
+        fatal("Failed to connect to MongoDB", err)
+    }
+
+    videoService, err := services.NewVideoService(context.Background(), client.Database(cfg.Database.Name), cfg.Storage.Region, cfg.Storage.Bucket)
+    if err != nil {
+        fatal("Failed to initialize VideoService", err)
+    }
+    videoService.FFprobePath = cfg.Processing.FFprobePath
+    videoService.ScratchDir = cfg.Processing.ScratchDir
+    videoService.Scanner, err = services.NewScanner(cfg.Scanning.Scanner, cfg.Scanning.ClamdAddress, cfg.Scanning.Timeout)
+    if err != nil {
+        fatal("Failed to initialize malware scanner", err)
+    }
+    videoService.QuarantinePrefix = cfg.Scanning.QuarantinePrefix
+    videoService.Moderated = cfg.Moderation.Enabled
+    if err := videoService.EnsureOutboxIndexes(context.Background(), cfg.Events.OutboxRetention); err != nil {
+        fatal("Failed to prepare outbox", err)
+    }
+    if err := videoService.EnsureVideoIndexes(context.Background()); err != nil {
+        fatal("Failed to prepare videos", err)
+    }
+
+    policy, err := middleware.LoadPolicy(cfg.Auth.RBACPolicyFile)
+    if err != nil {
+        fatal("Failed to load RBAC policy", err)
+    }
+    authz := middleware.NewAuthorizer(policy)
+    authenticator := middleware.NewJWTAuthenticator(cfg.Auth.JWTSecret)
+
+    apiKeyService := services.NewAPIKeyService(videoService.DB, middleware.PermissionNames())
+    if err := apiKeyService.EnsureAPIKeyIndexes(context.Background()); err != nil {
+        fatal("Failed to prepare API keys", err)
+    }
+    apiKeyAuthenticator := middleware.NewAPIKeyAuthenticator(apiKeyService, services.APIKeyPrefix)
+    authenticate := middleware.Authenticate(apiKeyAuthenticator, authenticator)
+
+    accessTokens := middleware.NewAccessTokenIssuer(cfg.Auth.JWTSecret, cfg.Auth.AccessTokenTTL)
+
+    quotaService := services.NewQuotaService(videoService.DB, services.QuotaLimits{
+        MaxFileSize:        cfg.Limits.MaxUploadSize,
+        UserStorageBytes:   cfg.Limits.UserStorageQuota,
+        UserDailyUploads:   cfg.Limits.UserDailyUploads,
+        GlobalStorageBytes: cfg.Limits.GlobalStorageQuota,
+    })
+
+    importPolicy, err := services.ParseNetworkPolicy(cfg.Imports.AllowedNetworks)
+    if err != nil {
+        fatal("Invalid import settings", err)
+    }
+    importer := services.NewVideoImporter(videoService, quotaService, importPolicy,
+        importPolicy.NewClient(cfg.Imports.ConnectTimeout, cfg.Imports.IdleTimeout, cfg.Imports.MaxRedirects),
+        services.ImportLimits{
+            Concurrency: cfg.Imports.Concurrency,
+            Timeout:     cfg.Imports.Timeout,
+            IdleTimeout: cfg.Imports.IdleTimeout,
+        })
+    runWorker(importer.Run)
+
+    videoController := controllers.NewVideoController(videoService, quotaService, policy, accessTokens, importer)
+
+    runWorker(services.NewScheduler(videoService, cfg.Events.SchedulerInterval).Run)
+
+    // Outbox events go to the log, to in-process subscribers such as gRPC
+    // event streams, and to the configured broker
+    eventHub := services.NewEventHub()
+    eventBroker, err := newEventBroker(context.Background(), cfg.Events)
+    if err != nil {
+        fatal("Failed to initialize event broker", err)
+    }
+    webhookPolicy, err := services.ParseNetworkPolicy(cfg.Webhooks.AllowedNetworks)
+    if err != nil {
+        fatal("Invalid webhook settings", err)
+    }
+    webhookService := services.NewWebhookService(videoService.DB, webhookPolicy)
+    if err := webhookService.EnsureWebhookIndexes(context.Background()); err != nil {
+        fatal("Failed to prepare webhooks", err)
+    }
+    publishers := services.MultiEventPublisher{
+        {Name: "log", Publisher: services.LogEventPublisher{}},
+        {Name: "hub", Publisher: eventHub},
+        {Name: "webhooks", Publisher: webhookService},
+    }
+    if eventBroker != nil {
+        publishers = append(publishers, services.EventTarget{Name: cfg.Events.Broker, Publisher: eventBroker})
+    }
+    outboxRelay := services.NewOutboxRelay(videoService.DB, publishers, cfg.Events.OutboxRelayInterval)
+    runWorker(outboxRelay.Run)
+
+    webhookRetry := services.WebhookRetryPolicy{
+        MaxAttempts:  cfg.Webhooks.MaxAttempts,
+        BaseDelay:    cfg.Webhooks.RetryBaseDelay,
+        MaxDelay:     cfg.Webhooks.RetryMaxDelay,
+        DisableAfter: cfg.Webhooks.DisableAfter,
+    }
+    webhookWorker := services.NewWebhookWorker(videoService.DB, webhookRetry, webhookPolicy, cfg.Webhooks.WorkerInterval)
+    runWorker(webhookWorker.Run)
+
+    queues := map[string]metrics.QueueCounter{
+        "outbox":             outboxRelay.Pending,
+        "webhook_deliveries": webhookWorker.Pending,
+    }
+    if cfg.Moderation.Enabled {
+        moderationWorker, err := newModerationWorker(videoService, cfg)
+        if err != nil {
+            fatal("Invalid moderation settings", err)
+        }
+        runWorker(moderationWorker.Run)
+        queues["moderation"] = moderationWorker.Pending
+        queues["moderation_review"] = moderationWorker.InReview
+    }
+    err = metrics.RegisterQueues(queues)
+    if err != nil {
+        fatal("Failed to register queue metrics", err)
+    }
+
+    grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPCPort))
+    if err != nil {
+        fatal("Failed to listen for gRPC", err)
+    }
+    videoServer := grpcserver.NewServer(videoService, eventHub, policy)
+    grpcServer := grpcserver.NewGRPCServer(videoServer, authenticator)
+    go func() {
+        slog.Info("Starting gRPC server", slog.String("addr", grpcListener.Addr().String()))
+        if err := grpcServer.Serve(grpcListener); err != nil {
+            fatal("gRPC server stopped", err)
+        }
+    }()
+
+    idempotencyService := services.NewIdempotencyService(videoService.DB, cfg.Server.IdempotencyTTL, cfg.Server.IdempotencyLockTimeout)
+    if err := idempotencyService.EnsureIdempotencyIndexes(context.Background()); err != nil {
+        fatal("Failed to prepare idempotency keys", err)
     }
+    idempotency := middleware.IdempotencyKeys(idempotencyService)
 
-    videoService, err := services.NewVideoService(client)
+    rateLimitStore, err := newRateLimitStore(context.Background(), cfg.Limits)
     if err != nil {
-        log.Fatalf("Failed to initialize VideoService: %v", err)
+        fatal("Failed to initialize rate limiting", err)
     }
+    videoLimit := middleware.Limit(rateLimitStore, "videos", cfg.Limits.RateLimitVideos, 0)
+    webhookLimit := middleware.Limit(rateLimitStore, "webhooks", cfg.Limits.RateLimitWebhooks, 0)
+    adminLimit := middleware.Limit(rateLimitStore, "admin", cfg.Limits.RateLimitAdmin, 0)
+    uploadLimit := middleware.Limit(rateLimitStore, "uploads", cfg.Limits.RateLimitUploads, cfg.Limits.MaxConcurrentUploads)
 
-    videoController := controllers.NewVideoController(videoService)
+    shutdownGate := middleware.NewShutdownGate()
 
-    router := gin.Default()
+    router := gin.New()
+    if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+        fatal("Invalid trusted proxies", err)
+    }
+    router.Use(middleware.Metrics(), middleware.RequestID(), middleware.Tracing(), middleware.AccessLog(), middleware.Recovery(), shutdownGate.Track())
 
     // Prefix all video routes with /api/video
-    apiGroup := router.Group("/api/videos")
-    routes.RegisterVideoRoutes(apiGroup, videoController)
+    apiGroup := router.Group("/api/videos", authenticate, videoLimit)
+    routes.RegisterVideoRoutes(apiGroup, videoController, authz, idempotency, shutdownGate.RejectWhenClosing(), uploadLimit)
+
+    v2Group := router.Group("/api/v2/videos", authenticate, videoLimit)
+    routes.RegisterVideoRoutesV2(v2Group, videoController, authz, idempotency, shutdownGate.RejectWhenClosing(), uploadLimit)
+
+    webhookController := controllers.NewWebhookController(webhookService)
+    webhookGroup := router.Group("/api/v2/webhooks", authenticate, webhookLimit)
+    routes.RegisterWebhookRoutes(webhookGroup, webhookController, authz, idempotency)
+
+    moderationController := controllers.NewModerationController(videoService)
+    moderationGroup := router.Group("/api/v2/moderation", authenticate, adminLimit)
+    routes.RegisterModerationRoutes(moderationGroup, moderationController, authz, idempotency)
+
+    apiKeyController := controllers.NewAPIKeyController(apiKeyService)
+    apiKeyGroup := router.Group("/api/v2/admin/api-keys", authenticate, adminLimit)
+    routes.RegisterAPIKeyRoutes(apiKeyGroup, apiKeyController, authz)
+
+    healthService := newHealthService(client, videoService, cfg)
+    routes.RegisterHealthRoutes(router, controllers.NewHealthController(healthService, shutdownGate))
+
+    router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
     // Swagger docs route
     router.GET("/api/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-    log.Println("Starting server on port 8080...")
-    if err := router.Run(":8080"); err != nil {
-        log.Fatalf("Failed to start server: %v", err)
+    server := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.HTTPPort), Handler: router, ReadHeaderTimeout: 10 * time.Second}
+    go func() {
+        slog.Info("Starting HTTP server", slog.String("addr", server.Addr))
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            fatal("Failed to start server", err)
+        }
+    }()
+
+    <-ctx.Done()
+    stop() // A second signal kills the process at once
+    slog.Info("Shutting down, waiting for in-flight work", slog.Duration("timeout", cfg.Server.ShutdownTimeout))
+
+    // Refuse new uploads right away, and give load balancers time to stop
+    // sending traffic here before connections are refused
+    shutdownGate.Close()
+    videoServer.Drain()
+    time.Sleep(cfg.Server.ShutdownDelay)
+
+    deadline, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+    defer cancel()
+
+    // Event streams never finish on their own, so they are ended first
+    eventHub.Close()
+    grpcStopped := make(chan struct{})
+    go func() {
+        grpcServer.GracefulStop()
+        close(grpcStopped)
+    }()
+    if err := server.Shutdown(deadline); err != nil {
+        slog.Warn("Aborting HTTP requests still running at the deadline", logging.Err(err))
+        server.Close()
+    }
+    select {
+    case <-grpcStopped:
+    case <-deadline.Done():
+        slog.Warn("Aborting gRPC calls still running at the deadline")
+        grpcServer.Stop()
+    }
+
+    // Background loops are stopped once no request can create more work for
+    // them. An interrupted tick is picked up again by another replica or on
+    // the next start: claims expire and transactions roll back.
+    stopBackground()
+    if !waitUntil(deadline, &workers) {
+        slog.Warn("Background work still running at the deadline")
+    }
+
+    // Aborted requests unwind once their connections are closed; give them a
+    // moment, then remove whatever temporary files they left behind
+    grace, cancelGrace := context.WithTimeout(context.Background(), shutdownGrace)
+    defer cancelGrace()
+    if err := shutdownGate.Wait(grace); err != nil {
+        slog.Warn("Requests still running after the shutdown grace period")
+    }
+    if removed := utils.RemoveTemporaryFiles(); removed > 0 {
+        slog.Info("Removed temporary files left by aborted uploads", slog.Int("count", removed))
+    }
+
+    for _, resource := range []interface{}{eventBroker, rateLimitStore} {
+        if closer, ok := resource.(io.Closer); ok {
+            if err := closer.Close(); err != nil {
+                slog.Error("Failed to close resource", slog.String("resource", fmt.Sprintf("%T", resource)), logging.Err(err))
+            }
+        }
+    }
+    disconnect, cancelDisconnect := context.WithTimeout(context.Background(), shutdownGrace)
+    defer cancelDisconnect()
+    if err := client.Disconnect(disconnect); err != nil {
+        slog.Error("Failed to disconnect from MongoDB", logging.Err(err))
+    }
+    flush, cancelFlush := context.WithTimeout(context.Background(), shutdownGrace)
+    defer cancelFlush()
+    if err := shutdownTracing(flush); err != nil {
+        slog.Error("Failed to flush traces", logging.Err(err))
+    }
+    slog.Info("Shutdown complete")
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+    slog.Error(msg, logging.Err(err))
+    os.Exit(1)
+}
+
+// waitUntil waits for wg until ctx is done, reporting whether wg finished.
+// Once ctx is done it still allows shutdownGrace for work that is stopping.
+func waitUntil(ctx context.Context, wg *sync.WaitGroup) bool {
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return true
+    case <-ctx.Done():
+    }
+    select {
+    case <-done:
+        return true
+    case <-time.After(shutdownGrace):
+        return false
+    }
+}
+
+// newEventBroker connects to the configured broker. The default, memory,
+// keeps events in process and returns no external publisher.
+func newEventBroker(ctx context.Context, cfg config.EventsConfig) (services.EventPublisher, error) {
+    switch cfg.Broker {
+    case "memory":
+        return nil, nil
+    case "nats":
+        return broker.NewNATSPublisher(ctx, cfg.NATSURL, cfg.NATSStream, cfg.NATSSubjectPrefix)
+    case "kafka":
+        return broker.NewKafkaPublisher(cfg.KafkaBrokers, cfg.KafkaTopic)
+    default:
+        return nil, fmt.Errorf("unknown event broker %q", cfg.Broker)
+    }
+}
+
+// newHealthService sets up the readiness checks: MongoDB, the S3 bucket, the
+// configured media tools, free space in the directory uploads are staged in
+// and clamd, if uploads are scanned
+func newHealthService(client *mongo.Client, videoService *services.VideoService, cfg *config.Config) *services.HealthService {
+    scratchDir := cfg.Processing.ScratchDir
+    if scratchDir == "" {
+        scratchDir = os.TempDir()
+    }
+    checks := []services.HealthCheck{
+        services.MongoHealthCheck(client),
+        services.BucketHealthCheck(videoService.S3Client, videoService.Bucket),
+        services.DiskSpaceHealthCheck(scratchDir, uint64(cfg.Processing.MinScratchSpace)),
+    }
+    // Check the tools the service will actually run
+    checks = append(checks, services.BinaryHealthCheck("ffprobe", cfg.Processing.FFprobePath))
+    if cfg.Moderation.Enabled && cfg.Moderation.Frames > 0 {
+        checks = append(checks, services.BinaryHealthCheck("ffmpeg", cfg.Processing.FFmpegPath))
+    }
+    if clamd, ok := videoService.Scanner.(*services.ClamAVScanner); ok {
+        checks = append(checks, services.ClamAVHealthCheck(clamd))
+    }
+    return services.NewHealthService(cfg.Health.CheckTimeout, checks...)
+}
+
+// newRateLimitStore builds the configured backend. The default, memory,
+// limits each replica separately.
+func newRateLimitStore(ctx context.Context, cfg config.LimitsConfig) (ratelimit.Store, error) {
+    switch cfg.RateLimitBackend {
+    case "memory":
+        return ratelimit.NewMemoryStore(), nil
+    case "redis":
+        return ratelimit.NewRedisStore(ctx, cfg.RedisURL)
+    default:
+        return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimitBackend)
+    }
+}
+
+// newModerationWorker builds the classifiers and rules named in the
+// moderation settings
+func newModerationWorker(videoService *services.VideoService, cfg *config.Config) (*services.ModerationWorker, error) {
+    mc := cfg.Moderation
+    classifiers, err := services.NewClassifiers(mc.Classifiers, mc.BlockedTerms, mc.ClassifierURL, mc.ClassifierTimeout)
+    if err != nil {
+        return nil, err
+    }
+    rules, err := moderation.ParseRules(mc.Rules)
+    if err != nil {
+        return nil, err
     }
+    worker := services.NewModerationWorker(videoService, classifiers, rules, mc.Interval)
+    worker.FFmpegPath = cfg.Processing.FFmpegPath
+    worker.Frames = mc.Frames
+    worker.MaxAttempts = mc.MaxAttempts
+    worker.Timeout = mc.Timeout
+    return worker, nil
 }
@@ -0,0 +1,176 @@
+// Package metrics defines the Prometheus metrics exported on /metrics and
+// small helpers to record them
+package metrics
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "video_service"
+
+// Result labels
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+var (
+	// HTTPRequests counts finished requests by route template and status
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration measures request latency by route template and status
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestsInFlight counts requests being served
+	HTTPRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	// UploadBytes measures the size of stored uploads
+	UploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes",
+		Help:      "Bytes stored per successful upload, video and thumbnail included.",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 4, 10), // 1 MiB to 256 GiB
+	})
+
+	// UploadDuration measures how long uploads take end to end, by result
+	UploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Time to receive, store and record an upload, by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12), // 0.5s to ~17m
+	}, []string{"result"})
+
+	// StorageDuration measures object storage calls by operation and result
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "S3 call latency, by operation and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"operation", "result"})
+
+	// MongoDuration measures MongoDB commands by command name and result
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency, by command and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command", "result"})
+
+	// MediaToolDuration measures ffprobe and ffmpeg runs by tool and exit code
+	MediaToolDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "media_tool_duration_seconds",
+		Help:      "Run time of ffprobe and ffmpeg, by tool and exit code. An exit code of -1 means the tool could not be started or was killed.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"tool", "exit_code"})
+
+	// ScanDuration measures malware scans of uploads by verdict
+	ScanDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "malware_scan_duration_seconds",
+		Help:      "Time to scan an upload for malware, by result: clean, infected or error.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"result"})
+
+	// ModerationDecisions counts videos leaving moderation
+	ModerationDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "moderation_decisions_total",
+		Help:      "Moderation decisions, by decision: approved, rejected or review, and by who made them: rules or moderator.",
+	}, []string{"decision", "by"})
+
+	// JobTickDuration measures one pass of a background worker
+	JobTickDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_tick_duration_seconds",
+		Help:      "Time spent in one pass of a background worker, by worker and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"worker", "result"})
+
+	// JobBusySeconds accumulates the time background workers spend working.
+	// Its rate is the worker's utilization.
+	JobBusySeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_busy_seconds_total",
+		Help:      "Time background workers spent working rather than waiting. rate() of it is the worker's utilization.",
+	}, []string{"worker"})
+)
+
+// Result is the result label for err
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
+
+// ObserveStorage records an object storage call that started at start
+func ObserveStorage(operation string, start time.Time, err error) {
+	StorageDuration.WithLabelValues(operation, Result(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveMediaTool records a run of tool that started at start and ended
+// with err, as returned by exec.Cmd
+func ObserveMediaTool(tool string, start time.Time, err error) {
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	MediaToolDuration.WithLabelValues(tool, strconv.Itoa(exitCode)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveScan records a malware scan that started at start
+func ObserveScan(start time.Time, infected bool, err error) {
+	result := "clean"
+	switch {
+	case err != nil:
+		result = ResultError
+	case infected:
+		result = "infected"
+	}
+	ScanDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveJobTick records one pass of worker that started at start
+func ObserveJobTick(worker string, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+	JobTickDuration.WithLabelValues(worker, Result(err)).Observe(elapsed)
+	JobBusySeconds.WithLabelValues(worker).Add(elapsed)
+}
+
+// MongoMonitor records the latency and outcome of every MongoDB command
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			MongoDuration.WithLabelValues(e.CommandName, ResultSuccess).Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			MongoDuration.WithLabelValues(e.CommandName, ResultError).Observe(e.Duration.Seconds())
+		},
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"video-service/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queueDepthTimeout bounds the queries run for one scrape
+const queueDepthTimeout = 2 * time.Second
+
+var queueDepthDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "job", "queue_depth"),
+	"Items waiting to be processed, by queue.",
+	[]string{"queue"}, nil,
+)
+
+// QueueCounter counts the items waiting in a queue
+type QueueCounter func(ctx context.Context) (int64, error)
+
+// QueueDepthCollector reports the depth of job queues, counted at scrape time
+// so the value is always current
+type QueueDepthCollector struct {
+	Queues map[string]QueueCounter
+}
+
+// RegisterQueues exports the depth of each queue
+func RegisterQueues(queues map[string]QueueCounter) error {
+	return prometheus.Register(&QueueDepthCollector{Queues: queues})
+}
+
+func (c *QueueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+}
+
+func (c *QueueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueDepthTimeout)
+	defer cancel()
+
+	for name, count := range c.Queues {
+		depth, err := count(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to count queue", slog.String("queue", name), logging.Err(err))
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth), name)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const videoAccessAudience = "video-access"
+
+// AccessTokenIssuer issues short-lived tokens that unlock a single
+// password-protected video
+type AccessTokenIssuer struct {
+	Secret []byte
+	TTL    time.Duration
+}
+
+// NewAccessTokenIssuer initializes a new AccessTokenIssuer
+func NewAccessTokenIssuer(secret string, ttl time.Duration) *AccessTokenIssuer {
+	return &AccessTokenIssuer{Secret: []byte(secret), TTL: ttl}
+}
+
+// Issue returns a signed access token for videoID
+func (i *AccessTokenIssuer) Issue(videoID string) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   videoID,
+		Audience:  jwt.ClaimStrings{videoAccessAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(i.TTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.Secret)
+}
+
+// Verify reports whether token is a valid, unexpired access token for videoID
+func (i *AccessTokenIssuer) Verify(token, videoID string) bool {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return i.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(videoAccessAudience),
+		jwt.WithSubject(videoID),
+		jwt.WithExpirationRequired(),
+	)
+	return err == nil
+}
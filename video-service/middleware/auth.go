@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/services"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const principalKey = "principal"
+
+// RoleAnonymous is assigned to requests that carry no credentials
+const RoleAnonymous = "anonymous"
+
+// ErrNoCredentials is returned by an Authenticator when the request does not
+// carry credentials it understands, so the next Authenticator can be tried
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID string
+	Roles  []string
+	Scopes []string
+	// APIKeyID is set when the caller authenticated with an API key, which
+	// acts for UserID with only its Scopes
+	APIKeyID string
+}
+
+// IsAnonymous reports whether the principal carries no identity
+func (p *Principal) IsAnonymous() bool {
+	return p.UserID == ""
+}
+
+// Authenticator resolves the principal of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// JWTAuthenticator validates HS256 bearer tokens issued by the user service
+type JWTAuthenticator struct {
+	Secret []byte
+}
+
+type videoClaims struct {
+	Roles []string `json:"roles"`
+	Scope string   `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// NewJWTAuthenticator initializes a new JWTAuthenticator
+func NewJWTAuthenticator(secret string) *JWTAuthenticator {
+	return &JWTAuthenticator{Secret: []byte(secret)}
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrNoCredentials
+	}
+	return a.ParseToken(token)
+}
+
+// ParseToken verifies a raw bearer token, for transports other than HTTP
+func (a *JWTAuthenticator) ParseToken(token string) (*Principal, error) {
+	var claims videoClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return a.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	for _, aud := range claims.Audience {
+		if aud == videoAccessAudience {
+			return nil, errors.New("video access tokens cannot authenticate users")
+		}
+	}
+
+	return &Principal{
+		UserID: claims.Subject,
+		Roles:  claims.Roles,
+		Scopes: strings.Fields(claims.Scope),
+	}, nil
+}
+
+// APIKeyAuthenticator accepts API keys sent as "Authorization: Bearer <key>".
+// It only claims bearer tokens with the API key prefix, leaving JWTs to
+// JWTAuthenticator.
+type APIKeyAuthenticator struct {
+	Resolver services.APIKeyResolver
+	Prefix   string
+}
+
+// NewAPIKeyAuthenticator initializes a new APIKeyAuthenticator
+func NewAPIKeyAuthenticator(resolver services.APIKeyResolver, prefix string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Resolver: resolver, Prefix: prefix}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(token, a.Prefix) {
+		return nil, ErrNoCredentials
+	}
+	key, err := a.Resolver.ResolveAPIKey(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	// The key acts for its owner with only its scopes
+	return &Principal{UserID: key.OwnerID, Scopes: key.Scopes, APIKeyID: key.ID.Hex()}, nil
+}
+
+// Authenticate resolves the request principal using the given authenticators in
+// order. Requests without credentials continue as the anonymous role, while
+// invalid credentials are rejected with 401. Errors that carry another code,
+// such as an unreachable key store, are reported as they are.
+func Authenticate(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range authenticators {
+			principal, err := a.Authenticate(c.Request)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if appErr, ok := apperrors.As(err); ok && appErr.Code != apperrors.CodeUnauthenticated {
+				utils.RespondWithError(c, err)
+				return
+			}
+			if err != nil {
+				utils.RespondWithError(c, apperrors.Unauthenticated("Invalid credentials"))
+				return
+			}
+			c.Set(principalKey, principal)
+			c.Request = c.Request.WithContext(logging.With(c.Request.Context(), principal.logAttrs()...))
+			c.Next()
+			return
+		}
+
+		c.Set(principalKey, &Principal{Roles: []string{RoleAnonymous}})
+		c.Next()
+	}
+}
+
+// logAttrs identifies the principal in log lines
+func (p *Principal) logAttrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("user_id", p.UserID)}
+	if p.APIKeyID != "" {
+		attrs = append(attrs, slog.String("api_key_id", p.APIKeyID))
+	}
+	return attrs
+}
+
+// CurrentPrincipal returns the principal resolved by Authenticate
+func CurrentPrincipal(c *gin.Context) *Principal {
+	if p, ok := c.Get(principalKey); ok {
+		return p.(*Principal)
+	}
+	return &Principal{Roles: []string{RoleAnonymous}}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"video-service/apperrors"
+	"video-service/idempotency"
+	"video-service/logging"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a retryable request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxFingerprintBody caps the non-multipart bodies hashed into a
+	// fingerprint. Larger bodies are fingerprinted by length only.
+	maxFingerprintBody = 1 << 20
+)
+
+// IdempotencyKeys makes a route safe to retry. A request carrying an
+// Idempotency-Key header runs once per caller and key: a retry with the same
+// request gets the original response back, a retry while the first attempt
+// is still running gets 409 and a different request reusing the key gets 422.
+// Server errors release the key so the request can be retried. Requests
+// without the header are not affected.
+func IdempotencyKeys(store idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.RespondWithError(c, apperrors.InvalidArgument("Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		fingerprint, err := requestFingerprint(c.Request)
+		if err != nil {
+			utils.RespondWithError(c, apperrors.Wrap(apperrors.CodeInvalidArgument, err, "Failed to read request body"))
+			return
+		}
+
+		storeKey := idempotencyStoreKey(CurrentPrincipal(c), c.Request, key)
+		existing, err := store.Begin(c.Request.Context(), storeKey, fingerprint)
+		if err != nil {
+			utils.RespondWithError(c, err)
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				utils.RespondWithError(c, apperrors.Unprocessable("Idempotency-Key was already used for a different request"))
+			case !existing.Completed:
+				utils.RespondWithError(c, apperrors.Conflict("A request with this Idempotency-Key is still in progress"))
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The key outlives the request, so it is settled even if the client
+		// has gone away
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.Release(ctx, storeKey)
+		} else {
+			err = store.Complete(ctx, storeKey, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to settle idempotency key", logging.Err(err))
+		}
+	}
+}
+
+// idempotencyStoreKey scopes key to the caller and route, so clients cannot
+// collide with each other or replay a response on another endpoint
+func idempotencyStoreKey(principal *Principal, r *http.Request, key string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{principal.UserID, r.Method, r.URL.Path, key}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint identifies the content of a request. Small bodies are
+// hashed and put back for the handler; uploads are streamed and cannot be
+// read twice, so they are identified by their declared length.
+func requestFingerprint(r *http.Request) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	io.WriteString(hash, strconv.FormatInt(r.ContentLength, 10)+"\n")
+
+	mediaType := r.Header.Get("Content-Type")
+	if r.Body != nil && !strings.HasPrefix(mediaType, "multipart/") &&
+		r.ContentLength >= 0 && r.ContentLength <= maxFingerprintBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxFingerprintBody+1))
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"video-service/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyStore keeps keys in a map, like the MongoDB store without
+// lock timeouts
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*idempotency.Record
+}
+
+func (s *memoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string) (*idempotency.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[key] = &idempotency.Record{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	record.Completed, record.Status, record.ContentType, record.Body = true, status, contentType, body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memoryIdempotencyStore{records: make(map[string]*idempotency.Record)}
+
+	var (
+		router   *gin.Engine
+		calls    int
+		status   int
+		retryNow func() int // Sends a retry while the handler is running, if set
+		inFlight int
+	)
+	send := func(user, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	router = gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(principalKey, &Principal{UserID: c.GetHeader("X-User")})
+	})
+	router.POST("/videos/:id", IdempotencyKeys(store), func(c *gin.Context) {
+		calls++
+		if retryNow != nil {
+			inFlight = retryNow()
+		}
+		c.JSON(status, gin.H{"call": calls})
+	})
+
+	tests := []struct {
+		name         string
+		user         string
+		path         string
+		key          string
+		body         string
+		status       int  // Status the handler responds with
+		concurrent   bool // Retry the request while it is running
+		wantStatus   int
+		wantBody     string
+		wantCalled   bool
+		wantReplayed bool
+	}{
+		{name: "first request", key: "k1", body: `{"a":1}`, status: 201, wantStatus: 201, wantBody: `{"call":1}`, wantCalled: true},
+		{name: "retry is replayed", key: "k1", body: `{"a":1}`, wantStatus: 201, wantBody: `{"call":1}`, wantReplayed: true},
+		{name: "different body", key: "k1", body: `{"a":2}`, wantStatus: 422},
+		{name: "different path", key: "k1", path: "/videos/2", body: `{"a":1}`, status: 200, wantStatus: 200, wantBody: `{"call":2}`, wantCalled: true},
+		{name: "different caller", key: "k1", user: "other", body: `{"a":1}`, status: 200, wantStatus: 200, wantBody: `{"call":3}`, wantCalled: true},
+		{name: "server error", key: "k2", body: `{}`, status: 503, wantStatus: 503, wantCalled: true},
+		{name: "retry after server error runs again", key: "k2", body: `{}`, status: 201, wantStatus: 201, wantBody: `{"call":5}`, wantCalled: true},
+		{name: "client error is replayed", key: "k3", body: `{}`, status: 400, wantStatus: 400, wantCalled: true},
+		{name: "client error retry", key: "k3", body: `{}`, wantStatus: 400, wantBody: `{"call":6}`, wantReplayed: true},
+		{name: "without a key", body: `{"a":1}`, status: 201, wantStatus: 201, wantBody: `{"call":7}`, wantCalled: true},
+		{name: "without a key again", body: `{"a":1}`, status: 201, wantStatus: 201, wantBody: `{"call":8}`, wantCalled: true},
+		{name: "key too long", key: strings.Repeat("k", 256), body: `{}`, wantStatus: 400},
+		{name: "retry while running", key: "k4", body: `{}`, status: 201, concurrent: true, wantStatus: 201, wantCalled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, path := tt.user, tt.path
+			if user == "" {
+				user = "user"
+			}
+			if path == "" {
+				path = "/videos/1"
+			}
+			retryNow, inFlight = nil, 0
+			if tt.concurrent {
+				retryNow = func() int { return send(user, path, tt.key, tt.body).Code }
+			}
+			status = tt.status
+			before := calls
+
+			recorder := send(user, path, tt.key, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantBody != "" && recorder.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", recorder.Body, tt.wantBody)
+			}
+			if called := calls > before; called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+			if replayed := recorder.Header().Get(IdempotentReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.concurrent && inFlight != http.StatusConflict {
+				t.Errorf("retry while running got %d, want %d", inFlight, http.StatusConflict)
+			}
+		})
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	fingerprint := func(method, target, contentType, body string) string {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		got, err := requestFingerprint(req)
+		if err != nil {
+			t.Fatalf("requestFingerprint() error = %v", err)
+		}
+		return got
+	}
+	base := fingerprint(http.MethodPut, "/videos/1?x=1", "application/json", `{"a":1}`)
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantSame    bool
+	}{
+		{name: "identical", method: http.MethodPut, target: "/videos/1?x=1", contentType: "application/json", body: `{"a":1}`, wantSame: true},
+		{name: "body", method: http.MethodPut, target: "/videos/1?x=1", contentType: "application/json", body: `{"a":2}`},
+		{name: "query", method: http.MethodPut, target: "/videos/1?x=2", contentType: "application/json", body: `{"a":1}`},
+		{name: "method", method: http.MethodPost, target: "/videos/1?x=1", contentType: "application/json", body: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		if same := fingerprint(tt.method, tt.target, tt.contentType, tt.body) == base; same != tt.wantSame {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, same, tt.wantSame)
+		}
+	}
+
+	// Multipart bodies are streamed to the handler, so only their length counts
+	upload := fingerprint(http.MethodPost, "/upload", "multipart/form-data; boundary=x", "--x\r\nfile one\r\n--x--")
+	other := fingerprint(http.MethodPost, "/upload", "multipart/form-data; boundary=x", "--x\r\nfile two\r\n--x--")
+	if upload != other {
+		t.Error("multipart bodies of the same length got different fingerprints")
+	}
+}
+
+func TestRequestFingerprintKeepsBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/videos", strings.NewReader(`{"title":"x"}`))
+	if _, err := requestFingerprint(req); err != nil {
+		t.Fatalf("requestFingerprint() error = %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil || string(body) != `{"title":"x"}` {
+		t.Errorf("body after fingerprinting = %q, %v", body, err)
+	}
+}
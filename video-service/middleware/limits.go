@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitBodySize rejects requests whose body exceeds maxBytes with 413. Bodies
+// that declare a larger Content-Length are refused before anything is read;
+// other bodies are cut off as soon as the limit is crossed while streaming.
+func LimitBodySize(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxBytes {
+			c.Header("Connection", "close")
+			utils.RespondWithError(c, utils.ErrFileTooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
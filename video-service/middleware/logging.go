@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+	"video-service/apperrors"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLog logs one line per request once it has been served. Server errors
+// are logged at error level, client errors at warn and the rest at info.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		// The request's context has gained the user ID if it authenticated
+		slog.LogAttrs(c.Request.Context(), level, "Request served",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response and logs it with
+// its stack trace
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "Handler panicked",
+			slog.Any("panic", recovered),
+			slog.String("stack", string(debug.Stack())))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, utils.ErrorBody{Error: utils.ErrorDetail{
+			Code:      apperrors.CodeInternal,
+			Message:   "Internal server error",
+			RequestID: c.GetString(utils.RequestIDKey),
+		}})
+	})
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+	"video-service/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the count, latency and status of every request, labelled
+// by route template rather than path so IDs do not explode the label set
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
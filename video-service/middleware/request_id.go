@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"log/slog"
+	"video-service/logging"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the request ID in and out of the service
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses the caller's X-Request-ID or generates one, stores it for
+// error responses and log lines and echoes it back in the response headers
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Set(utils.RequestIDKey, id)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), slog.String("request_id", id)))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"video-service/apperrors"
+	"video-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShutdownGate tracks in-flight requests and turns away new long-running
+// ones once the service starts shutting down
+type ShutdownGate struct {
+	closing atomic.Bool
+
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+// NewShutdownGate initializes a new ShutdownGate
+func NewShutdownGate() *ShutdownGate {
+	return &ShutdownGate{}
+}
+
+// Close marks the service as shutting down
+func (g *ShutdownGate) Close() {
+	g.closing.Store(true)
+}
+
+// Closing reports whether Close has been called
+func (g *ShutdownGate) Closing() bool {
+	return g.closing.Load()
+}
+
+// Track counts the requests passing through it, for Wait
+func (g *ShutdownGate) Track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		g.mu.Lock()
+		g.active++
+		g.mu.Unlock()
+
+		defer func() {
+			g.mu.Lock()
+			g.active--
+			if g.active == 0 && g.idle != nil {
+				close(g.idle)
+				g.idle = nil
+			}
+			g.mu.Unlock()
+		}()
+		c.Next()
+	}
+}
+
+// RejectWhenClosing answers 503 once the service is shutting down, for
+// routes such as uploads that could not finish before it stops. The client
+// is told to retry on a new connection, which will reach another replica.
+func (g *ShutdownGate) RejectWhenClosing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g.Closing() {
+			c.Header("Connection", "close")
+			c.Header("Retry-After", "1")
+			utils.RespondWithError(c, apperrors.Unavailable("Service is shutting down"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Wait blocks until no tracked request is in flight or ctx is done
+func (g *ShutdownGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.active == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
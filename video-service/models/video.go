@@ -6,8 +6,90 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Visibility controls who can find and watch a video
+type Visibility string
+
+const (
+	VisibilityPublic            Visibility = "public"             // Listed and viewable by anyone
+	VisibilityUnlisted          Visibility = "unlisted"           // Viewable by anyone with the ID, never listed
+	VisibilityPrivate           Visibility = "private"            // Viewable by the owner and allowed users only
+	VisibilityPasswordProtected Visibility = "password_protected" // Viewable with a password-issued access token
+)
+
+// IsValid reports whether v is one of the known visibility levels
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, VisibilityPasswordProtected:
+		return true
+	}
+	return false
+}
+
+// Availability tracks where a video is in its publishing window
+type Availability string
+
+const (
+	AvailabilityScheduled Availability = "scheduled" // Waiting for PublishAt
+	AvailabilityLive      Availability = "live"      // Published and not yet expired
+	AvailabilityExpired   Availability = "expired"   // Past ExpireAt
+)
+
+// Status tracks whether a video's file is stored and processed
+type Status string
+
+const (
+	StatusImporting  Status = "importing"  // Being downloaded from its source URL
+	StatusProcessing Status = "processing" // Downloaded, being probed
+	StatusModerating Status = "moderating" // Stored, waiting for the moderation classifiers
+	StatusInReview   Status = "in_review"  // Waiting for a moderator's decision
+	StatusReady      Status = "ready"      // Stored and playable
+	StatusFailed     Status = "failed"     // Import failed; see Import.Error
+	StatusRejected   Status = "rejected"   // Malware was found or moderation refused it; see Rejection
+)
+
+// ImportState records the progress of a video imported from a remote URL
+type ImportState struct {
+	SourceURL       string    `bson:"source_url"`            // Source without its query string, which may hold credentials
+	BytesDownloaded int64     `bson:"bytes_downloaded"`      // Bytes read from the source so far
+	BytesTotal      int64     `bson:"bytes_total,omitempty"` // Declared size of the source, if known
+	ReservedBytes   int64     `bson:"reserved_bytes"`        // Quota held for the import, released if it fails
+	Error           string    `bson:"error,omitempty"`       // Why the import failed
+	UpdatedAt       time.Time `bson:"updated_at"`            // Heartbeat of the replica running the import
+}
+
+// Rejection records why an uploaded file was refused
+type Rejection struct {
+	Reason        string    `bson:"reason"`                   // Why the file was refused
+	Signature     string    `bson:"signature,omitempty"`      // Malware the scanner found
+	QuarantineKey string    `bson:"quarantine_key,omitempty"` // Where the file was moved in the bucket
+	RejectedAt    time.Time `bson:"rejected_at"`
+}
+
+// ModerationLabel is a classifier's confidence that a video shows something,
+// such as nudity or violence
+type ModerationLabel struct {
+	Name   string  `bson:"name"`
+	Score  float64 `bson:"score"`  // From 0 to 1
+	Source string  `bson:"source"` // Classifier that produced the label
+}
+
+// ModerationState records how a video was moderated
+type ModerationState struct {
+	Labels       []ModerationLabel `bson:"labels,omitempty"`
+	Rule         string            `bson:"rule,omitempty"`          // Rule that rejected the video or sent it to review
+	Reason       string            `bson:"reason,omitempty"`        // Why the video was queued, approved or rejected
+	ReviewedBy   string            `bson:"reviewed_by,omitempty"`   // Moderator who decided; empty for automatic decisions
+	Attempts     int               `bson:"attempts"`                // Classification attempts so far
+	Error        string            `bson:"error,omitempty"`         // Last classification failure
+	QueuedAt     time.Time         `bson:"queued_at"`               // When the video entered moderation
+	ClaimedUntil *time.Time        `bson:"claimed_until,omitempty"` // Lease of the worker classifying the video
+	ClassifiedAt *time.Time        `bson:"classified_at,omitempty"`
+	DecidedAt    *time.Time        `bson:"decided_at,omitempty"`
+}
+
 type VideoMetadata struct {
 	ID            primitive.ObjectID    `bson:"_id,omitempty"`      // MongoDB ObjectID
+	OwnerID       string    `bson:"owner_id"`          // ID of the uploading user
 	Title         string    `bson:"title"`             // Video title
 	Tags          []string  `bson:"tags"`              // Tags associated with the video
 	Duration      int       `bson:"duration"`          // Video duration in seconds
@@ -16,4 +98,106 @@ type VideoMetadata struct {
 	Thumbnail     string    `bson:"thumbnail"`         // Thumbnail URL
 	ThumbnailType string    `bson:"thumbnail_type"`    // Thumbnail type (image or video)
 	ContentType   string    `bson:"content_type"`      // Video content type (e.g., video/mp4)
+	Size          int64     `bson:"size"`              // Bytes stored for the video and thumbnail
+	Visibility    Visibility `bson:"visibility"`       // Who can find and watch the video
+	AllowedUsers  []string  `bson:"allowed_users"`     // Users granted access to a private video
+	PasswordHash  string    `bson:"password_hash" json:"-"` // Bcrypt hash for password-protected videos
+	PublishAt     *time.Time `bson:"publish_at,omitempty"` // When the video becomes available, if scheduled
+	ExpireAt      *time.Time `bson:"expire_at,omitempty"`  // When the video stops being available, if ever
+	Availability  Availability `bson:"availability"`   // Publishing state maintained by the scheduler
+	DeletedAt     *time.Time `bson:"deleted_at,omitempty"` // When an operator deleted the video; deleted videos are hidden until restored
+	ContentHash   string    `bson:"content_hash,omitempty"` // Hex SHA-256 of the video file, recorded by bulk ingest to skip duplicates
+	Status        Status    `bson:"status,omitempty"`  // Processing state; empty for videos stored before imports existed
+	Import        *ImportState `bson:"import,omitempty"` // Progress of a remote import
+	Rejection     *Rejection `bson:"rejection,omitempty"` // Why the file was refused, for rejected videos
+	Moderation    *ModerationState `bson:"moderation,omitempty"` // Classification and review, when moderation is enabled
+}
+
+// IsAvailableAt reports whether t falls inside the video's publishing window.
+// Read paths check the window directly so they never depend on scheduler lag.
+func (m *VideoMetadata) IsAvailableAt(t time.Time) bool {
+	if m.PublishAt != nil && t.Before(*m.PublishAt) {
+		return false
+	}
+	if m.ExpireAt != nil && !t.Before(*m.ExpireAt) {
+		return false
+	}
+	return true
+}
+
+// EffectiveStatus treats documents stored before statuses existed as ready
+func (m *VideoMetadata) EffectiveStatus() Status {
+	if m.Status == "" {
+		return StatusReady
+	}
+	return m.Status
+}
+
+// EffectiveVisibility treats documents stored before visibility existed as public
+func (m *VideoMetadata) EffectiveVisibility() Visibility {
+	if m.Visibility == "" {
+		return VisibilityPublic
+	}
+	return m.Visibility
+}
+
+// IsOwnedBy reports whether userID uploaded the video
+func (m *VideoMetadata) IsOwnedBy(userID string) bool {
+	return userID != "" && m.OwnerID == userID
+}
+
+// IsAllowedUser reports whether userID was granted access to a private video
+func (m *VideoMetadata) IsAllowedUser(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, u := range m.AllowedUsers {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Access is whether a viewer may watch a video
+type Access int
+
+const (
+	AccessGranted Access = iota
+	AccessDenied
+	AccessNeedsPassword // Password-protected and no valid access token
+)
+
+// Viewer is someone asking to watch a video
+type Viewer struct {
+	UserID     string
+	Privileged bool // Holds videos:view_private
+	Unlocked   bool // Presented a valid access token for this video
+}
+
+// AccessAt applies the viewing rules shared by the HTTP and gRPC APIs at
+// time t. Owners and privileged viewers can always watch; everyone else is
+// subject to the video's status, publishing window and visibility, so videos
+// awaiting moderation stay hidden.
+func (m *VideoMetadata) AccessAt(viewer Viewer, t time.Time) Access {
+	if m.IsOwnedBy(viewer.UserID) || viewer.Privileged {
+		return AccessGranted
+	}
+	if m.EffectiveStatus() != StatusReady || !m.IsAvailableAt(t) {
+		return AccessDenied
+	}
+
+	switch m.EffectiveVisibility() {
+	case VisibilityPrivate:
+		if m.IsAllowedUser(viewer.UserID) {
+			return AccessGranted
+		}
+		return AccessDenied
+	case VisibilityPasswordProtected:
+		if viewer.Unlocked {
+			return AccessGranted
+		}
+		return AccessNeedsPassword
+	}
+	return AccessGranted
 }
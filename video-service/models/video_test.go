@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVideoMetadataAccessAt(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	owner := Viewer{UserID: "owner"}
+	stranger := Viewer{UserID: "stranger"}
+	friend := Viewer{UserID: "friend"}
+	privileged := Viewer{UserID: "moderator", Privileged: true}
+	unlocked := Viewer{Unlocked: true}
+
+	tests := []struct {
+		name     string
+		metadata VideoMetadata
+		viewer   Viewer
+		want     Access
+	}{
+		{name: "public", metadata: VideoMetadata{Visibility: VisibilityPublic}, viewer: stranger, want: AccessGranted},
+		{name: "legacy document is public", metadata: VideoMetadata{}, viewer: Viewer{}, want: AccessGranted},
+		{name: "unlisted", metadata: VideoMetadata{Visibility: VisibilityUnlisted}, viewer: stranger, want: AccessGranted},
+		{name: "private to stranger", metadata: VideoMetadata{Visibility: VisibilityPrivate, AllowedUsers: []string{"friend"}}, viewer: stranger, want: AccessDenied},
+		{name: "private to anonymous", metadata: VideoMetadata{Visibility: VisibilityPrivate}, viewer: Viewer{}, want: AccessDenied},
+		{name: "private to allowed user", metadata: VideoMetadata{Visibility: VisibilityPrivate, AllowedUsers: []string{"friend"}}, viewer: friend, want: AccessGranted},
+		{name: "private to owner", metadata: VideoMetadata{Visibility: VisibilityPrivate}, viewer: owner, want: AccessGranted},
+		{name: "private to privileged", metadata: VideoMetadata{Visibility: VisibilityPrivate}, viewer: privileged, want: AccessGranted},
+		{name: "password without token", metadata: VideoMetadata{Visibility: VisibilityPasswordProtected}, viewer: stranger, want: AccessNeedsPassword},
+		{name: "password with token", metadata: VideoMetadata{Visibility: VisibilityPasswordProtected}, viewer: unlocked, want: AccessGranted},
+		{name: "password to owner", metadata: VideoMetadata{Visibility: VisibilityPasswordProtected}, viewer: owner, want: AccessGranted},
+		{name: "in review", metadata: VideoMetadata{Status: StatusInReview}, viewer: stranger, want: AccessDenied},
+		{name: "in review to owner", metadata: VideoMetadata{Status: StatusInReview}, viewer: owner, want: AccessGranted},
+		{name: "in review with token", metadata: VideoMetadata{Visibility: VisibilityPasswordProtected, Status: StatusInReview}, viewer: unlocked, want: AccessDenied},
+		{name: "scheduled", metadata: VideoMetadata{PublishAt: &future}, viewer: stranger, want: AccessDenied},
+		{name: "scheduled to privileged", metadata: VideoMetadata{PublishAt: &future}, viewer: privileged, want: AccessGranted},
+		{name: "published", metadata: VideoMetadata{PublishAt: &past}, viewer: stranger, want: AccessGranted},
+		{name: "expired", metadata: VideoMetadata{ExpireAt: &past}, viewer: stranger, want: AccessDenied},
+		{name: "expired to owner", metadata: VideoMetadata{ExpireAt: &past}, viewer: owner, want: AccessGranted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.metadata.OwnerID = "owner"
+			if got := tt.metadata.AccessAt(tt.viewer, now); got != tt.want {
+				t.Errorf("AccessAt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package moderation parses moderation rules and applies them to the labels
+// classifiers give a video. Configuration validation and the moderation
+// worker share it, so both accept exactly the same rules.
+package moderation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"video-service/models"
+)
+
+// Action is what a rule does with a video whose labels match it
+type Action string
+
+const (
+	Approve Action = "approve" // Release without review, also when no rule matched
+	Review  Action = "review"  // Queue for a moderator
+	Reject  Action = "reject"  // Refuse without review
+)
+
+// Rule matches a label scored at least MinScore
+type Rule struct {
+	Label    string // Label name, or * for any label
+	MinScore float64
+	Action   Action
+}
+
+// ParseRules parses rules of the form label>=score:action, such
+// as nudity>=0.8:reject, *>=0.5:review or safe>=0.99:approve
+func ParseRules(rules []string) ([]Rule, error) {
+	parsed := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		condition, action, _ := strings.Cut(rule, ":")
+		label, score, found := strings.Cut(condition, ">=")
+		min, err := strconv.ParseFloat(strings.TrimSpace(score), 64)
+		switch {
+		case !found || strings.TrimSpace(label) == "" || err != nil || min < 0 || min > 1:
+			return nil, fmt.Errorf("invalid moderation rule %q: must be label>=score:action with a score from 0 to 1", rule)
+		case Action(action) != Reject && Action(action) != Review && Action(action) != Approve:
+			return nil, fmt.Errorf("invalid moderation rule %q: action must be approve, review or reject", rule)
+		}
+		parsed = append(parsed, Rule{Label: strings.TrimSpace(label), MinScore: min, Action: Action(action)})
+	}
+	return parsed, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s>=%g:%s", r.Label, r.MinScore, r.Action)
+}
+
+// Matches reports whether label triggers the rule
+func (r Rule) Matches(label models.ModerationLabel) bool {
+	return (r.Label == "*" || r.Label == label.Name) && label.Score >= r.MinScore
+}
+
+// Verdict is the outcome of applying the rules to a video's labels
+type Verdict struct {
+	Action Action
+	Rule   string                  // Rule that decided, empty if none matched
+	Label  *models.ModerationLabel // Label that matched it
+}
+
+// Reason describes the verdict for moderators
+func (v Verdict) Reason() string {
+	if v.Label == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s scored %.2f from %s", v.Label.Name, v.Label.Score, v.Label.Source)
+}
+
+// Decide applies rules to labels. Any matching reject rule
+// rejects the video; otherwise any matching approve rule approves it, which
+// lets a confident label overrule review rules; otherwise any matching
+// review rule queues it for a moderator; otherwise it is approved. Among
+// rules with the same action, the first one listed wins.
+func Decide(rules []Rule, labels []models.ModerationLabel) Verdict {
+	var approve, review *Verdict
+	for _, rule := range rules {
+		for i := range labels {
+			if !rule.Matches(labels[i]) {
+				continue
+			}
+			verdict := Verdict{Action: rule.Action, Rule: rule.String(), Label: &labels[i]}
+			switch {
+			case rule.Action == Reject:
+				return verdict
+			case rule.Action == Approve && approve == nil:
+				approve = &verdict
+			case rule.Action == Review && review == nil:
+				review = &verdict
+			}
+		}
+	}
+	switch {
+	case approve != nil:
+		return *approve
+	case review != nil:
+		return *review
+	}
+	return Verdict{Action: Approve}
+}
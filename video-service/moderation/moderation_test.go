@@ -0,0 +1,136 @@
+package moderation
+
+import (
+	"testing"
+	"video-service/models"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    Rule
+		wantErr bool
+	}{
+		{rule: "nudity>=0.8:reject", want: Rule{Label: "nudity", MinScore: 0.8, Action: Reject}},
+		{rule: "*>=0.5:review", want: Rule{Label: "*", MinScore: 0.5, Action: Review}},
+		{rule: "violence>=1: review", wantErr: true}, // Action is not trimmed
+		{rule: " violence >= 1:review", want: Rule{Label: "violence", MinScore: 1, Action: Review}},
+		{rule: "nudity>=0:reject", want: Rule{Label: "nudity", MinScore: 0, Action: Reject}},
+		{rule: "verified>=0.9:approve", want: Rule{Label: "verified", MinScore: 0.9, Action: Approve}},
+		{rule: "nudity>=0.8:publish", wantErr: true},
+		{rule: "nudity>=0.8", wantErr: true},
+		{rule: "nudity>0.8:reject", wantErr: true},
+		{rule: ">=0.8:reject", wantErr: true},
+		{rule: "nudity>=1.5:reject", wantErr: true},
+		{rule: "nudity>=-0.1:reject", wantErr: true},
+		{rule: "nudity>=high:reject", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRules([]string{tt.rule})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRules(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got[0] != tt.want {
+			t.Errorf("ParseRules(%q) = %+v, want %+v", tt.rule, got[0], tt.want)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []string
+		labels     []models.ModerationLabel
+		wantAction Action
+		wantRule   string
+		wantLabel  string
+	}{
+		{
+			name:       "no rules",
+			labels:     []models.ModerationLabel{{Name: "nudity", Score: 1}},
+			wantAction: Approve,
+		},
+		{
+			name:       "nothing matches",
+			rules:      []string{"nudity>=0.8:reject", "violence>=0.5:review"},
+			labels:     []models.ModerationLabel{{Name: "nudity", Score: 0.7}, {Name: "weapons", Score: 0.9}},
+			wantAction: Approve,
+		},
+		{
+			name:       "score at threshold matches",
+			rules:      []string{"nudity>=0.8:reject"},
+			labels:     []models.ModerationLabel{{Name: "nudity", Score: 0.8}},
+			wantAction: Reject,
+			wantRule:   "nudity>=0.8:reject",
+			wantLabel:  "nudity",
+		},
+		{
+			name:       "reject beats earlier review",
+			rules:      []string{"violence>=0.5:review", "nudity>=0.8:reject"},
+			labels:     []models.ModerationLabel{{Name: "violence", Score: 0.9}, {Name: "nudity", Score: 0.9}},
+			wantAction: Reject,
+			wantRule:   "nudity>=0.8:reject",
+			wantLabel:  "nudity",
+		},
+		{
+			name:       "first review rule wins",
+			rules:      []string{"violence>=0.5:review", "*>=0.5:review"},
+			labels:     []models.ModerationLabel{{Name: "weapons", Score: 0.6}, {Name: "violence", Score: 0.6}},
+			wantAction: Review,
+			wantRule:   "violence>=0.5:review",
+			wantLabel:  "violence",
+		},
+		{
+			name:       "approve overrules review",
+			rules:      []string{"*>=0.5:review", "verified>=0.9:approve"},
+			labels:     []models.ModerationLabel{{Name: "violence", Score: 0.6}, {Name: "verified", Score: 0.95}},
+			wantAction: Approve,
+			wantRule:   "verified>=0.9:approve",
+			wantLabel:  "verified",
+		},
+		{
+			name:       "reject overrules approve",
+			rules:      []string{"verified>=0.9:approve", "nudity>=0.8:reject"},
+			labels:     []models.ModerationLabel{{Name: "verified", Score: 0.95}, {Name: "nudity", Score: 0.85}},
+			wantAction: Reject,
+			wantRule:   "nudity>=0.8:reject",
+			wantLabel:  "nudity",
+		},
+		{
+			name:       "approve below threshold falls back to review",
+			rules:      []string{"verified>=0.9:approve", "*>=0.5:review"},
+			labels:     []models.ModerationLabel{{Name: "verified", Score: 0.6}},
+			wantAction: Review,
+			wantRule:   "*>=0.5:review",
+			wantLabel:  "verified",
+		},
+		{
+			name:       "wildcard matches any label",
+			rules:      []string{"*>=0.9:reject"},
+			labels:     []models.ModerationLabel{{Name: "nudity", Score: 0.2}, {Name: "gore", Score: 0.95}},
+			wantAction: Reject,
+			wantRule:   "*>=0.9:reject",
+			wantLabel:  "gore",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.rules)
+			if err != nil {
+				t.Fatalf("ParseRules() error = %v", err)
+			}
+			got := Decide(rules, tt.labels)
+			if got.Action != tt.wantAction || got.Rule != tt.wantRule {
+				t.Errorf("Decide() = %s by %q, want %s by %q", got.Action, got.Rule, tt.wantAction, tt.wantRule)
+			}
+			var label string
+			if got.Label != nil {
+				label = got.Label.Name
+			}
+			if label != tt.wantLabel {
+				t.Errorf("Decide() label = %q, want %q", label, tt.wantLabel)
+			}
+		})
+	}
+}
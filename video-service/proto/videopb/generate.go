@@ -0,0 +1,5 @@
+// Package videopb contains the generated protobuf and gRPC code for the
+// internal video API. Regenerate it after editing video.proto.
+package videopb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative videopb/video.proto
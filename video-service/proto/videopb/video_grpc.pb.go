@@ -0,0 +1,239 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: videopb/video.proto
+
+package videopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	VideoService_GetVideo_FullMethodName          = "/video.v1.VideoService/GetVideo"
+	VideoService_BatchGetVideos_FullMethodName    = "/video.v1.VideoService/BatchGetVideos"
+	VideoService_ListVideos_FullMethodName        = "/video.v1.VideoService/ListVideos"
+	VideoService_StreamVideoEvents_FullMethodName = "/video.v1.VideoService/StreamVideoEvents"
+)
+
+// VideoServiceClient is the client API for VideoService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VideoServiceClient interface {
+	GetVideo(ctx context.Context, in *GetVideoRequest, opts ...grpc.CallOption) (*Video, error)
+	BatchGetVideos(ctx context.Context, in *BatchGetVideosRequest, opts ...grpc.CallOption) (*BatchGetVideosResponse, error)
+	ListVideos(ctx context.Context, in *ListVideosRequest, opts ...grpc.CallOption) (*ListVideosResponse, error)
+	StreamVideoEvents(ctx context.Context, in *StreamVideoEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VideoEvent], error)
+}
+
+type videoServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVideoServiceClient(cc grpc.ClientConnInterface) VideoServiceClient {
+	return &videoServiceClient{cc}
+}
+
+func (c *videoServiceClient) GetVideo(ctx context.Context, in *GetVideoRequest, opts ...grpc.CallOption) (*Video, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Video)
+	err := c.cc.Invoke(ctx, VideoService_GetVideo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoServiceClient) BatchGetVideos(ctx context.Context, in *BatchGetVideosRequest, opts ...grpc.CallOption) (*BatchGetVideosResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetVideosResponse)
+	err := c.cc.Invoke(ctx, VideoService_BatchGetVideos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoServiceClient) ListVideos(ctx context.Context, in *ListVideosRequest, opts ...grpc.CallOption) (*ListVideosResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVideosResponse)
+	err := c.cc.Invoke(ctx, VideoService_ListVideos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoServiceClient) StreamVideoEvents(ctx context.Context, in *StreamVideoEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[VideoEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VideoService_ServiceDesc.Streams[0], VideoService_StreamVideoEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamVideoEventsRequest, VideoEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoService_StreamVideoEventsClient = grpc.ServerStreamingClient[VideoEvent]
+
+// VideoServiceServer is the server API for VideoService service.
+// All implementations must embed UnimplementedVideoServiceServer
+// for forward compatibility.
+type VideoServiceServer interface {
+	GetVideo(context.Context, *GetVideoRequest) (*Video, error)
+	BatchGetVideos(context.Context, *BatchGetVideosRequest) (*BatchGetVideosResponse, error)
+	ListVideos(context.Context, *ListVideosRequest) (*ListVideosResponse, error)
+	StreamVideoEvents(*StreamVideoEventsRequest, grpc.ServerStreamingServer[VideoEvent]) error
+	mustEmbedUnimplementedVideoServiceServer()
+}
+
+// UnimplementedVideoServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedVideoServiceServer struct{}
+
+func (UnimplementedVideoServiceServer) GetVideo(context.Context, *GetVideoRequest) (*Video, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVideo not implemented")
+}
+func (UnimplementedVideoServiceServer) BatchGetVideos(context.Context, *BatchGetVideosRequest) (*BatchGetVideosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetVideos not implemented")
+}
+func (UnimplementedVideoServiceServer) ListVideos(context.Context, *ListVideosRequest) (*ListVideosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVideos not implemented")
+}
+func (UnimplementedVideoServiceServer) StreamVideoEvents(*StreamVideoEventsRequest, grpc.ServerStreamingServer[VideoEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamVideoEvents not implemented")
+}
+func (UnimplementedVideoServiceServer) mustEmbedUnimplementedVideoServiceServer() {}
+func (UnimplementedVideoServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeVideoServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VideoServiceServer will
+// result in compilation errors.
+type UnsafeVideoServiceServer interface {
+	mustEmbedUnimplementedVideoServiceServer()
+}
+
+func RegisterVideoServiceServer(s grpc.ServiceRegistrar, srv VideoServiceServer) {
+	// If the following call pancis, it indicates UnimplementedVideoServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&VideoService_ServiceDesc, srv)
+}
+
+func _VideoService_GetVideo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVideoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoServiceServer).GetVideo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoService_GetVideo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoServiceServer).GetVideo(ctx, req.(*GetVideoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoService_BatchGetVideos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetVideosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoServiceServer).BatchGetVideos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoService_BatchGetVideos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoServiceServer).BatchGetVideos(ctx, req.(*BatchGetVideosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoService_ListVideos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVideosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoServiceServer).ListVideos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoService_ListVideos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoServiceServer).ListVideos(ctx, req.(*ListVideosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoService_StreamVideoEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamVideoEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VideoServiceServer).StreamVideoEvents(m, &grpc.GenericServerStream[StreamVideoEventsRequest, VideoEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoService_StreamVideoEventsServer = grpc.ServerStreamingServer[VideoEvent]
+
+// VideoService_ServiceDesc is the grpc.ServiceDesc for VideoService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VideoService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "video.v1.VideoService",
+	HandlerType: (*VideoServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetVideo",
+			Handler:    _VideoService_GetVideo_Handler,
+		},
+		{
+			MethodName: "BatchGetVideos",
+			Handler:    _VideoService_BatchGetVideos_Handler,
+		},
+		{
+			MethodName: "ListVideos",
+			Handler:    _VideoService_ListVideos_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamVideoEvents",
+			Handler:       _VideoService_StreamVideoEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "videopb/video.proto",
+}
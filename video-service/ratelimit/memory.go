@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps rate limits in process. Each replica then
+// enforces its own limits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	active    map[string]int
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// bucketSweepInterval is how often full buckets are dropped from memory
+const bucketSweepInterval = time.Minute
+
+// NewMemoryStore initializes a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*tokenBucket),
+		active:    make(map[string]int),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Limit), updated: now}
+		s.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	bucket.refill(now)
+
+	if bucket.tokens < 1 {
+		return bucket.tokens, false, nil
+	}
+	bucket.tokens--
+	return bucket.tokens, true, nil
+}
+
+func (s *MemoryStore) Acquire(_ context.Context, key string, max int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active[key] >= max {
+		return false, nil
+	}
+	s.active[key]++
+	return true, nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active[key] <= 1 {
+		delete(s.active, key)
+	} else {
+		s.active[key]--
+	}
+	return nil
+}
+
+// sweep drops buckets that have refilled completely, since they behave
+// exactly like a new bucket
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < bucketSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, bucket := range s.buckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(b.limit.Limit), b.tokens+elapsed*b.limit.RefillPerSecond())
+	b.updated = now
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Limit: 3, Window: time.Minute}
+
+	tests := []struct {
+		name        string
+		elapsed     time.Duration // Time moved back on the bucket before taking
+		wantAllowed bool
+		wantTokens  float64
+	}{
+		{name: "full bucket", wantAllowed: true, wantTokens: 2},
+		{name: "second", wantAllowed: true, wantTokens: 1},
+		{name: "last token", wantAllowed: true, wantTokens: 0},
+		{name: "empty", wantAllowed: false, wantTokens: 0},
+		{name: "refilled one", elapsed: 20 * time.Second, wantAllowed: true, wantTokens: 0},
+		{name: "refill capped at limit", elapsed: time.Hour, wantAllowed: true, wantTokens: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bucket, ok := store.buckets["key"]; ok {
+				bucket.updated = bucket.updated.Add(-tt.elapsed)
+			}
+			tokens, allowed, err := store.Take(ctx, "key", limit)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("Take() allowed = %v, want %v", allowed, tt.wantAllowed)
+			}
+			if tokens < tt.wantTokens-0.01 || tokens > tt.wantTokens+0.01 {
+				t.Errorf("Take() tokens = %.3f, want %.3f", tokens, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSeparatesKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	limit := Limit{Limit: 1, Window: time.Minute}
+
+	if _, allowed, _ := store.Take(ctx, "a", limit); !allowed {
+		t.Fatal("first request for a was refused")
+	}
+	if _, allowed, _ := store.Take(ctx, "a", limit); allowed {
+		t.Error("second request for a was allowed")
+	}
+	if _, allowed, _ := store.Take(ctx, "b", limit); !allowed {
+		t.Error("first request for b was refused")
+	}
+}
+
+func TestMemoryStoreAcquire(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	steps := []struct {
+		release bool
+		want    bool
+	}{
+		{want: true},
+		{want: true},
+		{want: false},
+		{release: true},
+		{want: true},
+		{want: false},
+	}
+	for i, step := range steps {
+		if step.release {
+			if err := store.Release(ctx, "key"); err != nil {
+				t.Fatalf("step %d: Release() error = %v", i, err)
+			}
+			continue
+		}
+		acquired, err := store.Acquire(ctx, "key", 2)
+		if err != nil {
+			t.Fatalf("step %d: Acquire() error = %v", i, err)
+		}
+		if acquired != step.want {
+			t.Errorf("step %d: Acquire() = %v, want %v", i, acquired, step.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package ratelimit defines rate limits and the stores that keep their
+// state, in process or in Redis. The middleware package adapts them to Gin.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket holding up to Limit requests, refilled at
+// Limit requests per Window. The zero value does not limit anything.
+type Limit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseLimit reads a limit written as "<requests>/<window>", such as
+// "60/1m". An empty string or "0" disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+	count, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 60/1m", value)
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit < 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid request count", value)
+	}
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid window", value)
+	}
+	return Limit{Limit: limit, Window: duration}, nil
+}
+
+// String writes the limit in the form read by ParseLimit
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Limit, l.Window)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseLimit
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Limit > 0 && l.Window > 0
+}
+
+// RefillPerSecond is the rate at which the bucket refills
+func (l Limit) RefillPerSecond() float64 {
+	return float64(l.Limit) / l.Window.Seconds()
+}
+
+// Store keeps token buckets and concurrency counters, either in process or
+// in a backend shared by every replica
+type Store interface {
+	// Take removes a token from the bucket at key if one is available and
+	// returns the tokens left
+	Take(ctx context.Context, key string, limit Limit) (tokens float64, allowed bool, err error)
+	// Acquire takes one of max concurrent slots at key
+	Acquire(ctx context.Context, key string, max int) (bool, error)
+	// Release frees a slot taken by Acquire
+	Release(ctx context.Context, key string) error
+}
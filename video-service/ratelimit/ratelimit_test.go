@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "60/1m", want: Limit{Limit: 60, Window: time.Minute}},
+		{value: "20/1h", want: Limit{Limit: 20, Window: time.Hour}},
+		{value: "", want: Limit{}},
+		{value: "0", want: Limit{}},
+		{value: "60", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "x/1m", wantErr: true},
+		{value: "60/0s", wantErr: true},
+		{value: "60/soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLimitRoundTrip(t *testing.T) {
+	for _, value := range []string{"60/1m0s", "0"} {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			t.Fatalf("ParseLimit(%q) error = %v", value, err)
+		}
+		if got := limit.String(); got != value {
+			t.Errorf("ParseLimit(%q).String() = %q", value, got)
+		}
+	}
+}
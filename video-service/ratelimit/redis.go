@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// concurrencySlotTTL bounds how long a concurrency slot survives a replica
+// that died without releasing it
+const concurrencySlotTTL = time.Hour
+
+// takeTokenScript refills and takes from a token bucket stored as a hash of
+// tokens and the time of the last update, using the server clock so replicas
+// agree on time. Tokens are returned as a string to keep their fraction.
+var takeTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+var acquireSlotScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count > tonumber(ARGV[1]) then
+	redis.call('DECR', KEYS[1])
+	return 0
+end
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+var releaseSlotScript = redis.NewScript(`
+if redis.call('DECR', KEYS[1]) <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps rate limits in Redis, or any server speaking its
+// protocol, so that every replica enforces the same limits
+type RedisStore struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+// NewRedisStore initializes a new RedisStore
+func NewRedisStore(ctx context.Context, url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{Client: client, Prefix: "video-service:ratelimit:"}, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (float64, bool, error) {
+	perMillisecond := limit.RefillPerSecond() / 1000
+	result, err := takeTokenScript.Run(ctx, s.Client, []string{s.Prefix + key}, limit.Limit, perMillisecond).Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	if len(result) != 2 {
+		return 0, false, fmt.Errorf("unexpected rate limit reply: %v", result)
+	}
+	allowed, _ := result[0].(int64)
+	tokens, err := strconv.ParseFloat(fmt.Sprint(result[1]), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("unexpected rate limit reply: %w", err)
+	}
+	return tokens, allowed == 1, nil
+}
+
+func (s *RedisStore) Acquire(ctx context.Context, key string, max int) (bool, error) {
+	acquired, err := acquireSlotScript.Run(ctx, s.Client, []string{s.Prefix + key}, max, int(concurrencySlotTTL.Seconds())).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire concurrency slot: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	if err := releaseSlotScript.Run(ctx, s.Client, []string{s.Prefix + key}).Err(); err != nil {
+		return fmt.Errorf("failed to release concurrency slot: %w", err)
+	}
+	return nil
+}
+
+// Close disconnects from Redis
+func (s *RedisStore) Close() error {
+	return s.Client.Close()
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"video-service/controllers"
+	"video-service/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterAPIKeyRoutes(router gin.IRouter, apiKeyController *controllers.APIKeyController, authz *middleware.Authorizer) {
+	router.Use(authz.Require(middleware.PermManageAPIKeys))
+	router.POST("", apiKeyController.CreateAPIKey)
+	router.GET("", apiKeyController.ListAPIKeys)
+	router.GET("/:id", apiKeyController.GetAPIKey)
+	router.POST("/:id/rotate", apiKeyController.RotateAPIKey)
+	router.DELETE("/:id", apiKeyController.RevokeAPIKey)
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"video-service/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthRoutes registers the probes at the root of the router. They
+// need no credentials.
+func RegisterHealthRoutes(router gin.IRouter, healthController *controllers.HealthController) {
+	router.GET("/healthz", healthController.Healthz)
+	router.GET("/readyz", healthController.Readyz)
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"video-service/controllers"
+	"video-service/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterModerationRoutes(router gin.IRouter, moderationController *controllers.ModerationController, authz *middleware.Authorizer, idempotency gin.HandlerFunc) {
+	router.Use(authz.Require(middleware.PermModerate))
+	router.GET("/queue", moderationController.ListQueue)
+	router.POST("/videos/:id/approve", idempotency, moderationController.ApproveVideo)
+	router.POST("/videos/:id/reject", idempotency, moderationController.RejectVideo)
+}
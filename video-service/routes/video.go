@@ -2,11 +2,47 @@ package routes
 
 import (
 	"video-service/controllers"
+	"video-service/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterVideoRoutes(router gin.IRouter, videoController *controllers.VideoController) {
-	router.POST("/upload", videoController.UploadVideo)
-	router.GET("/:id", videoController.GetMetadata)
+func RegisterVideoRoutes(router gin.IRouter, videoController *controllers.VideoController, authz *middleware.Authorizer, idempotency gin.HandlerFunc, uploadGuards ...gin.HandlerFunc) {
+	maxBody := videoController.Quotas.Limits.MaxFileSize
+	if maxBody > 0 {
+		maxBody += controllers.UploadFormOverhead
+	}
+	router.POST("/upload", uploadChain(authz, maxBody, idempotency, uploadGuards, videoController.UploadVideo)...)
+	router.GET("/usage", authz.Require(middleware.PermUpload), videoController.GetUsage)
+	router.GET("", authz.Require(middleware.PermView), videoController.ListVideos)
+	router.GET("/:id", authz.Require(middleware.PermView), videoController.GetMetadata)
+	router.PUT("/:id/visibility", authz.Require(middleware.PermUpdate), idempotency, videoController.UpdateVisibility)
+	router.PUT("/:id/schedule", authz.Require(middleware.PermUpdate), idempotency, videoController.UpdateSchedule)
+	router.POST("/:id/access", authz.Require(middleware.PermView), videoController.RequestAccess)
+}
+
+// RegisterVideoRoutesV2 registers the v2 API. It enforces the same permissions
+// as v1 but exchanges typed DTOs
+func RegisterVideoRoutesV2(router gin.IRouter, videoController *controllers.VideoController, authz *middleware.Authorizer, idempotency gin.HandlerFunc, uploadGuards ...gin.HandlerFunc) {
+	maxBody := videoController.Quotas.Limits.MaxFileSize
+	if maxBody > 0 {
+		maxBody += controllers.UploadFormOverhead
+	}
+	router.POST("", uploadChain(authz, maxBody, idempotency, uploadGuards, videoController.UploadVideoV2)...)
+	router.GET("", authz.Require(middleware.PermView), videoController.ListVideosV2)
+	router.POST("/batch", authz.Require(middleware.PermView), videoController.BatchGetVideosV2)
+	router.POST("/import", uploadChain(authz, controllers.ImportRequestLimit, idempotency, uploadGuards, videoController.ImportVideoV2)...)
+	router.GET("/usage", authz.Require(middleware.PermUpload), videoController.GetUsageV2)
+	router.GET("/:id", authz.Require(middleware.PermView), videoController.GetVideoV2)
+	router.PUT("/:id/visibility", authz.Require(middleware.PermUpdate), idempotency, videoController.UpdateVisibilityV2)
+	router.PUT("/:id/schedule", authz.Require(middleware.PermUpdate), idempotency, videoController.UpdateScheduleV2)
+	router.POST("/:id/access", authz.Require(middleware.PermView), videoController.RequestAccessV2)
+}
+
+// uploadChain puts the upload guards, such as rate limits, after the
+// permission check and before the body is read
+func uploadChain(authz *middleware.Authorizer, maxBody int64, idempotency gin.HandlerFunc, guards []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+	chain := []gin.HandlerFunc{authz.Require(middleware.PermUpload)}
+	chain = append(chain, guards...)
+	return append(chain, middleware.LimitBodySize(maxBody), idempotency, handler)
 }
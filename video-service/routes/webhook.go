@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"video-service/controllers"
+	"video-service/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterWebhookRoutes(router gin.IRouter, webhookController *controllers.WebhookController, authz *middleware.Authorizer, idempotency gin.HandlerFunc) {
+	router.Use(authz.Require(middleware.PermManageWebhooks))
+	router.POST("", webhookController.CreateWebhook)
+	router.GET("", webhookController.ListWebhooks)
+	router.GET("/:id", webhookController.GetWebhook)
+	router.PUT("/:id", idempotency, webhookController.UpdateWebhook)
+	router.DELETE("/:id", webhookController.DeleteWebhook)
+	router.GET("/:id/deliveries", webhookController.ListDeliveries)
+	router.POST("/:id/deliveries/:delivery_id/redeliver", idempotency, webhookController.Redeliver)
+}
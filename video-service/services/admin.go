@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"video-service/apperrors"
+	"video-service/models"
+	"video-service/utils"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VideoSearch filters videos for operators. Unlike ListVideos it matches
+// every visibility and publishing state.
+type VideoSearch struct {
+	Query          string // Case-insensitive title substring
+	Tag            string
+	OwnerID        string
+	IncludeDeleted bool
+	Limit          int64
+	Offset         int64
+}
+
+// SearchVideos returns the videos matching search, newest first
+func (vs *VideoService) SearchVideos(ctx context.Context, search VideoSearch) ([]models.VideoMetadata, error) {
+	filter := bson.M{}
+	if search.Query != "" {
+		filter["title"] = primitive.Regex{Pattern: regexp.QuoteMeta(search.Query), Options: "i"}
+	}
+	if search.Tag != "" {
+		filter["tags"] = search.Tag
+	}
+	if search.OwnerID != "" {
+		filter["owner_id"] = search.OwnerID
+	}
+	if !search.IncludeDeleted {
+		filter["deleted_at"] = nil
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "uploaded_at", Value: -1}}).
+		SetLimit(search.Limit).
+		SetSkip(search.Offset)
+	cursor, err := vs.DB.Collection("videos").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search videos: %w", err)
+	}
+
+	videos := []models.VideoMetadata{}
+	if err := cursor.All(ctx, &videos); err != nil {
+		return nil, fmt.Errorf("failed to decode videos: %w", err)
+	}
+	return videos, nil
+}
+
+// FindVideo retrieves a video by ID whether or not it has been deleted
+func (vs *VideoService) FindVideo(ctx context.Context, id string) (*models.VideoMetadata, error) {
+	return vs.findVideo(ctx, id, true)
+}
+
+// EnsureVideoIndexes creates the index used to find videos by content hash
+func (vs *VideoService) EnsureVideoIndexes(ctx context.Context) error {
+	_, err := vs.DB.Collection("videos").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "content_hash", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"content_hash": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create video indexes: %w", err)
+	}
+	return nil
+}
+
+// FindVideoByContentHash retrieves a video, deleted or not, whose file has
+// the given hex SHA-256
+func (vs *VideoService) FindVideoByContentHash(ctx context.Context, hash string) (*models.VideoMetadata, error) {
+	var metadata models.VideoMetadata
+	err := vs.DB.Collection("videos").FindOne(ctx, bson.M{"content_hash": hash}).Decode(&metadata)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, apperrors.NotFound("Video not found").WithDetail("content_hash", hash)
+		}
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+// DeleteVideo hides a video from every read path and records a
+// video.deleted event. Its stored files are kept so it can be restored.
+func (vs *VideoService) DeleteVideo(ctx context.Context, id string) (*models.VideoMetadata, error) {
+	return vs.setDeleted(ctx, id, bson.M{"$set": bson.M{"deleted_at": time.Now()}}, true, EventVideoDeleted)
+}
+
+// RestoreVideo undoes DeleteVideo and records a video.restored event
+func (vs *VideoService) RestoreVideo(ctx context.Context, id string) (*models.VideoMetadata, error) {
+	return vs.setDeleted(ctx, id, bson.M{"$unset": bson.M{"deleted_at": ""}}, false, EventVideoRestored)
+}
+
+// setDeleted applies update to a video that is currently not in the wanted
+// deleted state, recording eventType in the same transaction
+func (vs *VideoService) setDeleted(ctx context.Context, id string, update bson.M, deleted bool, eventType EventType) (*models.VideoMetadata, error) {
+	metadata, err := vs.FindVideo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if (metadata.DeletedAt != nil) == deleted {
+		if deleted {
+			return nil, apperrors.Conflict("Video is already deleted").WithDetail("id", id)
+		}
+		return nil, apperrors.Conflict("Video is not deleted").WithDetail("id", id)
+	}
+
+	filter := bson.M{"_id": metadata.ID, "deleted_at": bson.M{"$exists": !deleted}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := vs.DB.Collection("videos").FindOneAndUpdate(sc, filter, update, opts).Decode(metadata); err != nil {
+			return err
+		}
+		return vs.recordEvent(sc, eventType, metadata)
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, apperrors.Conflict("Video was changed concurrently").WithDetail("id", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", eventType, err)
+	}
+	return metadata, nil
+}
+
+// ReprocessVideo downloads a stored video again, recalculates its duration
+// and records a video.updated event
+func (vs *VideoService) ReprocessVideo(ctx context.Context, id string) (*models.VideoMetadata, error) {
+	metadata, err := vs.FindVideo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := vs.ObjectKey(metadata.URL)
+	if !ok {
+		return nil, apperrors.Unprocessable("Video is not stored in the configured bucket").WithDetail("url", metadata.URL)
+	}
+
+	tmpFile, err := utils.CreateTemporaryFile(vs.ScratchDir, key)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.RemoveTemporaryFile(tmpFile)
+
+	_, err = manager.NewDownloader(vs.S3Client).Download(ctx, tmpFile, &s3.GetObjectInput{Bucket: &vs.Bucket, Key: &key})
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to download video from storage")
+	}
+	duration, err := utils.CalculateVideoDuration(ctx, vs.FFprobePath, tmpFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate video duration: %w", err)
+	}
+
+	metadata.Duration = duration
+	err = vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := vs.DB.Collection("videos").UpdateOne(sc, bson.M{"_id": metadata.ID}, bson.M{"$set": bson.M{"duration": duration}}); err != nil {
+			return err
+		}
+		return vs.recordEvent(sc, EventVideoUpdated, metadata)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reprocessed video: %w", err)
+	}
+	return metadata, nil
+}
+
+// ObjectKey returns the key in the bucket of a URL returned by an upload,
+// for both virtual-hosted and path-style URLs
+func (vs *VideoService) ObjectKey(location string) (string, bool) {
+	u, err := url.Parse(location)
+	if err != nil || u.Path == "" {
+		return "", false
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if !strings.HasPrefix(u.Host, vs.Bucket+".") {
+		var found bool
+		if key, found = strings.CutPrefix(key, vs.Bucket+"/"); !found {
+			return "", false
+		}
+	}
+	return key, key != ""
+}
+
+// StorageObject is an object in the bucket
+type StorageObject struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// MissingObject is a stored file that a video refers to but the bucket lacks
+type MissingObject struct {
+	VideoID string `json:"video_id"`
+	Field   string `json:"field"` // url, thumbnail or quarantine
+	URL     string `json:"url"`
+}
+
+// StorageReport compares the bucket with the metadata referring to it
+type StorageReport struct {
+	Objects    int             `json:"objects"`
+	Videos     int             `json:"videos"`
+	Orphaned   []StorageObject `json:"orphaned"` // Objects no video refers to
+	Missing    []MissingObject `json:"missing"`  // References to objects that do not exist
+	OrphanSize int64           `json:"orphan_size"`
+}
+
+// ReconcileStorage lists the bucket and every video, deleted ones included,
+// and reports objects without a video and videos without their objects. It
+// changes nothing.
+func (vs *VideoService) ReconcileStorage(ctx context.Context) (*StorageReport, error) {
+	objects := map[string]int64{}
+	paginator := s3.NewListObjectsV2Paginator(vs.S3Client, &s3.ListObjectsV2Input{Bucket: &vs.Bucket})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket: %w", err)
+		}
+		for _, object := range page.Contents {
+			var size int64
+			if object.Size != nil {
+				size = *object.Size
+			}
+			objects[*object.Key] = size
+		}
+	}
+
+	report := &StorageReport{Objects: len(objects), Orphaned: []StorageObject{}, Missing: []MissingObject{}}
+	referenced := map[string]bool{}
+	cursor, err := vs.DB.Collection("videos").Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"url": 1, "thumbnail": 1, "rejection.quarantine_key": 1}).SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var video models.VideoMetadata
+		if err := cursor.Decode(&video); err != nil {
+			return nil, fmt.Errorf("failed to decode video: %w", err)
+		}
+		report.Videos++
+		for _, ref := range []struct{ field, location string }{{"url", video.URL}, {"thumbnail", video.Thumbnail}} {
+			field, location := ref.field, ref.location
+			if location == "" {
+				continue
+			}
+			key, ok := vs.ObjectKey(location)
+			if ok {
+				referenced[key] = true
+			}
+			if _, exists := objects[key]; !ok || !exists {
+				report.Missing = append(report.Missing, MissingObject{VideoID: video.ID.Hex(), Field: field, URL: location})
+			}
+		}
+		if video.Rejection != nil && video.Rejection.QuarantineKey != "" {
+			key := video.Rejection.QuarantineKey
+			referenced[key] = true
+			if _, exists := objects[key]; !exists {
+				report.Missing = append(report.Missing, MissingObject{VideoID: video.ID.Hex(), Field: "quarantine", URL: key})
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+
+	for key, size := range objects {
+		if !referenced[key] {
+			report.Orphaned = append(report.Orphaned, StorageObject{Key: key, Size: size})
+			report.OrphanSize += size
+		}
+	}
+	sort.Slice(report.Orphaned, func(i, j int) bool { return report.Orphaned[i].Key < report.Orphaned[j].Key })
+	return report, nil
+}
+
+// ExportVideos writes every video document, deleted ones included, to w as
+// one MongoDB Extended JSON object per line. Fields not in VideoMetadata,
+// such as the event sequence, are kept. It returns the number written.
+func (vs *VideoService) ExportVideos(ctx context.Context, w io.Writer) (int, error) {
+	cursor, err := vs.DB.Collection("videos").Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to export videos: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return count, fmt.Errorf("failed to encode video: %w", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to export videos: %w", err)
+	}
+	return count, nil
+}
+
+// ImportVideos reads documents written by ExportVideos and stores each under
+// its ID, replacing any existing video. No events are recorded. It returns
+// the number imported.
+func (vs *VideoService) ImportVideos(ctx context.Context, r io.Reader) (int, error) {
+	collection := vs.DB.Collection("videos")
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(text, true, &doc); err != nil {
+			return count, apperrors.InvalidArgument(fmt.Sprintf("Line %d is not a valid video: %v", line, err)).WithDetail("line", line)
+		}
+		id, ok := doc.Map()["_id"].(primitive.ObjectID)
+		if !ok {
+			return count, apperrors.InvalidArgument(fmt.Sprintf("Line %d has no ObjectID _id", line)).WithDetail("line", line)
+		}
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true)); err != nil {
+			return count, fmt.Errorf("failed to import video %s: %w", id.Hex(), err)
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read import: %w", err)
+	}
+	return count, nil
+}
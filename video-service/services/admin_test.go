@@ -0,0 +1,28 @@
+package services
+
+import "testing"
+
+func TestObjectKey(t *testing.T) {
+	vs := &VideoService{Bucket: "videos"}
+	tests := []struct {
+		location string
+		want     string
+		wantOK   bool
+	}{
+		{location: "https://videos.s3.us-east-1.amazonaws.com/owner/abc.mp4", want: "owner/abc.mp4", wantOK: true},
+		{location: "https://s3.us-east-1.amazonaws.com/videos/owner/abc.mp4", want: "owner/abc.mp4", wantOK: true},
+		{location: "http://localhost:9000/videos/owner/abc.mp4", want: "owner/abc.mp4", wantOK: true},
+		{location: "https://s3.us-east-1.amazonaws.com/other/owner/abc.mp4"},
+		{location: "https://other.s3.us-east-1.amazonaws.com/owner/abc.mp4"},
+		{location: "https://videos.s3.us-east-1.amazonaws.com/"},
+		{location: "http://localhost:9000/videos/"},
+		{location: ""},
+		{location: "://bad"},
+	}
+	for _, tt := range tests {
+		got, ok := vs.ObjectKey(tt.location)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ObjectKey(%q) = %q, %v, want %q, %v", tt.location, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
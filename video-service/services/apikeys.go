@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyPrefix starts every API key, so keys are recognisable in headers and
+// in leaked-secret scanners
+const APIKeyPrefix = "vsk_"
+
+// apiKeyDisplayLength is how much of a key is kept in clear to tell keys apart
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+// lastUsedResolution limits how often last_used_at is written for a busy key
+const lastUsedResolution = time.Minute
+
+// APIKey lets a server-to-server client act for its owner with a fixed set
+// of scopes. Only a SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	OwnerID    string             `bson:"owner_id"`
+	Name       string             `bson:"name"`
+	Prefix     string             `bson:"prefix"`
+	Hash       string             `bson:"hash"`
+	Scopes     []string           `bson:"scopes"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	CreatedBy  string             `bson:"created_by"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty"`
+	RotatedAt  *time.Time         `bson:"rotated_at,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty"`
+	// The key replaced by the last rotation keeps working until
+	// PreviousExpiresAt so clients can switch over
+	PreviousHash      string     `bson:"previous_hash,omitempty"`
+	PreviousExpiresAt *time.Time `bson:"previous_expires_at,omitempty"`
+}
+
+// APIKeySettings are the fields of a new API key
+type APIKeySettings struct {
+	OwnerID string
+	Name    string
+	Scopes  []string
+}
+
+// ErrInvalidAPIKey is returned by an APIKeyResolver for unknown, rotated out
+// or revoked keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyResolver looks up the key a request authenticates with, for
+// middleware.APIKeyAuthenticator
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, secret string) (*APIKey, error)
+}
+
+// Validate checks that the owner, name and scopes are present
+func (s APIKeySettings) Validate() error {
+	if strings.TrimSpace(s.OwnerID) == "" {
+		return apperrors.InvalidArgument("owner_id is required")
+	}
+	if strings.TrimSpace(s.Name) == "" {
+		return apperrors.InvalidArgument("name is required")
+	}
+	if len(s.Scopes) == 0 {
+		return apperrors.InvalidArgument("At least one scope is required")
+	}
+	return nil
+}
+
+// APIKeyService manages API keys and authenticates requests carrying them
+type APIKeyService struct {
+	DB *mongo.Database
+	// Scopes lists the scopes a key may be issued with
+	Scopes []string
+}
+
+// NewAPIKeyService initializes a new APIKeyService
+func NewAPIKeyService(db *mongo.Database, scopes []string) *APIKeyService {
+	return &APIKeyService{DB: db, Scopes: scopes}
+}
+
+// EnsureAPIKeyIndexes creates the indexes used to look keys up by hash and
+// by owner
+func (ks *APIKeyService) EnsureAPIKeyIndexes(ctx context.Context) error {
+	_, err := ks.DB.Collection("api_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "previous_hash", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API key indexes: %w", err)
+	}
+	return nil
+}
+
+// CreateKey issues a key for settings.OwnerID. The returned secret is the
+// only copy of the key.
+func (ks *APIKeyService) CreateKey(ctx context.Context, createdBy string, settings APIKeySettings) (*APIKey, string, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, "", err
+	}
+	for _, scope := range settings.Scopes {
+		if !slices.Contains(ks.Scopes, scope) {
+			return nil, "", apperrors.InvalidArgument(fmt.Sprintf("Unknown scope: %s", scope))
+		}
+	}
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := APIKey{
+		OwnerID:   settings.OwnerID,
+		Name:      settings.Name,
+		Prefix:    secret[:apiKeyDisplayLength],
+		Hash:      hashAPIKey(secret),
+		Scopes:    settings.Scopes,
+		CreatedAt: time.Now(),
+		CreatedBy: createdBy,
+	}
+	result, err := ks.DB.Collection("api_keys").InsertOne(ctx, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to save API key: %w", err)
+	}
+	key.ID = result.InsertedID.(primitive.ObjectID)
+	return &key, secret, nil
+}
+
+// ListKeys returns a page of keys, oldest first, optionally only those of
+// ownerID. Revoked keys are included.
+func (ks *APIKeyService) ListKeys(ctx context.Context, ownerID string, limit, offset int64) ([]APIKey, error) {
+	filter := bson.M{}
+	if ownerID != "" {
+		filter["owner_id"] = ownerID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit).SetSkip(offset)
+	cursor, err := ks.DB.Collection("api_keys").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// GetKey returns a key by ID
+func (ks *APIKeyService) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("Invalid API key ID format").WithDetail("id", id)
+	}
+
+	var key APIKey
+	err = ks.DB.Collection("api_keys").FindOne(ctx, bson.M{"_id": objectID}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, apperrors.NotFound("API key not found").WithDetail("id", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateKey replaces a key's secret. The old secret keeps working for
+// gracePeriod, or stops at once when it is zero.
+func (ks *APIKeyService) RotateKey(ctx context.Context, id string, gracePeriod time.Duration) (*APIKey, string, error) {
+	key, err := ks.GetKey(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key.RevokedAt != nil {
+		return nil, "", apperrors.Conflict("API key is revoked").WithDetail("id", id)
+	}
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	set := bson.M{"prefix": secret[:apiKeyDisplayLength], "hash": hashAPIKey(secret), "rotated_at": now}
+	update := bson.M{"$set": set}
+	if gracePeriod > 0 {
+		set["previous_hash"] = key.Hash
+		set["previous_expires_at"] = now.Add(gracePeriod)
+	} else {
+		update["$unset"] = bson.M{"previous_hash": "", "previous_expires_at": ""}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated APIKey
+	err = ks.DB.Collection("api_keys").FindOneAndUpdate(ctx,
+		bson.M{"_id": key.ID, "revoked_at": nil}, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, "", apperrors.Conflict("API key is revoked").WithDetail("id", id)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	return &updated, secret, nil
+}
+
+// RevokeKey stops a key, and any secret still in its grace period, from
+// authenticating. Revoking a revoked key does nothing.
+func (ks *APIKeyService) RevokeKey(ctx context.Context, id string) (*APIKey, error) {
+	key, err := ks.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated APIKey
+	err = ks.DB.Collection("api_keys").FindOneAndUpdate(ctx, bson.M{"_id": key.ID}, bson.M{
+		"$set":   bson.M{"revoked_at": time.Now()},
+		"$unset": bson.M{"previous_hash": "", "previous_expires_at": ""},
+	}, opts).Decode(&updated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return &updated, nil
+}
+
+// ResolveAPIKey finds the live key matching secret and records when it was
+// last used
+func (ks *APIKeyService) ResolveAPIKey(ctx context.Context, secret string) (*APIKey, error) {
+	hash := hashAPIKey(secret)
+	now := time.Now()
+	collection := ks.DB.Collection("api_keys")
+
+	var key APIKey
+	err := collection.FindOne(ctx, bson.M{
+		"revoked_at": nil,
+		"$or": bson.A{
+			bson.M{"hash": hash},
+			bson.M{"previous_hash": hash, "previous_expires_at": bson.M{"$gt": now}},
+		},
+	}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to verify API key")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		_, err := collection.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{"$set": bson.M{"last_used_at": now}})
+		if err != nil {
+			// Losing a last-used timestamp is not worth failing the request
+			slog.WarnContext(ctx, "Failed to record API key use", logging.Err(err))
+		}
+	}
+
+	return &key, nil
+}
+
+func newAPIKeySecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return APIKeyPrefix + hex.EncodeToString(raw), nil
+}
+
+// hashAPIKey is the stored form of a key. Keys are long and random, so a
+// plain hash is enough and lets keys be looked up directly.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"video-service/models"
+)
+
+// ModerationInput is what classifiers look at
+type ModerationInput struct {
+	Title  string
+	Tags   []string
+	Frames []string // JPEG files sampled from the video and its thumbnail
+}
+
+// Classifier labels a video for moderation. Scores run from 0 to 1.
+type Classifier interface {
+	Classify(ctx context.Context, input ModerationInput) ([]models.ModerationLabel, error)
+}
+
+// textClassifier is implemented by classifiers that never look at frames,
+// which spares downloading the video when only they are configured
+type textClassifier interface {
+	TextOnly() bool
+}
+
+// NewClassifiers initializes the classifiers named in kinds: keywords, which
+// matches blockedTerms, and http, which calls the model server at url
+func NewClassifiers(kinds, blockedTerms []string, url string, timeout time.Duration) ([]Classifier, error) {
+	var classifiers []Classifier
+	for _, kind := range kinds {
+		switch kind {
+		case "keywords":
+			classifiers = append(classifiers, NewKeywordClassifier(blockedTerms))
+		case "http":
+			classifiers = append(classifiers, NewHTTPClassifier(url, timeout))
+		default:
+			return nil, fmt.Errorf("unknown moderation classifier %q", kind)
+		}
+	}
+	return classifiers, nil
+}
+
+// KeywordClassifier labels videos whose title or tags contain a blocked
+// term as blocked_term with a score of 1
+type KeywordClassifier struct {
+	Terms []string // Lowercase words or phrases, matched on word boundaries
+}
+
+// NewKeywordClassifier initializes a new KeywordClassifier
+func NewKeywordClassifier(terms []string) *KeywordClassifier {
+	k := &KeywordClassifier{}
+	for _, term := range terms {
+		if normalized := normalizeText(term); normalized != "" {
+			k.Terms = append(k.Terms, normalized)
+		}
+	}
+	return k
+}
+
+func (k *KeywordClassifier) Classify(ctx context.Context, input ModerationInput) ([]models.ModerationLabel, error) {
+	text := " " + normalizeText(input.Title+" "+strings.Join(input.Tags, " ")) + " "
+	for _, term := range k.Terms {
+		if strings.Contains(text, " "+term+" ") {
+			return []models.ModerationLabel{{Name: "blocked_term", Score: 1, Source: "keywords"}}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (k *KeywordClassifier) TextOnly() bool {
+	return true
+}
+
+// normalizeText lowercases text and reduces it to words separated by single
+// spaces
+func normalizeText(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// HTTPClassifier asks an external model server to label a video. It POSTs
+//
+//	{"title": "...", "tags": ["..."], "frames": ["<base64 JPEG>", ...]}
+//
+// and expects {"labels": [{"name": "nudity", "score": 0.93}]} back.
+type HTTPClassifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPClassifier initializes a new HTTPClassifier
+func NewHTTPClassifier(url string, timeout time.Duration) *HTTPClassifier {
+	return &HTTPClassifier{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+type classifyRequest struct {
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Frames []string `json:"frames"`
+}
+
+type classifyResponse struct {
+	Labels []struct {
+		Name  string  `json:"name"`
+		Score float64 `json:"score"`
+	} `json:"labels"`
+}
+
+func (h *HTTPClassifier) Classify(ctx context.Context, input ModerationInput) ([]models.ModerationLabel, error) {
+	body := classifyRequest{Title: input.Title, Tags: input.Tags, Frames: make([]string, 0, len(input.Frames))}
+	if body.Tags == nil {
+		body.Tags = []string{}
+	}
+	for _, path := range input.Frames {
+		frame, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		body.Frames = append(body.Frames, base64.StdEncoding.EncodeToString(frame))
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call classifier: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("classifier returned HTTP %d", resp.StatusCode)
+	}
+
+	var result classifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse classifier response: %w", err)
+	}
+	labels := make([]models.ModerationLabel, 0, len(result.Labels))
+	for _, label := range result.Labels {
+		if label.Name == "" || math.IsNaN(label.Score) || label.Score < 0 || label.Score > 1 {
+			return nil, fmt.Errorf("classifier returned an invalid label %q with score %v", label.Name, label.Score)
+		}
+		labels = append(labels, models.ModerationLabel{Name: label.Name, Score: label.Score, Source: "http"})
+	}
+	return labels, nil
+}
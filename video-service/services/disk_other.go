@@ -0,0 +1,10 @@
+//go:build !unix
+
+package services
+
+import "errors"
+
+// freeDiskSpace is only implemented on Unix
+func freeDiskSpace(string) (uint64, error) {
+	return 0, errors.New("disk space checks are not supported on this platform")
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// EventHub is the in-process broker. It fans video events out to local
+// subscribers, such as gRPC event streams and tests. Events are dropped for
+// subscribers that fall behind rather than blocking the publisher.
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan VideoEvent]struct{}
+	closed      bool
+}
+
+// NewEventHub initializes a new EventHub
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[chan VideoEvent]struct{})}
+}
+
+// Subscribe registers a subscriber with room for buffer pending events. The
+// returned function unsubscribes and closes the channel. The channel is also
+// closed when the hub is.
+func (h *EventHub) Subscribe(buffer int) (<-chan VideoEvent, func()) {
+	ch := make(chan VideoEvent, buffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription, for shutdown
+func (h *EventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (h *EventHub) Publish(ctx context.Context, event VideoEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.WarnContext(ctx, "Dropping event for full subscriber", slog.String("event_type", string(event.Type)), slog.String("video_id", event.VideoID))
+		}
+	}
+	return nil
+}
+
+// EventTarget is one destination of outbox events. Its name is recorded on
+// an event once it accepts it, so retrying after another target failed does
+// not deliver the event twice.
+type EventTarget struct {
+	Name      string
+	Publisher EventPublisher
+}
+
+// MultiEventPublisher publishes each event to every target in turn
+type MultiEventPublisher []EventTarget
+
+func (m MultiEventPublisher) Publish(ctx context.Context, event VideoEvent) error {
+	_, err := m.PublishExcept(ctx, event, nil)
+	return err
+}
+
+// PublishExcept publishes event to the targets not named in done. It returns
+// the names of the targets that accepted it, and the errors of the others.
+func (m MultiEventPublisher) PublishExcept(ctx context.Context, event VideoEvent, done []string) ([]string, error) {
+	var accepted []string
+	var errs []error
+	for _, target := range m {
+		if slices.Contains(done, target.Name) {
+			continue
+		}
+		if err := target.Publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			continue
+		}
+		accepted = append(accepted, target.Name)
+	}
+	return accepted, errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EventType names a video lifecycle event
+type EventType string
+
+const (
+	EventVideoUploaded     EventType = "video.uploaded"
+	EventVideoUpdated      EventType = "video.updated"
+	EventVideoPublished    EventType = "video.published"
+	EventVideoExpired      EventType = "video.expired"
+	EventVideoDeleted      EventType = "video.deleted"
+	EventVideoRestored     EventType = "video.restored"
+	EventVideoImportFailed EventType = "video.import_failed"
+	EventVideoRejected     EventType = "video.rejected"
+	EventVideoApproved     EventType = "video.approved"
+)
+
+// IsValid reports whether t is one of the known event types
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventVideoUploaded, EventVideoUpdated, EventVideoPublished, EventVideoExpired, EventVideoDeleted, EventVideoRestored, EventVideoImportFailed, EventVideoRejected, EventVideoApproved:
+		return true
+	}
+	return false
+}
+
+// VideoEvent describes something that happened to a video. Sequence numbers
+// increase by one for each event of a video, so consumers can restore order
+// and drop the duplicates that at-least-once delivery allows.
+type VideoEvent struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	VideoID    string    `json:"video_id"`
+	OwnerID    string    `json:"owner_id"`
+	Sequence   int64     `json:"sequence"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// EventPublisher delivers video events to interested parties. A nil error
+// means the event was accepted and will not be lost.
+type EventPublisher interface {
+	Publish(ctx context.Context, event VideoEvent) error
+}
+
+// LogEventPublisher writes events to the service log
+type LogEventPublisher struct{}
+
+func (LogEventPublisher) Publish(ctx context.Context, event VideoEvent) error {
+	slog.InfoContext(ctx, "Event",
+		slog.String("event_type", string(event.Type)),
+		slog.String("video_id", event.VideoID),
+		slog.Int64("sequence", event.Sequence),
+		slog.Time("occurred_at", event.OccurredAt))
+	return nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+	"video-service/metrics"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// HealthCheck probes one dependency the service needs to serve requests
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthResult is the outcome of one HealthCheck
+type HealthResult struct {
+	Name    string
+	Err     error
+	Latency time.Duration
+}
+
+// HealthService runs readiness checks against the service's dependencies
+type HealthService struct {
+	Checks  []HealthCheck
+	Timeout time.Duration
+}
+
+// NewHealthService initializes a new HealthService
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) *HealthService {
+	return &HealthService{Checks: checks, Timeout: timeout}
+}
+
+// Run performs every check in parallel, each bounded by Timeout, and returns
+// the results in the order the checks were registered
+func (hs *HealthService) Run(ctx context.Context) []HealthResult {
+	results := make([]HealthResult, len(hs.Checks))
+	var wg sync.WaitGroup
+	for i, check := range hs.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, hs.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(checkCtx)
+			results[i] = HealthResult{Name: check.Name, Err: err, Latency: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// MongoHealthCheck pings the primary
+func MongoHealthCheck(client *mongo.Client) HealthCheck {
+	return HealthCheck{Name: "mongo", Check: func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}}
+}
+
+// BucketHealthCheck checks that the bucket exists and is reachable with the
+// service's credentials
+func BucketHealthCheck(client *s3.Client, bucket string) HealthCheck {
+	return HealthCheck{Name: "s3", Check: func(ctx context.Context) error {
+		start := time.Now()
+		_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucket})
+		metrics.ObserveStorage("head_bucket", start, err)
+		return err
+	}}
+}
+
+// ClamAVHealthCheck checks that clamd answers, since uploads are refused
+// while it is down
+func ClamAVHealthCheck(scanner *ClamAVScanner) HealthCheck {
+	return HealthCheck{Name: "clamd", Check: scanner.Ping}
+}
+
+// BinaryHealthCheck checks that an external tool, such as ffprobe, is found
+// at path, or on the PATH for a bare name, and runs
+func BinaryHealthCheck(name, path string) HealthCheck {
+	return HealthCheck{Name: name, Check: func(ctx context.Context) error {
+		path, err := exec.LookPath(path)
+		if err != nil {
+			return err
+		}
+		if out, err := exec.CommandContext(ctx, path, "-version").CombinedOutput(); err != nil {
+			return fmt.Errorf("%s -version failed: %w: %s", name, err, firstLine(out))
+		}
+		return nil
+	}}
+}
+
+// DiskSpaceHealthCheck checks that dir, where uploads are staged, has at
+// least minFree bytes available
+func DiskSpaceHealthCheck(dir string, minFree uint64) HealthCheck {
+	return HealthCheck{Name: "scratch_disk", Check: func(context.Context) error {
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s has %d bytes free, below the minimum of %d", dir, free, minFree)
+		}
+		return nil
+	}}
+}
+
+func firstLine(out []byte) string {
+	for i, b := range out {
+		if b == '\n' {
+			return string(out[:i])
+		}
+	}
+	return string(out)
+}
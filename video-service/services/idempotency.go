@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"video-service/idempotency"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	idempotencyInProgress = "in_progress"
+	idempotencyCompleted  = "completed"
+)
+
+// idempotencyDocument is a stored Idempotency-Key in the idempotency_keys
+// collection. Documents are removed by a TTL index on expires_at.
+type idempotencyDocument struct {
+	Key            string    `bson:"_id"`
+	Fingerprint    string    `bson:"fingerprint"`
+	Status         string    `bson:"status"`
+	LockedUntil    time.Time `bson:"locked_until"`
+	ResponseStatus int       `bson:"response_status,omitempty"`
+	ResponseType   string    `bson:"response_type,omitempty"`
+	ResponseBody   []byte    `bson:"response_body,omitempty"`
+	CreatedAt      time.Time `bson:"created_at"`
+	ExpiresAt      time.Time `bson:"expires_at"`
+}
+
+// IdempotencyService is the idempotency.Store that keeps keys in MongoDB
+type IdempotencyService struct {
+	DB *mongo.Database
+	// TTL is how long a key and its response are kept
+	TTL time.Duration
+	// LockTimeout is how long a request may hold a key before a retry may
+	// take it over, in case the original request died without finishing
+	LockTimeout time.Duration
+}
+
+// NewIdempotencyService initializes a new IdempotencyService
+func NewIdempotencyService(db *mongo.Database, ttl, lockTimeout time.Duration) *IdempotencyService {
+	return &IdempotencyService{DB: db, TTL: ttl, LockTimeout: lockTimeout}
+}
+
+// EnsureIdempotencyIndexes creates the TTL index that expires keys
+func (is *IdempotencyService) EnsureIdempotencyIndexes(ctx context.Context) error {
+	_, err := is.DB.Collection("idempotency_keys").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency index: %w", err)
+	}
+	return nil
+}
+
+func (is *IdempotencyService) Begin(ctx context.Context, key, fingerprint string) (*idempotency.Record, error) {
+	collection := is.DB.Collection("idempotency_keys")
+	now := time.Now()
+
+	_, err := collection.InsertOne(ctx, idempotencyDocument{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      idempotencyInProgress,
+		LockedUntil: now.Add(is.LockTimeout),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(is.TTL),
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+
+	// Take over a key whose request died while holding it
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": key, "fingerprint": fingerprint, "status": idempotencyInProgress, "locked_until": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"locked_until": now.Add(is.LockTimeout)}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take over idempotency key: %w", err)
+	}
+	if result.ModifiedCount == 1 {
+		return nil, nil
+	}
+
+	var doc idempotencyDocument
+	if err := collection.FindOne(ctx, bson.M{"_id": key}).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	return &idempotency.Record{
+		Fingerprint: doc.Fingerprint,
+		Completed:   doc.Status == idempotencyCompleted,
+		Status:      doc.ResponseStatus,
+		ContentType: doc.ResponseType,
+		Body:        doc.ResponseBody,
+	}, nil
+}
+
+func (is *IdempotencyService) Complete(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	_, err := is.DB.Collection("idempotency_keys").UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{
+		"status":          idempotencyCompleted,
+		"response_status": status,
+		"response_type":   contentType,
+		"response_body":   body,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (is *IdempotencyService) Release(ctx context.Context, key string) error {
+	_, err := is.DB.Collection("idempotency_keys").DeleteOne(ctx, bson.M{"_id": key, "status": idempotencyInProgress})
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+	"video-service/idempotency"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestIdempotencyServiceBegin(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	inserted := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+	duplicate := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+	tookOver := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	held := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0})
+	stored := func(mt *mtest.T, status string) bson.D {
+		return mtest.CreateCursorResponse(0, mt.DB.Name()+".idempotency_keys", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: "key"},
+			{Key: "fingerprint", Value: "fp"},
+			{Key: "status", Value: status},
+			{Key: "response_status", Value: 201},
+			{Key: "response_type", Value: "application/json"},
+			{Key: "response_body", Value: []byte(`{"id":"1"}`)},
+		})
+	}
+
+	tests := []struct {
+		name      string
+		responses func(mt *mtest.T) []bson.D
+		want      *idempotency.Record
+	}{
+		{
+			name:      "new key",
+			responses: func(*mtest.T) []bson.D { return []bson.D{inserted} },
+		},
+		{
+			name:      "takes over an expired lock",
+			responses: func(*mtest.T) []bson.D { return []bson.D{duplicate, tookOver} },
+		},
+		{
+			name: "in progress",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{duplicate, held, stored(mt, idempotencyInProgress)}
+			},
+			want: &idempotency.Record{Fingerprint: "fp", Status: 201, ContentType: "application/json", Body: []byte(`{"id":"1"}`)},
+		},
+		{
+			name: "completed",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{duplicate, held, stored(mt, idempotencyCompleted)}
+			},
+			want: &idempotency.Record{Fingerprint: "fp", Completed: true, Status: 201, ContentType: "application/json", Body: []byte(`{"id":"1"}`)},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			is := NewIdempotencyService(mt.DB, 24*time.Hour, time.Minute)
+			got, err := is.Begin(context.Background(), "key", "fp")
+			if err != nil {
+				mt.Fatalf("Begin() error = %v", err)
+			}
+			switch {
+			case tt.want == nil && got != nil:
+				mt.Errorf("Begin() = %+v, want the key claimed", got)
+			case tt.want != nil && (got == nil || got.Fingerprint != tt.want.Fingerprint || got.Completed != tt.want.Completed ||
+				got.Status != tt.want.Status || got.ContentType != tt.want.ContentType || string(got.Body) != string(tt.want.Body)):
+				mt.Errorf("Begin() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
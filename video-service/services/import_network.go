@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+	"video-service/apperrors"
+)
+
+// ErrAddressNotAllowed is returned when an import source resolves to an
+// address the service may not connect to
+var ErrAddressNotAllowed = apperrors.InvalidArgument("Source address is not allowed")
+
+// blockedPrefixes are never connected to unless allowlisted: the service's
+// own host, private and shared networks, and ranges that are not routable on
+// the internet. Loopback, private, link-local, multicast and unspecified
+// addresses are checked separately.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which embeds IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("fec0::/10"),       // Deprecated site-local
+}
+
+// NetworkPolicy decides which addresses imports and webhooks may connect to
+type NetworkPolicy struct {
+	Allowed []netip.Prefix // Networks allowed even though they are blocked by default
+}
+
+// ParseNetworkPolicy builds a policy allowing the given CIDR networks
+func ParseNetworkPolicy(allowed []string) (NetworkPolicy, error) {
+	var policy NetworkPolicy
+	for _, cidr := range allowed {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return policy, fmt.Errorf("invalid network %q: %w", cidr, err)
+		}
+		policy.Allowed = append(policy.Allowed, prefix.Masked())
+	}
+	return policy, nil
+}
+
+// Permits reports whether addr may be connected to
+func (p NetworkPolicy) Permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.Allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check resolves host and fails if any of its addresses is not permitted.
+// It lets requests fail fast; the dialer of NewClient enforces the policy
+// again on every connection, which also covers redirects and DNS changes.
+func (p NetworkPolicy) Check(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return apperrors.Wrap(apperrors.CodeInvalidArgument, err, "Source host could not be resolved").WithDetail("host", host)
+	}
+	for _, addr := range addrs {
+		if !p.Permits(addr) {
+			return ErrAddressNotAllowed.WithDetail("host", host)
+		}
+	}
+	return nil
+}
+
+// control rejects connections to addresses the policy does not permit. It
+// runs after DNS resolution, right before each connection is made.
+func (p NetworkPolicy) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unexpected address %q: %w", address, err)
+	}
+	if !p.Permits(addrPort.Addr()) {
+		return ErrAddressNotAllowed
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client that only connects to addresses the
+// policy permits. Environment proxies are ignored, since they would hide the
+// real destination from the check.
+func (p NetworkPolicy) NewClient(connectTimeout, headerTimeout time.Duration, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second, Control: p.control}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: headerTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return apperrors.Unprocessable(fmt.Sprintf("Source redirected more than %d times", maxRedirects))
+			}
+			return checkSourceURL(req.URL)
+		},
+	}
+}
+
+// checkSourceURL accepts absolute http and https URLs without credentials,
+// which belong in headers rather than in the stored source URL
+func checkSourceURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apperrors.InvalidArgument("source_url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return apperrors.InvalidArgument("source_url must not contain credentials; send them in headers")
+	}
+	return nil
+}
+
+// isAddressNotAllowed reports whether err, possibly wrapped by net/http, was
+// caused by the network policy
+func isAddressNotAllowed(err error) bool {
+	return errors.Is(err, ErrAddressNotAllowed)
+}
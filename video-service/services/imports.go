@@ -0,0 +1,649 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/models"
+	"video-service/tracing"
+	"video-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxImportHeaders caps the number of headers sent to an import source
+const MaxImportHeaders = 20
+
+// Causes of a cancelled import, reported as its error
+var (
+	errImportTimedOut    = apperrors.Unavailable("Import took too long")
+	errImportStalled     = apperrors.Unavailable("Source stopped sending data")
+	errImportCancelled   = apperrors.Conflict("Import was cancelled")
+	errImportInterrupted = apperrors.Unavailable("Import was interrupted by a restart")
+	ErrTooManyImports    = apperrors.Unavailable("Too many imports in progress, try again later")
+)
+
+// forbiddenImportHeaders are managed by the HTTP client and may not be set
+// by callers
+var forbiddenImportHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Transfer-Encoding": true, "Connection": true,
+	"Keep-Alive": true, "Upgrade": true, "Te": true, "Trailer": true, "Expect": true,
+	"Proxy-Authorization": true, "Proxy-Connection": true,
+}
+
+// activeImport matches videos whose import has not finished
+var activeImport = bson.M{"$in": bson.A{models.StatusImporting, models.StatusProcessing}}
+
+// ImportLimits bounds remote imports. The size of an import is limited like
+// an upload, by QuotaLimits.MaxFileSize.
+type ImportLimits struct {
+	Concurrency int           // Imports run at once by this replica
+	Timeout     time.Duration // Cap on downloading and processing one import
+	IdleTimeout time.Duration // Longest the source may go without sending data
+}
+
+// ImportRequest asks for a video to be downloaded from SourceURL
+type ImportRequest struct {
+	SourceURL string
+	Headers   map[string]string // Sent to the source, never stored
+	Details   VideoDetails
+}
+
+// importJob is an accepted import waiting to be run
+type importJob struct {
+	videoID   primitive.ObjectID
+	ownerID   string
+	source    *url.URL
+	headers   http.Header
+	fileName  string
+	reserved  int64 // Quota held, beyond the upload count taken by Start
+	cancelled func(error)
+}
+
+// VideoImporter downloads videos from remote URLs in the background. The
+// video exists from the moment the import is accepted, and its status and
+// import progress are updated as the download goes.
+type VideoImporter struct {
+	Videos *VideoService
+	Quotas *QuotaService
+	Policy NetworkPolicy
+	Client *http.Client
+	Limits ImportLimits
+	// ProgressInterval is how often a running import saves its progress
+	ProgressInterval time.Duration
+	// StaleAfter is how long an import may go without saving progress
+	// before it is presumed lost with its replica and failed
+	StaleAfter time.Duration
+
+	jobs  chan *importJob
+	slots chan struct{}
+}
+
+// NewVideoImporter initializes a new VideoImporter
+func NewVideoImporter(videos *VideoService, quotas *QuotaService, policy NetworkPolicy, client *http.Client, limits ImportLimits) *VideoImporter {
+	if limits.Concurrency < 1 {
+		limits.Concurrency = 1
+	}
+	return &VideoImporter{
+		Videos:           videos,
+		Quotas:           quotas,
+		Policy:           policy,
+		Client:           client,
+		Limits:           limits,
+		ProgressInterval: 5 * time.Second,
+		StaleAfter:       5 * time.Minute,
+		jobs:             make(chan *importJob),
+		slots:            make(chan struct{}, limits.Concurrency),
+	}
+}
+
+// Start validates an import, saves its video with status importing and
+// hands it to Run. The upload counts against the owner's daily limit at
+// once; storage quota is reserved when the source's size is known.
+func (im *VideoImporter) Start(ctx context.Context, req ImportRequest) (*models.VideoMetadata, error) {
+	source, err := url.Parse(req.SourceURL)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("source_url is not a valid URL")
+	}
+	if err := checkSourceURL(source); err != nil {
+		return nil, err
+	}
+	headers, err := importHeaders(req.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := im.Policy.Check(ctx, source.Hostname()); err != nil {
+		return nil, err
+	}
+
+	fileName := path.Base(source.Path)
+	if fileName == "/" || fileName == "." {
+		fileName = "import"
+	}
+	details := req.Details
+	if details.Title == "" {
+		details.Title = strings.TrimSuffix(fileName, path.Ext(fileName))
+	}
+	if err := details.Visibility.Validate(); err != nil {
+		return nil, err
+	}
+	if err := details.Schedule.Validate(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case im.slots <- struct{}{}:
+	default:
+		return nil, ErrTooManyImports
+	}
+	started := false
+	defer func() {
+		if !started {
+			<-im.slots
+		}
+	}()
+
+	if err := im.Quotas.Reserve(ctx, details.OwnerID, 0); err != nil {
+		return nil, err
+	}
+	metadata, err := im.Videos.createImport(ctx, details, source)
+	if err != nil {
+		im.Quotas.Release(ctx, details.OwnerID, 0)
+		return nil, err
+	}
+
+	job := &importJob{videoID: metadata.ID, ownerID: details.OwnerID, source: source, headers: headers, fileName: fileName}
+	select {
+	case im.jobs <- job:
+		started = true
+		return metadata, nil
+	case <-ctx.Done():
+		im.fail(context.WithoutCancel(ctx), job, ctx.Err())
+		return nil, ctx.Err()
+	}
+}
+
+// Run runs imports handed over by Start until ctx is cancelled, failing the
+// ones still running, and periodically fails imports abandoned by replicas
+// that stopped. It returns once every import has ended.
+func (im *VideoImporter) Run(ctx context.Context) {
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	ticker := time.NewTicker(im.StaleAfter / 2)
+	defer ticker.Stop()
+	im.sweep(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-im.jobs:
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				defer func() { <-im.slots }()
+				im.run(ctx, job)
+			}()
+		case <-ticker.C:
+			im.sweep(ctx)
+		}
+	}
+}
+
+// sweep fails imports whose progress has not been saved for StaleAfter
+func (im *VideoImporter) sweep(ctx context.Context) {
+	start := time.Now()
+	failed, err := im.Videos.failStaleImports(ctx, time.Now().Add(-im.StaleAfter), im.Quotas)
+	metrics.ObserveJobTick("importer", start, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fail stale imports", logging.Err(err))
+	}
+	if failed > 0 {
+		slog.WarnContext(ctx, "Failed interrupted imports", slog.Int("count", failed))
+	}
+}
+
+// run downloads and processes one import, recording the outcome
+func (im *VideoImporter) run(ctx context.Context, job *importJob) {
+	ctx = logging.With(ctx, slog.String("video_id", job.videoID.Hex()))
+	ctx, span := tracing.Start(ctx, "video.import", attribute.String("import.host", job.source.Host))
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ctx, cancelTimeout := context.WithTimeoutCause(ctx, im.Limits.Timeout, errImportTimedOut)
+	defer cancelTimeout()
+	job.cancelled = cancel
+
+	start := time.Now()
+	metadata, err := im.download(ctx, job)
+	metrics.UploadDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+	tracing.End(span, err)
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil && ctx.Err() != nil {
+			err = cause
+		}
+		if infected, ok := AsInfected(err); ok {
+			im.reject(context.WithoutCancel(ctx), job, infected)
+			return
+		}
+		im.fail(context.WithoutCancel(ctx), job, err)
+		return
+	}
+	metrics.UploadBytes.Observe(float64(metadata.Size))
+	slog.InfoContext(ctx, "Imported video", slog.Int64("size", metadata.Size))
+}
+
+// download fetches the source and streams it through the normal upload
+// processing, then marks the video ready
+func (im *VideoImporter) download(ctx context.Context, job *importJob) (*models.VideoMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, job.source.String(), nil)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("source_url is not a valid URL")
+	}
+	req.Header = job.headers.Clone()
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", "video-service-import/1.0")
+	}
+
+	resp, err := im.Client.Do(req)
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, apperrors.Unprocessable(fmt.Sprintf("Source returned HTTP %d", resp.StatusCode)).WithDetail("status", resp.StatusCode)
+	}
+
+	maxSize := im.Quotas.Limits.MaxFileSize
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, utils.ErrFileTooLarge
+	}
+	contentType := sourceContentType(resp.Header.Get("Content-Type"), job.fileName)
+	if contentType == "" {
+		return nil, apperrors.Unsupported(fmt.Sprintf("Unsupported file type: %s", resp.Header.Get("Content-Type")))
+	}
+
+	// Hold storage for the declared size, or the largest allowed upload,
+	// and settle on the bytes actually stored
+	estimate := resp.ContentLength
+	if estimate < 0 {
+		estimate = maxSize
+	}
+	if err := im.Quotas.Adjust(ctx, job.ownerID, estimate); err != nil {
+		return nil, err
+	}
+	job.reserved = estimate
+
+	progress := &importProgress{total: resp.ContentLength, reserved: estimate}
+	stopReporting := im.report(ctx, job, progress)
+	body := &utils.SizeLimitedReader{R: newIdleReader(progress.reader(resp.Body), im.Limits.IdleTimeout, job.cancelled), Limit: maxSize}
+	videoURL, duration, err := im.Videos.ProcessAndUploadVideo(ctx, NewObjectKey(job.ownerID, job.fileName), contentType, body)
+	stopReporting()
+	if body.Exceeded() {
+		im.Videos.RemoveFiles(ctx, videoURL)
+		return nil, utils.ErrFileTooLarge
+	}
+	if err != nil {
+		return nil, sourceError(err)
+	}
+
+	size := progress.downloaded.Load()
+	if err := im.Quotas.Adjust(ctx, job.ownerID, size-job.reserved); err != nil {
+		im.Videos.RemoveFiles(ctx, videoURL)
+		return nil, err
+	}
+	job.reserved = size
+	metadata, err := im.Videos.completeImport(ctx, job.videoID, videoURL, duration, size, contentType)
+	if err != nil {
+		im.Videos.RemoveFiles(ctx, videoURL)
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// report saves progress every ProgressInterval until the returned function
+// is called. An import whose video was deleted or failed meanwhile is
+// cancelled.
+func (im *VideoImporter) report(ctx context.Context, job *importJob, progress *importProgress) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(im.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			active, err := im.Videos.saveImportProgress(ctx, job.videoID, progress)
+			if err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "Failed to save import progress", logging.Err(err))
+			}
+			if err == nil && !active {
+				job.cancelled(errImportCancelled)
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// fail marks the import failed with a client-safe reason, records a
+// video.import_failed event and returns the quota it held. Whoever marks an
+// import failed returns its quota, so an import already failed by a sweep
+// is left alone.
+func (im *VideoImporter) fail(ctx context.Context, job *importJob, err error) {
+	reason := importFailureReason(err)
+	slog.ErrorContext(ctx, "Import failed", slog.String("reason", reason), logging.Err(err))
+
+	filter := bson.M{"_id": job.videoID, "status": activeImport}
+	_, _, err = im.Videos.failImport(ctx, filter, reason)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err != nil {
+		// The sweep fails the import and returns its quota later
+		slog.ErrorContext(ctx, "Failed to record import failure", logging.Err(err))
+		return
+	}
+	im.Quotas.Release(ctx, job.ownerID, job.reserved)
+}
+
+// reject marks an import whose download was infected rejected, records a
+// video.rejected event and returns the quota it held
+func (im *VideoImporter) reject(ctx context.Context, job *importJob, infected *InfectedError) {
+	slog.WarnContext(ctx, "Import rejected", slog.String("signature", infected.Signature))
+
+	_, _, err := im.Videos.rejectImport(ctx, job.videoID, infected)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record import rejection", logging.Err(err))
+		return
+	}
+	im.Quotas.Release(ctx, job.ownerID, job.reserved)
+}
+
+// importHeaders validates the headers to send to a source
+func importHeaders(headers map[string]string) (http.Header, error) {
+	if len(headers) > MaxImportHeaders {
+		return nil, apperrors.InvalidArgument(fmt.Sprintf("At most %d headers can be sent", MaxImportHeaders)).WithDetail("max", MaxImportHeaders)
+	}
+	out := http.Header{}
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, apperrors.InvalidArgument("Invalid header").WithDetail("header", name)
+		}
+		if forbiddenImportHeaders[canonical] {
+			return nil, apperrors.InvalidArgument(fmt.Sprintf("Header %s cannot be set", canonical)).WithDetail("header", canonical)
+		}
+		out.Set(canonical, value)
+	}
+	return out, nil
+}
+
+// sourceContentType returns the video content type declared by the source,
+// falling back to the file name's extension for generic types
+func sourceContentType(header, fileName string) string {
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil && utils.IsVideoContentType(mediaType) {
+		return mediaType
+	}
+	return utils.VideoContentTypeByExtension(fileName)
+}
+
+// sourceError keeps typed errors and hides transport details, which may
+// describe the service's own network, behind a generic message
+func sourceError(err error) error {
+	if isAddressNotAllowed(err) {
+		return ErrAddressNotAllowed
+	}
+	if _, ok := apperrors.As(err); ok {
+		return err
+	}
+	return apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to download from source")
+}
+
+// importFailureReason is the message stored on a failed import
+func importFailureReason(err error) string {
+	if appErr, ok := apperrors.As(err); ok && appErr.Message != "" {
+		return appErr.Message
+	}
+	if errors.Is(err, context.Canceled) {
+		return errImportInterrupted.Message
+	}
+	return "Import failed"
+}
+
+// importProgress counts the bytes read from a source
+type importProgress struct {
+	downloaded atomic.Int64
+	finished   atomic.Bool // The source has been read to the end
+	total      int64       // Declared size, or -1
+	reserved   int64
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress *importProgress
+}
+
+func (p *importProgress) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, progress: p}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.progress.downloaded.Add(int64(n))
+	if err == io.EOF {
+		r.progress.finished.Store(true)
+	}
+	return n, err
+}
+
+// idleReader cancels the import when a read has not returned data for
+// timeout
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+	limit time.Duration
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, cancel func(error)) *idleReader {
+	return &idleReader{r: r, limit: timeout, timer: time.AfterFunc(timeout, func() { cancel(errImportStalled) })}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.timer.Stop()
+	} else if n > 0 {
+		r.timer.Reset(r.limit)
+	}
+	return n, err
+}
+
+// createImport saves the video of a new import. No event is recorded until
+// the import completes or fails.
+func (vs *VideoService) createImport(ctx context.Context, details VideoDetails, source *url.URL) (*models.VideoMetadata, error) {
+	stored := *source
+	stored.RawQuery, stored.Fragment = "", ""
+	now := time.Now()
+	metadata := models.VideoMetadata{
+		OwnerID:    details.OwnerID,
+		Title:      details.Title,
+		Tags:       details.Tags,
+		UploadedAt: now,
+		Status:     models.StatusImporting,
+		Import:     &models.ImportState{SourceURL: stored.String(), UpdatedAt: now},
+	}
+	if err := applyVisibility(&metadata, details.Visibility); err != nil {
+		return nil, err
+	}
+	if err := applySchedule(&metadata, details.Schedule); err != nil {
+		return nil, err
+	}
+
+	result, err := vs.DB.Collection("videos").InsertOne(ctx, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save import: %w", err)
+	}
+	metadata.ID = result.InsertedID.(primitive.ObjectID)
+	return &metadata, nil
+}
+
+// saveImportProgress records progress and reports whether the import is
+// still wanted: not deleted and not failed by a sweep
+func (vs *VideoService) saveImportProgress(ctx context.Context, id primitive.ObjectID, progress *importProgress) (bool, error) {
+	set := bson.M{
+		"import.bytes_downloaded": progress.downloaded.Load(),
+		"import.reserved_bytes":   progress.reserved,
+		"import.updated_at":       time.Now(),
+	}
+	if progress.total > 0 {
+		set["import.bytes_total"] = progress.total
+	}
+	if progress.finished.Load() {
+		set["status"] = models.StatusProcessing
+	}
+	result, err := vs.DB.Collection("videos").UpdateOne(ctx,
+		bson.M{"_id": id, "status": activeImport, "deleted_at": nil},
+		bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// completeImport marks an import ready, or queues it for moderation, and
+// records its video.uploaded event. Files of public videos are then published.
+func (vs *VideoService) completeImport(ctx context.Context, id primitive.ObjectID, videoURL string, duration int, size int64, contentType string) (*models.VideoMetadata, error) {
+	now := time.Now()
+	set := bson.M{
+		"status":                  models.StatusReady,
+		"url":                     videoURL,
+		"duration":                duration,
+		"size":                    size,
+		"content_type":            contentType,
+		"import.bytes_downloaded": size,
+		"import.reserved_bytes":   int64(0),
+		"import.updated_at":       now,
+	}
+	if vs.Moderated {
+		set["status"] = models.StatusModerating
+		set["moderation"] = models.ModerationState{QueuedAt: now}
+	}
+	update := bson.M{"$set": set}
+	metadata, _, err := vs.finishImport(ctx, bson.M{"_id": id, "status": activeImport}, update, EventVideoUploaded)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errImportCancelled
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The import is complete either way; a video left private can be fixed by
+	// setting its visibility again
+	if mediaReadable(metadata) {
+		if err := vs.syncMediaACL(ctx, metadata); err != nil {
+			slog.ErrorContext(ctx, "Failed to publish imported video", slog.String("video_id", id.Hex()), logging.Err(err))
+		}
+	}
+	return metadata, nil
+}
+
+// failImport marks the import matching filter failed and records its
+// video.import_failed event. It returns the quota the import held.
+func (vs *VideoService) failImport(ctx context.Context, filter bson.M, reason string) (*models.VideoMetadata, int64, error) {
+	update := bson.M{"$set": bson.M{
+		"status":                models.StatusFailed,
+		"import.error":          reason,
+		"import.reserved_bytes": int64(0),
+		"import.updated_at":     time.Now(),
+	}}
+	return vs.finishImport(ctx, filter, update, EventVideoImportFailed)
+}
+
+// rejectImport marks an active import rejected for the malware found in it
+// and records its video.rejected event. It returns the quota the import held.
+func (vs *VideoService) rejectImport(ctx context.Context, id primitive.ObjectID, infected *InfectedError) (*models.VideoMetadata, int64, error) {
+	now := time.Now()
+	update := bson.M{"$set": bson.M{
+		"status":                models.StatusRejected,
+		"rejection":             newMalwareRejection(infected, now),
+		"import.reserved_bytes": int64(0),
+		"import.updated_at":     now,
+	}}
+	return vs.finishImport(ctx, bson.M{"_id": id, "status": activeImport}, update, EventVideoRejected)
+}
+
+// finishImport applies update to the import matching filter and records
+// eventType in the same transaction. It also returns the quota the import
+// held before the update.
+func (vs *VideoService) finishImport(ctx context.Context, filter, update bson.M, eventType EventType) (*models.VideoMetadata, int64, error) {
+	var before, after models.VideoMetadata
+	err := vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		collection := vs.DB.Collection("videos")
+		if err := collection.FindOne(sc, filter).Decode(&before); err != nil {
+			return err
+		}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := collection.FindOneAndUpdate(sc, bson.M{"_id": before.ID}, update, opts).Decode(&after); err != nil {
+			return err
+		}
+		return vs.recordEvent(sc, eventType, &after)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var reserved int64
+	if before.Import != nil {
+		reserved = before.Import.ReservedBytes
+	}
+	return &after, reserved, nil
+}
+
+// failStaleImports fails imports whose progress was last saved before
+// cutoff, returning their quota, and reports how many it failed
+func (vs *VideoService) failStaleImports(ctx context.Context, cutoff time.Time, quotas *QuotaService) (int, error) {
+	filter := bson.M{"status": activeImport, "import.updated_at": bson.M{"$lt": cutoff}}
+	failed := 0
+	for ctx.Err() == nil {
+		metadata, reserved, err := vs.failImport(ctx, filter, errImportInterrupted.Message)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return failed, nil
+		}
+		if err != nil {
+			return failed, fmt.Errorf("failed to fail stale import: %w", err)
+		}
+		quotas.Release(ctx, metadata.OwnerID, reserved)
+		failed++
+	}
+	return failed, ctx.Err()
+}
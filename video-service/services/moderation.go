@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/models"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotAwaitingModeration is returned when a moderator decides on a video
+// that is not waiting for a decision
+var ErrNotAwaitingModeration = apperrors.Conflict("Video is not awaiting moderation")
+
+// awaitingModeration matches videos that moderators may still decide on
+var awaitingModeration = bson.M{"$in": bson.A{models.StatusModerating, models.StatusInReview}}
+
+// holdForModeration queues a newly stored video for moderation, if enabled
+func (vs *VideoService) holdForModeration(metadata *models.VideoMetadata, at time.Time) {
+	if vs.Moderated {
+		metadata.Status = models.StatusModerating
+		metadata.Moderation = &models.ModerationState{QueuedAt: at}
+	}
+}
+
+// ModerationQueue returns a page of videos with the given status, in_review
+// or moderating, oldest first
+func (vs *VideoService) ModerationQueue(ctx context.Context, status models.Status, limit, offset int64) ([]models.VideoMetadata, error) {
+	if status != models.StatusInReview && status != models.StatusModerating {
+		return nil, apperrors.InvalidArgument("status must be in_review or moderating").WithDetail("status", status)
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "moderation.queued_at", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit).SetSkip(offset)
+	cursor, err := vs.DB.Collection("videos").Find(ctx, bson.M{"status": status, "deleted_at": nil}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list moderation queue: %w", err)
+	}
+	videos := []models.VideoMetadata{}
+	if err := cursor.All(ctx, &videos); err != nil {
+		return nil, fmt.Errorf("failed to decode moderation queue: %w", err)
+	}
+	return videos, nil
+}
+
+// ApproveVideo releases a video awaiting moderation on a moderator's behalf
+func (vs *VideoService) ApproveVideo(ctx context.Context, id, moderatorID, reason string) (*models.VideoMetadata, error) {
+	return vs.reviewVideo(ctx, id, func(filter bson.M) (*models.VideoMetadata, error) {
+		return vs.approveVideo(ctx, filter, reviewDecision(moderatorID, reason))
+	})
+}
+
+// RejectVideo refuses a video awaiting moderation on a moderator's behalf.
+// Its files are kept private.
+func (vs *VideoService) RejectVideo(ctx context.Context, id, moderatorID, reason string) (*models.VideoMetadata, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, apperrors.InvalidArgument("A reason is required to reject a video")
+	}
+	return vs.reviewVideo(ctx, id, func(filter bson.M) (*models.VideoMetadata, error) {
+		return vs.rejectVideo(ctx, filter, reason, reviewDecision(moderatorID, reason))
+	})
+}
+
+// reviewVideo applies a moderator's decision to the video with the given ID,
+// provided it is still awaiting one
+func (vs *VideoService) reviewVideo(ctx context.Context, id string, decide func(filter bson.M) (*models.VideoMetadata, error)) (*models.VideoMetadata, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("Invalid video ID format").WithDetail("id", id)
+	}
+	metadata, err := decide(bson.M{"_id": objectID, "status": awaitingModeration, "deleted_at": nil})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := vs.GetVideoMetadata(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotAwaitingModeration.WithDetail("id", id)
+	}
+	return metadata, err
+}
+
+func reviewDecision(moderatorID, reason string) bson.M {
+	return bson.M{
+		"moderation.reviewed_by": moderatorID,
+		"moderation.reason":      reason,
+		"moderation.decided_at":  time.Now(),
+	}
+}
+
+// approveVideo marks the video matching filter ready with the fields in set
+// and records a video.approved event. The files of a public video are only
+// published once the update has gone through, so a video rejected meanwhile
+// never has its files exposed.
+func (vs *VideoService) approveVideo(ctx context.Context, filter, set bson.M) (*models.VideoMetadata, error) {
+	set["status"] = models.StatusReady
+	video, err := vs.settleModeration(ctx, filter, set, EventVideoApproved, "approved")
+	if err != nil {
+		return nil, err
+	}
+	// The approval stands either way; a video left private can be fixed by
+	// setting its visibility again
+	if mediaReadable(video) {
+		if err := vs.syncMediaACL(ctx, video); err != nil {
+			slog.ErrorContext(ctx, "Failed to publish approved video", slog.String("video_id", video.ID.Hex()), logging.Err(err))
+		}
+	}
+	return video, nil
+}
+
+// rejectVideo marks the video matching filter rejected for reason, with the
+// fields in set, and records a video.rejected event
+func (vs *VideoService) rejectVideo(ctx context.Context, filter bson.M, reason string, set bson.M) (*models.VideoMetadata, error) {
+	set["status"] = models.StatusRejected
+	set["rejection"] = models.Rejection{Reason: reason, RejectedAt: time.Now()}
+	return vs.settleModeration(ctx, filter, set, EventVideoRejected, "rejected")
+}
+
+// queueForReview sends the video matching filter to the moderators' queue
+func (vs *VideoService) queueForReview(ctx context.Context, filter, set bson.M) (*models.VideoMetadata, error) {
+	set["status"] = models.StatusInReview
+	return vs.settleModeration(ctx, filter, set, "", "review")
+}
+
+// settleModeration applies set to the video matching filter, ends any
+// worker's claim on it and records eventType, if any, in the same
+// transaction
+func (vs *VideoService) settleModeration(ctx context.Context, filter, set bson.M, eventType EventType, decision string) (*models.VideoMetadata, error) {
+	var after models.VideoMetadata
+	err := vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		update := bson.M{"$set": set, "$unset": bson.M{"moderation.claimed_until": ""}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := vs.DB.Collection("videos").FindOneAndUpdate(sc, filter, update, opts).Decode(&after); err != nil {
+			return err
+		}
+		if eventType == "" {
+			return nil
+		}
+		return vs.recordEvent(sc, eventType, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	by := "rules"
+	if after.Moderation != nil && after.Moderation.ReviewedBy != "" {
+		by = "moderator"
+	}
+	metrics.ModerationDecisions.WithLabelValues(decision, by).Inc()
+	return &after, nil
+}
+
+// PresignVideo returns a time-limited link to a stored file, so moderators
+// can watch videos that are not public yet
+func (vs *VideoService) PresignVideo(ctx context.Context, location string, ttl time.Duration) (string, error) {
+	key, ok := vs.ObjectKey(location)
+	if !ok {
+		return "", nil
+	}
+	req, err := s3.NewPresignClient(vs.S3Client).PresignGetObject(ctx,
+		&s3.GetObjectInput{Bucket: &vs.Bucket, Key: &key}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign link to %s: %w", key, err)
+	}
+	return req.URL, nil
+}
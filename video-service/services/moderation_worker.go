@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/models"
+	"video-service/moderation"
+	"video-service/tracing"
+	"video-service/utils"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ModerationWorker classifies videos waiting for moderation and applies the
+// rules to their labels. Videos are claimed one at a time with a lease, so
+// several replicas can run workers side by side.
+type ModerationWorker struct {
+	Videos      *VideoService
+	Classifiers []Classifier
+	Rules       []moderation.Rule
+	FFmpegPath  string
+	Frames      int           // Frames sampled from each video
+	MaxAttempts int           // Failed classifications before a video goes to review
+	Timeout     time.Duration // Longest one video may take; failed attempts retry after it
+	Interval    time.Duration
+}
+
+// NewModerationWorker initializes a new ModerationWorker
+func NewModerationWorker(videos *VideoService, classifiers []Classifier, rules []moderation.Rule, interval time.Duration) *ModerationWorker {
+	return &ModerationWorker{
+		Videos:      videos,
+		Classifiers: classifiers,
+		Rules:       rules,
+		FFmpegPath:  "ffmpeg",
+		Frames:      8,
+		MaxAttempts: 3,
+		Timeout:     10 * time.Minute,
+		Interval:    interval,
+	}
+}
+
+// Run classifies waiting videos every Interval until ctx is cancelled
+func (w *ModerationWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		err := w.Tick(ctx)
+		metrics.ObserveJobTick("moderation_worker", start, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "Moderation worker tick failed", logging.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick classifies every video that is waiting and not claimed
+func (w *ModerationWorker) Tick(ctx context.Context) error {
+	for ctx.Err() == nil {
+		video, err := w.claim(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.moderate(ctx, video); err != nil {
+			slog.ErrorContext(ctx, "Failed to record moderation", slog.String("video_id", video.ID.Hex()), logging.Err(err))
+		}
+	}
+	return ctx.Err()
+}
+
+// Pending counts the videos waiting for the classifiers
+func (w *ModerationWorker) Pending(ctx context.Context) (int64, error) {
+	return w.Videos.DB.Collection("videos").CountDocuments(ctx, bson.M{"status": models.StatusModerating, "deleted_at": nil})
+}
+
+// InReview counts the videos waiting for a moderator
+func (w *ModerationWorker) InReview(ctx context.Context) (int64, error) {
+	return w.Videos.DB.Collection("videos").CountDocuments(ctx, bson.M{"status": models.StatusInReview, "deleted_at": nil})
+}
+
+// claim takes the video that has waited longest, leasing it for Timeout and
+// counting the attempt
+func (w *ModerationWorker) claim(ctx context.Context) (*models.VideoMetadata, error) {
+	now := time.Now()
+	var video models.VideoMetadata
+	err := w.Videos.DB.Collection("videos").FindOneAndUpdate(ctx,
+		bson.M{
+			"status":     models.StatusModerating,
+			"deleted_at": nil,
+			"$or": bson.A{
+				bson.M{"moderation.claimed_until": nil},
+				bson.M{"moderation.claimed_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{"moderation.claimed_until": now.Add(w.Timeout)},
+			"$inc": bson.M{"moderation.attempts": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "moderation.queued_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&video)
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// moderate classifies a claimed video and approves, rejects or queues it for
+// review. Failed classifications are retried once the lease expires, and go
+// to review after MaxAttempts.
+func (w *ModerationWorker) moderate(ctx context.Context, video *models.VideoMetadata) (err error) {
+	ctx, span := tracing.Start(ctx, "moderation.classify", attribute.String("video.id", video.ID.Hex()))
+	defer func() { tracing.End(span, err) }()
+
+	// Only the worker holding the lease may settle the video
+	filter := bson.M{
+		"_id":                      video.ID,
+		"status":                   models.StatusModerating,
+		"moderation.claimed_until": video.Moderation.ClaimedUntil,
+	}
+
+	classifyCtx, cancel := context.WithTimeout(ctx, w.Timeout)
+	labels, classifyErr := w.classify(classifyCtx, video)
+	cancel()
+
+	now := time.Now()
+	if classifyErr != nil {
+		slog.WarnContext(ctx, "Failed to classify video",
+			slog.String("video_id", video.ID.Hex()),
+			slog.Int("attempt", video.Moderation.Attempts),
+			logging.Err(classifyErr))
+		set := bson.M{"moderation.error": classifyErr.Error()}
+		if video.Moderation.Attempts < w.MaxAttempts {
+			_, err = w.Videos.DB.Collection("videos").UpdateOne(ctx, filter, bson.M{"$set": set})
+			return err
+		}
+		set["moderation.reason"] = "Classification failed"
+		_, err = w.Videos.queueForReview(ctx, filter, set)
+		return ignoreSettled(err)
+	}
+
+	verdict := moderation.Decide(w.Rules, labels)
+	set := bson.M{
+		"moderation.labels":        labels,
+		"moderation.rule":          verdict.Rule,
+		"moderation.reason":        verdict.Reason(),
+		"moderation.error":         "",
+		"moderation.classified_at": now,
+	}
+	switch verdict.Action {
+	case moderation.Approve:
+		set["moderation.decided_at"] = now
+		_, err = w.Videos.approveVideo(ctx, filter, set)
+	case moderation.Reject:
+		set["moderation.decided_at"] = now
+		_, err = w.Videos.rejectVideo(ctx, filter, "Rejected by moderation: "+verdict.Label.Name, set)
+	default:
+		_, err = w.Videos.queueForReview(ctx, filter, set)
+	}
+	return ignoreSettled(err)
+}
+
+// ignoreSettled drops the error for a video that was deleted, or decided by a
+// moderator, while it was being classified
+func ignoreSettled(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// classify runs every classifier over the video's title, tags and, unless
+// they all ignore them, frames sampled from its file and thumbnail
+func (w *ModerationWorker) classify(ctx context.Context, video *models.VideoMetadata) ([]models.ModerationLabel, error) {
+	input := ModerationInput{Title: video.Title, Tags: video.Tags}
+	if w.needsFrames() {
+		dir, err := os.MkdirTemp(w.Videos.ScratchDir, "moderation-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+
+		if w.Frames > 0 {
+			if input.Frames, err = w.sample(ctx, video.URL, dir, "video", video.Duration, w.Frames); err != nil {
+				return nil, err
+			}
+		}
+		if video.Thumbnail != "" {
+			frames, err := w.sample(ctx, video.Thumbnail, dir, "thumbnail", 0, 1)
+			if err != nil {
+				return nil, err
+			}
+			input.Frames = append(input.Frames, frames...)
+		}
+	}
+
+	labels := []models.ModerationLabel{}
+	for _, classifier := range w.Classifiers {
+		found, err := classifier.Classify(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, found...)
+	}
+	return labels, nil
+}
+
+func (w *ModerationWorker) needsFrames() bool {
+	for _, classifier := range w.Classifiers {
+		if text, ok := classifier.(textClassifier); !ok || !text.TextOnly() {
+			return true
+		}
+	}
+	return false
+}
+
+// sample downloads the stored file at location into dir and extracts count
+// frames from it
+func (w *ModerationWorker) sample(ctx context.Context, location, dir, name string, duration, count int) ([]string, error) {
+	vs := w.Videos
+	key, ok := vs.ObjectKey(location)
+	if !ok {
+		return nil, fmt.Errorf("%s is not stored in the configured bucket", location)
+	}
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	_, err = manager.NewDownloader(vs.S3Client).Download(ctx, file, &s3.GetObjectInput{Bucket: &vs.Bucket, Key: &key})
+	metrics.ObserveStorage("download", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return utils.SampleFrames(ctx, w.FFmpegPath, file.Name(), dir, name, duration, count)
+}
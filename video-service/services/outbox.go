@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"video-service/models"
+	"video-service/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRecord is a domain event waiting in the outbox collection until the
+// relay has handed it to the broker
+type outboxRecord struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Type        EventType          `bson:"type"`
+	VideoID     string             `bson:"video_id"`
+	OwnerID     string             `bson:"owner_id"`
+	Sequence    int64              `bson:"sequence"`
+	OccurredAt  time.Time          `bson:"occurred_at"`
+	PublishedAt *time.Time         `bson:"published_at"`
+	Attempts    int                `bson:"attempts"`
+	LastError   string             `bson:"last_error,omitempty"`
+	// PublishedTo names the targets that accepted the event while another failed
+	PublishedTo []string `bson:"published_to,omitempty"`
+	// TraceContext links the relay's publish to the request that recorded the event
+	TraceContext map[string]string `bson:"trace_context,omitempty"`
+}
+
+func (r *outboxRecord) event() VideoEvent {
+	return VideoEvent{
+		ID:         r.ID.Hex(),
+		Type:       r.Type,
+		VideoID:    r.VideoID,
+		OwnerID:    r.OwnerID,
+		Sequence:   r.Sequence,
+		OccurredAt: r.OccurredAt,
+	}
+}
+
+// errIndexOptionsConflict is the server's code for an index that exists with
+// other options
+const errIndexOptionsConflict = 85
+
+// EnsureOutboxIndexes creates the index the relay polls, which also removes
+// published events once retention has passed. If the index was created with
+// another retention, it is changed in place.
+func (vs *VideoService) EnsureOutboxIndexes(ctx context.Context, retention time.Duration) error {
+	keys := bson.D{{Key: "published_at", Value: 1}}
+	ttl := int32(retention.Seconds())
+	_, err := vs.DB.Collection("outbox").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetExpireAfterSeconds(ttl),
+	})
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(errIndexOptionsConflict) {
+		err = vs.DB.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: "outbox"},
+			{Key: "index", Value: bson.D{{Key: "keyPattern", Value: keys}, {Key: "expireAfterSeconds", Value: ttl}}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create outbox index: %w", err)
+	}
+	return nil
+}
+
+// inTransaction runs fn in a MongoDB transaction, so that a metadata change
+// and the events it records are committed together. fn may be retried.
+func (vs *VideoService) inTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	return vs.DB.Client().UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	})
+}
+
+// recordEvent appends an event for the video to the outbox. It must run
+// inside inTransaction. Bumping the video's event_seq also makes concurrent
+// transactions on the same video conflict, so sequences never interleave.
+func (vs *VideoService) recordEvent(sc mongo.SessionContext, eventType EventType, metadata *models.VideoMetadata) error {
+	var counter struct {
+		EventSeq int64 `bson:"event_seq"`
+	}
+	err := vs.DB.Collection("videos").FindOneAndUpdate(sc,
+		bson.M{"_id": metadata.ID},
+		bson.M{"$inc": bson.M{"event_seq": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"event_seq": 1}),
+	).Decode(&counter)
+	if err != nil {
+		return fmt.Errorf("failed to sequence %s event: %w", eventType, err)
+	}
+
+	_, err = vs.DB.Collection("outbox").InsertOne(sc, outboxRecord{
+		Type:         eventType,
+		VideoID:      metadata.ID.Hex(),
+		OwnerID:      metadata.OwnerID,
+		Sequence:     counter.EventSeq,
+		OccurredAt:   time.Now(),
+		TraceContext: tracing.Inject(sc),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %w", eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/tracing"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// relayLease names the lease that elects a single relay among replicas, which
+// keeps events of a video in order
+const relayLease = "outbox-relay"
+
+// OutboxRelay publishes outbox events to a broker. An event is marked
+// published only after the broker accepts it, so delivery is at least once.
+// Events of one video are published in sequence order and a failure holds
+// back that video's later events until it is retried. A retry only goes to
+// the targets that have not accepted the event yet.
+type OutboxRelay struct {
+	DB        *mongo.Database
+	Targets   MultiEventPublisher
+	Interval  time.Duration
+	BatchSize int64
+	Owner     string
+	// LeaseTTL is how long the lease outlives its last renewal. It is renewed
+	// before every event and each publish is bounded by half of it, so a slow
+	// broker cannot let another replica take over mid-publish.
+	LeaseTTL time.Duration
+}
+
+// NewOutboxRelay initializes a new OutboxRelay
+func NewOutboxRelay(db *mongo.Database, targets MultiEventPublisher, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		DB:        db,
+		Targets:   targets,
+		Interval:  interval,
+		BatchSize: 100,
+		Owner:     uuid.NewString(),
+		LeaseTTL:  30 * time.Second,
+	}
+}
+
+// Run relays pending events every Interval until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		err := r.Tick(ctx)
+		metrics.ObserveJobTick("outbox_relay", start, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "Outbox relay tick failed", logging.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pending counts the events waiting to be published
+func (r *OutboxRelay) Pending(ctx context.Context) (int64, error) {
+	return r.DB.Collection("outbox").CountDocuments(ctx, bson.M{"published_at": nil})
+}
+
+// Tick publishes one batch of pending events, if this replica holds the lease
+func (r *OutboxRelay) Tick(ctx context.Context) error {
+	leader, err := r.acquireLease(ctx)
+	if err != nil || !leader {
+		return err
+	}
+
+	collection := r.DB.Collection("outbox")
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(r.BatchSize)
+	cursor, err := collection.Find(ctx, bson.M{"published_at": nil}, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load outbox: %w", err)
+	}
+	var records []outboxRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return fmt.Errorf("failed to decode outbox: %w", err)
+	}
+
+	// Group by video, keeping the order in which videos first appear
+	var videoIDs []string
+	byVideo := make(map[string][]outboxRecord)
+	for _, record := range records {
+		if _, ok := byVideo[record.VideoID]; !ok {
+			videoIDs = append(videoIDs, record.VideoID)
+		}
+		byVideo[record.VideoID] = append(byVideo[record.VideoID], record)
+	}
+
+	for _, videoID := range videoIDs {
+		pending := byVideo[videoID]
+		sort.Slice(pending, func(i, j int) bool { return pending[i].Sequence < pending[j].Sequence })
+		for _, record := range pending {
+			// Stop as soon as another replica has taken over
+			if leader, err := r.acquireLease(ctx); err != nil || !leader {
+				return err
+			}
+			if err := r.publish(ctx, &record); err != nil {
+				slog.WarnContext(ctx, "Failed to relay event", slog.String("event_type", string(record.Type)), slog.String("video_id", videoID), logging.Err(err))
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// publish hands one event to the broker and records the outcome, in a span
+// that continues the trace of the request that recorded the event
+func (r *OutboxRelay) publish(ctx context.Context, record *outboxRecord) (err error) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, record.TraceContext), "outbox.publish "+string(record.Type),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("video.id", record.VideoID),
+			attribute.String("event.id", record.ID.Hex()),
+		))
+	defer func() { tracing.End(span, err) }()
+
+	collection := r.DB.Collection("outbox")
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.LeaseTTL/2)
+	accepted, err := r.Targets.PublishExcept(publishCtx, record.event(), record.PublishedTo)
+	cancel()
+	if err != nil {
+		update := bson.M{
+			"$inc": bson.M{"attempts": 1},
+			"$set": bson.M{"last_error": err.Error()},
+		}
+		if len(accepted) > 0 {
+			update["$addToSet"] = bson.M{"published_to": bson.M{"$each": accepted}}
+		}
+		_, updateErr := collection.UpdateOne(ctx, bson.M{"_id": record.ID}, update)
+		if updateErr != nil {
+			slog.ErrorContext(ctx, "Failed to record relay failure", slog.String("event_id", record.ID.Hex()), logging.Err(updateErr))
+		}
+		return err
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{
+		"$set":   bson.M{"published_at": time.Now()},
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"last_error": "", "published_to": ""},
+	})
+	if err != nil {
+		// The event will be published again, which consumers must tolerate anyway
+		return fmt.Errorf("failed to mark event published: %w", err)
+	}
+	return nil
+}
+
+// acquireLease takes or renews the relay lease. Another replica holding an
+// unexpired lease makes the upsert collide with its document. The lease lasts
+// at least three intervals, so a healthy leader keeps it between ticks.
+func (r *OutboxRelay) acquireLease(ctx context.Context) (bool, error) {
+	now := time.Now()
+	_, err := r.DB.Collection("leases").UpdateOne(ctx,
+		bson.M{"_id": relayLease, "$or": bson.A{
+			bson.M{"owner": r.Owner},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		}},
+		bson.M{"$set": bson.M{"owner": r.Owner, "expires_at": now.Add(max(r.LeaseTTL, 3*r.Interval))}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire relay lease: %w", err)
+	}
+	return true, nil
+}
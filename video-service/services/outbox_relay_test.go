@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// recordingPublisher records the events it accepts and refuses those listed
+// in fail
+type recordingPublisher struct {
+	fail      map[string]bool // Video ID and sequence, such as "a/1"
+	published []string
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event VideoEvent) error {
+	key := event.VideoID + "/" + strconv.FormatInt(event.Sequence, 10)
+	if p.fail[key] {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, key)
+	return nil
+}
+
+func TestMultiEventPublisherPublishExcept(t *testing.T) {
+	event := VideoEvent{VideoID: "a", Sequence: 1}
+	tests := []struct {
+		name         string
+		failing      []string
+		done         []string
+		wantAccepted []string
+		wantErr      string
+	}{
+		{name: "all accept", wantAccepted: []string{"log", "hub", "broker"}},
+		{name: "one fails", failing: []string{"broker"}, wantAccepted: []string{"log", "hub"}, wantErr: "broker: broker unavailable"},
+		{name: "done are skipped", done: []string{"log", "hub"}, wantAccepted: []string{"broker"}},
+		{name: "retry fails again", failing: []string{"broker"}, done: []string{"log", "hub"}, wantErr: "broker:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := MultiEventPublisher{}
+			publishers := map[string]*recordingPublisher{}
+			for _, name := range []string{"log", "hub", "broker"} {
+				publisher := &recordingPublisher{fail: map[string]bool{}}
+				if slices.Contains(tt.failing, name) {
+					publisher.fail["a/1"] = true
+				}
+				publishers[name] = publisher
+				targets = append(targets, EventTarget{Name: name, Publisher: publisher})
+			}
+
+			accepted, err := targets.PublishExcept(context.Background(), event, tt.done)
+			if !slices.Equal(accepted, tt.wantAccepted) {
+				t.Errorf("PublishExcept() accepted %v, want %v", accepted, tt.wantAccepted)
+			}
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("PublishExcept() error = %v, want %q", err, tt.wantErr)
+			}
+			for _, name := range tt.done {
+				if len(publishers[name].published) > 0 {
+					t.Errorf("%s received the event again", name)
+				}
+			}
+		})
+	}
+}
+
+// outboxDocs converts records to the documents of a find reply
+func outboxDocs(t *testing.T, records ...outboxRecord) []bson.D {
+	docs := make([]bson.D, len(records))
+	for i, record := range records {
+		data, err := bson.Marshal(record)
+		if err != nil {
+			t.Fatalf("bson.Marshal() error = %v", err)
+		}
+		if err := bson.Unmarshal(data, &docs[i]); err != nil {
+			t.Fatalf("bson.Unmarshal() error = %v", err)
+		}
+	}
+	return docs
+}
+
+func TestOutboxRelayTick(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	ok := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	leaseTaken := mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+	// Sorted by _id, so a/2 was recorded before a/1 reached the outbox
+	records := []outboxRecord{
+		{ID: primitive.NewObjectID(), VideoID: "a", Sequence: 2},
+		{ID: primitive.NewObjectID(), VideoID: "b", Sequence: 1},
+		{ID: primitive.NewObjectID(), VideoID: "a", Sequence: 1},
+	}
+
+	tests := []struct {
+		name          string
+		fail          []string
+		responses     func(batch bson.D) []bson.D
+		wantPublished []string
+	}{
+		{
+			name: "videos in sequence order",
+			responses: func(batch bson.D) []bson.D {
+				return []bson.D{ok, batch, ok, ok, ok, ok, ok, ok}
+			},
+			wantPublished: []string{"a/1", "a/2", "b/1"},
+		},
+		{
+			name: "failure holds back later events of the video",
+			fail: []string{"a/1"},
+			responses: func(batch bson.D) []bson.D {
+				return []bson.D{ok, batch, ok, ok, ok, ok}
+			},
+			wantPublished: []string{"b/1"},
+		},
+		{
+			name: "lease held by another replica",
+			responses: func(bson.D) []bson.D {
+				return []bson.D{leaseTaken}
+			},
+		},
+		{
+			name: "lease lost mid-batch",
+			responses: func(batch bson.D) []bson.D {
+				return []bson.D{ok, batch, ok, ok, leaseTaken}
+			},
+			wantPublished: []string{"a/1"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			ns := mt.DB.Name() + ".outbox"
+			batch := mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, outboxDocs(t, records...)...)
+			mt.AddMockResponses(tt.responses(batch)...)
+
+			publisher := &recordingPublisher{fail: map[string]bool{}}
+			for _, key := range tt.fail {
+				publisher.fail[key] = true
+			}
+			relay := NewOutboxRelay(mt.DB, MultiEventPublisher{{Name: "broker", Publisher: publisher}}, time.Second)
+			if err := relay.Tick(context.Background()); err != nil {
+				mt.Fatalf("Tick() error = %v", err)
+			}
+			if !slices.Equal(publisher.published, tt.wantPublished) {
+				mt.Errorf("published %v, want %v", publisher.published, tt.wantPublished)
+			}
+		})
+	}
+}
+
+func TestOutboxRelayRetriesOnlyFailedTargets(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("retry", func(mt *mtest.T) {
+		ok := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+		record := outboxRecord{ID: primitive.NewObjectID(), VideoID: "a", Sequence: 1, PublishedTo: []string{"log"}}
+		batch := mtest.CreateCursorResponse(0, mt.DB.Name()+".outbox", mtest.FirstBatch, outboxDocs(t, record)...)
+		mt.AddMockResponses(ok, batch, ok, ok)
+
+		log := &recordingPublisher{}
+		hub := &recordingPublisher{}
+		broker := &recordingPublisher{fail: map[string]bool{"a/1": true}}
+		relay := NewOutboxRelay(mt.DB, MultiEventPublisher{
+			{Name: "log", Publisher: log},
+			{Name: "hub", Publisher: hub},
+			{Name: "broker", Publisher: broker},
+		}, time.Second)
+		if err := relay.Tick(context.Background()); err != nil {
+			mt.Fatalf("Tick() error = %v", err)
+		}
+
+		if len(log.published) != 0 {
+			mt.Errorf("log received the event again")
+		}
+		if !slices.Equal(hub.published, []string{"a/1"}) {
+			mt.Errorf("hub published %v, want [a/1]", hub.published)
+		}
+		var update bson.Raw
+		for {
+			event := mt.GetStartedEvent()
+			if event == nil {
+				mt.Fatal("no update recorded the failure")
+			}
+			if event.CommandName == "update" && strings.HasSuffix(event.Command.Lookup("update").StringValue(), "outbox") {
+				update = event.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+				break
+			}
+		}
+		added := update.Lookup("$addToSet", "published_to", "$each").Array()
+		if values, _ := added.Values(); len(values) != 1 || values[0].StringValue() != "hub" {
+			mt.Errorf("published_to added %v, want [hub]", added)
+		}
+		if !strings.Contains(update.Lookup("$set", "last_error").StringValue(), "broker:") {
+			mt.Errorf("last_error = %v, want the broker's error", update.Lookup("$set", "last_error"))
+		}
+	})
+}
+
+func TestOutboxRelayLeaseExpiry(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+	}{
+		{name: "lease TTL", interval: time.Second, want: 30 * time.Second},
+		{name: "three intervals", interval: time.Minute, want: 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+			relay := NewOutboxRelay(mt.DB, nil, tt.interval)
+			before := time.Now()
+			if leader, err := relay.acquireLease(context.Background()); err != nil || !leader {
+				mt.Fatalf("acquireLease() = %v, %v", leader, err)
+			}
+
+			update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+			expires := update.Lookup("u", "$set", "expires_at").Time()
+			if got := expires.Sub(before); got < tt.want-time.Second || got > tt.want+time.Second {
+				mt.Errorf("lease lasts %s, want %s", got, tt.want)
+			}
+			if !update.Lookup("upsert").Boolean() {
+				mt.Error("lease update is not an upsert")
+			}
+		})
+	}
+}
+
+func TestEnsureOutboxIndexesChangesRetention(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("conflict", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 85, Name: "IndexOptionsConflict", Message: "expireAfterSeconds differs"}),
+			mtest.CreateSuccessResponse(),
+		)
+		vs := &VideoService{DB: mt.DB}
+		if err := vs.EnsureOutboxIndexes(context.Background(), 48*time.Hour); err != nil {
+			mt.Fatalf("EnsureOutboxIndexes() error = %v", err)
+		}
+
+		mt.GetStartedEvent() // createIndexes
+		collMod := mt.GetStartedEvent()
+		if collMod == nil || collMod.CommandName != "collMod" {
+			mt.Fatalf("second command = %v, want collMod", collMod)
+		}
+		if got := collMod.Command.Lookup("index", "expireAfterSeconds").Int32(); got != int32((48 * time.Hour).Seconds()) {
+			mt.Errorf("expireAfterSeconds = %d, want %d", got, int32((48 * time.Hour).Seconds()))
+		}
+	})
+	mt.Run("other errors", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not allowed"}))
+		vs := &VideoService{DB: mt.DB}
+		if err := vs.EnsureOutboxIndexes(context.Background(), time.Hour); err == nil {
+			mt.Error("EnsureOutboxIndexes() succeeded")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/models"
+	"video-service/tracing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// errScanStopped ends an upload whose scan ended before reading all of it
+var errScanStopped = errors.New("malware scan stopped reading the upload")
+
+// uploadScanned streams body to the bucket under key while the scanner reads
+// a copy of it. The object is stored private; it is only made public once its
+// video is, by syncMediaACL. An infected object is moved to quarantine and an
+// *InfectedError returned. Scans that fail reject the upload rather than keep
+// an unscanned file.
+func (vs *VideoService) uploadScanned(ctx context.Context, operation, key, contentType string, body io.Reader) (string, error) {
+	if _, ok := vs.Scanner.(NoopScanner); ok || vs.Scanner == nil {
+		return vs.upload(ctx, operation, key, contentType, types.ObjectCannedACLPrivate, body)
+	}
+
+	type verdict struct {
+		result ScanResult
+		err    error
+	}
+	pr, pw := io.Pipe()
+	scanned := make(chan verdict, 1)
+	go func() {
+		result, err := vs.scan(ctx, key, pr)
+		pr.CloseWithError(errScanStopped)
+		scanned <- verdict{result, err}
+	}()
+
+	location, uploadErr := vs.upload(ctx, operation, key, contentType, types.ObjectCannedACLPrivate, io.TeeReader(body, pw))
+	pw.CloseWithError(uploadErr)
+	scan := <-scanned
+
+	switch {
+	case uploadErr != nil && (scan.err == nil || errors.Is(scan.err, uploadErr)):
+		return "", uploadErr
+	case scan.err != nil:
+		if uploadErr == nil {
+			vs.removeObject(ctx, key)
+		}
+		return "", apperrors.Wrap(apperrors.CodeUnavailable, scan.err, "Failed to scan upload for malware")
+	case scan.result.Infected:
+		quarantineKey, err := vs.quarantine(ctx, key)
+		if err != nil {
+			return "", apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to quarantine infected upload")
+		}
+		slog.WarnContext(ctx, "Quarantined infected upload",
+			slog.String("key", key),
+			slog.String("quarantine_key", quarantineKey),
+			slog.String("signature", scan.result.Signature))
+		return "", &InfectedError{Signature: scan.result.Signature, QuarantineKey: quarantineKey}
+	}
+	return location, nil
+}
+
+// scan runs the scanner over r, timing and tracing it
+func (vs *VideoService) scan(ctx context.Context, key string, r io.Reader) (ScanResult, error) {
+	ctx, span := tracing.Start(ctx, "malware.scan", attribute.String("aws.s3.key", key))
+	start := time.Now()
+	result, err := vs.Scanner.Scan(ctx, r)
+	metrics.ObserveScan(start, result.Infected, err)
+	tracing.End(span, err)
+	return result, err
+}
+
+// setACL makes an object readable by anyone, or by the service only
+func (vs *VideoService) setACL(ctx context.Context, key string, public bool) error {
+	operation, acl := "unpublish", types.ObjectCannedACLPrivate
+	if public {
+		operation, acl = "publish", types.ObjectCannedACLPublicRead
+	}
+	start := time.Now()
+	_, err := vs.S3Client.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket: &vs.Bucket,
+		Key:    &key,
+		ACL:    acl,
+	})
+	metrics.ObserveStorage(operation, start, err)
+	return err
+}
+
+// quarantine moves an object under QuarantinePrefix, where it stays private
+// for investigation, and returns its new key
+func (vs *VideoService) quarantine(ctx context.Context, key string) (string, error) {
+	quarantineKey := vs.QuarantinePrefix + key
+	source := (&url.URL{Path: vs.Bucket + "/" + key}).EscapedPath()
+	start := time.Now()
+	_, err := vs.S3Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &vs.Bucket,
+		Key:        &quarantineKey,
+		CopySource: &source,
+		ACL:        types.ObjectCannedACLPrivate,
+	})
+	metrics.ObserveStorage("quarantine", start, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy %s to quarantine: %w", key, err)
+	}
+	if err := vs.deleteObject(ctx, key); err != nil {
+		return "", fmt.Errorf("failed to remove %s after quarantine: %w", key, err)
+	}
+	return quarantineKey, nil
+}
+
+// removeObject deletes an object that will not be published, logging
+// failures; storage reconciliation reports whatever is left behind
+func (vs *VideoService) removeObject(ctx context.Context, key string) {
+	if err := vs.deleteObject(context.WithoutCancel(ctx), key); err != nil {
+		slog.WarnContext(ctx, "Failed to remove unpublished upload", slog.String("key", key), logging.Err(err))
+	}
+}
+
+// RemoveFiles deletes stored files that no saved video refers to, such as
+// those of an upload that failed partway. Failures are logged.
+func (vs *VideoService) RemoveFiles(ctx context.Context, locations ...string) {
+	for _, location := range locations {
+		if key, ok := vs.ObjectKey(location); ok {
+			vs.removeObject(ctx, key)
+		}
+	}
+}
+
+func (vs *VideoService) deleteObject(ctx context.Context, key string) error {
+	start := time.Now()
+	_, err := vs.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &vs.Bucket, Key: &key})
+	metrics.ObserveStorage("delete", start, err)
+	return err
+}
+
+// SaveRejectedVideo records an upload refused because malware was found in
+// it, with a video.rejected event. The video is never listed or playable.
+func (vs *VideoService) SaveRejectedVideo(ctx context.Context, details VideoDetails, contentType string, infected *InfectedError) (models.VideoMetadata, error) {
+	now := time.Now()
+	metadata := models.VideoMetadata{
+		OwnerID:     details.OwnerID,
+		Title:       details.Title,
+		Tags:        details.Tags,
+		UploadedAt:  now,
+		ContentType: contentType,
+		ContentHash: details.ContentHash,
+		Status:      models.StatusRejected,
+		Rejection:   newMalwareRejection(infected, now),
+	}
+	if err := applyVisibility(&metadata, details.Visibility); err != nil {
+		return metadata, err
+	}
+	if err := applySchedule(&metadata, details.Schedule); err != nil {
+		return metadata, err
+	}
+	return vs.insertVideo(ctx, metadata, EventVideoRejected)
+}
+
+func newMalwareRejection(infected *InfectedError, at time.Time) *models.Rejection {
+	return &models.Rejection{
+		Reason:        ErrMalwareDetected.Message,
+		Signature:     infected.Signature,
+		QuarantineKey: infected.QuarantineKey,
+		RejectedAt:    at,
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"video-service/apperrors"
+	"video-service/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Both per-user quotas are quota_exceeded errors, told apart by their message
+// and the quota detail; a file that is too large is payload_too_large instead
+var (
+	ErrStorageQuotaExceeded       = apperrors.QuotaExceeded("Storage quota exceeded").WithDetail("quota", "storage")
+	ErrDailyUploadLimitReached    = apperrors.QuotaExceeded("Daily upload limit reached").WithDetail("quota", "daily_uploads")
+	ErrGlobalStorageQuotaExceeded = apperrors.Unavailable("Service storage is full")
+)
+
+// globalUsageID is the usage document that tracks storage across all users
+const globalUsageID = "__global__"
+
+// QuotaLimits configures upload limits. Zero disables a limit.
+type QuotaLimits struct {
+	MaxFileSize        int64 // Largest accepted upload in bytes
+	UserStorageBytes   int64 // Total bytes a single user may store
+	UserDailyUploads   int   // Uploads a single user may make per UTC day
+	GlobalStorageBytes int64 // Total bytes stored across all users
+}
+
+// Usage is a user's consumption as tracked in the upload_usage collection
+type Usage struct {
+	UserID       string `bson:"_id" json:"user_id"`
+	StorageBytes int64  `bson:"storage_bytes" json:"storage_bytes"`
+	Day          string `bson:"day" json:"-"`
+	DayCount     int    `bson:"day_count" json:"uploads_today"`
+}
+
+// QuotaService reserves and releases per-user and global upload quota
+type QuotaService struct {
+	DB     *mongo.Database
+	Limits QuotaLimits
+}
+
+// NewQuotaService initializes a new QuotaService
+func NewQuotaService(db *mongo.Database, limits QuotaLimits) *QuotaService {
+	return &QuotaService{DB: db, Limits: limits}
+}
+
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+// Reserve counts an upload of size bytes against userID's quotas before it is
+// stored. Callers must Release the reservation if the upload then fails.
+func (qs *QuotaService) Reserve(ctx context.Context, userID string, size int64) error {
+	return qs.reserveBoth(ctx, userID, size, true)
+}
+
+// Adjust corrects a reservation once the real size of an upload is known.
+// Growing a reservation is subject to the storage quotas; shrinking always
+// succeeds.
+func (qs *QuotaService) Adjust(ctx context.Context, userID string, delta int64) error {
+	if delta <= 0 {
+		qs.Free(ctx, userID, -delta)
+		return nil
+	}
+	return qs.reserveBoth(ctx, userID, delta, false)
+}
+
+func (qs *QuotaService) reserveBoth(ctx context.Context, userID string, size int64, countUpload bool) error {
+	if err := qs.reserve(ctx, userID, size, qs.Limits.UserStorageBytes, qs.Limits.UserDailyUploads, countUpload); err != nil {
+		return err
+	}
+	if err := qs.reserve(ctx, globalUsageID, size, qs.Limits.GlobalStorageBytes, 0, countUpload); err != nil {
+		qs.release(ctx, userID, size, countUpload)
+		if errors.Is(err, ErrStorageQuotaExceeded) {
+			return ErrGlobalStorageQuotaExceeded
+		}
+		return err
+	}
+	return nil
+}
+
+// Release returns a reservation made by Reserve
+func (qs *QuotaService) Release(ctx context.Context, userID string, size int64) {
+	qs.release(ctx, userID, size, true)
+	qs.release(ctx, globalUsageID, size, false)
+}
+
+// Free returns storage held by a deleted video without touching upload counts
+func (qs *QuotaService) Free(ctx context.Context, userID string, size int64) {
+	qs.release(ctx, userID, size, false)
+	qs.release(ctx, globalUsageID, size, false)
+}
+
+// reserve atomically adds size bytes, and one upload when countUpload is set,
+// to the usage document id, provided neither limit would be exceeded
+func (qs *QuotaService) reserve(ctx context.Context, id string, size, storageLimit int64, dailyLimit int, countUpload bool) error {
+	collection := qs.DB.Collection("upload_usage")
+	day := today()
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$setOnInsert": bson.M{"storage_bytes": int64(0), "day": day, "day_count": 0}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to initialize usage: %w", err)
+	}
+
+	filter := bson.M{"_id": id}
+	if storageLimit > 0 {
+		filter["storage_bytes"] = bson.M{"$lte": storageLimit - size}
+	}
+	if !countUpload {
+		dailyLimit = 0
+	}
+	if dailyLimit > 0 {
+		filter["$or"] = bson.A{bson.M{"day": bson.M{"$ne": day}}, bson.M{"day_count": bson.M{"$lt": dailyLimit}}}
+	}
+
+	increment := 0
+	if countUpload {
+		increment = 1
+	}
+
+	// Reset the daily count when the stored day is stale
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"storage_bytes": bson.M{"$add": bson.A{"$storage_bytes", size}},
+		"day_count": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$day", day}},
+			bson.M{"$add": bson.A{"$day_count", increment}},
+			increment,
+		}},
+		"day": day,
+	}}}}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to reserve quota: %w", err)
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	usage, err := qs.usage(ctx, id)
+	if err != nil {
+		return err
+	}
+	if storageLimit > 0 && usage.StorageBytes+size > storageLimit {
+		return ErrStorageQuotaExceeded.
+			WithDetail("limit_bytes", storageLimit).
+			WithDetail("used_bytes", usage.StorageBytes)
+	}
+	return ErrDailyUploadLimitReached.WithDetail("limit", dailyLimit)
+}
+
+func (qs *QuotaService) release(ctx context.Context, id string, size int64, refundUpload bool) {
+	// A release must land even when the request that reserved was cancelled
+	ctx = context.WithoutCancel(ctx)
+	collection := qs.DB.Collection("upload_usage")
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"storage_bytes": -size}}); err != nil {
+		slog.ErrorContext(ctx, "Failed to release quota", slog.Int64("bytes", size), slog.String("usage_id", id), logging.Err(err))
+	}
+	if refundUpload {
+		// Only refund the upload count if it was reserved today
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id, "day": today()}, bson.M{"$inc": bson.M{"day_count": -1}}); err != nil {
+			slog.ErrorContext(ctx, "Failed to refund upload count", slog.String("usage_id", id), logging.Err(err))
+		}
+	}
+}
+
+func (qs *QuotaService) usage(ctx context.Context, id string) (*Usage, error) {
+	var usage Usage
+	err := qs.DB.Collection("upload_usage").FindOne(ctx, bson.M{"_id": id}).Decode(&usage)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &Usage{UserID: id}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch usage: %w", err)
+	}
+	if usage.Day != today() {
+		usage.DayCount = 0
+	}
+	return &usage, nil
+}
+
+// GetUsage returns userID's current consumption
+func (qs *QuotaService) GetUsage(ctx context.Context, userID string) (*Usage, error) {
+	return qs.usage(ctx, userID)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"video-service/apperrors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestQuotaService(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	matched := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	missed := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0})
+	usage := func(mt *mtest.T, storage int64, dayCount int) bson.D {
+		return mtest.CreateCursorResponse(0, mt.DB.Name()+".upload_usage", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: "user"}, {Key: "storage_bytes", Value: storage}, {Key: "day", Value: today()}, {Key: "day_count", Value: dayCount},
+		})
+	}
+	limits := QuotaLimits{UserStorageBytes: 100, UserDailyUploads: 5, GlobalStorageBytes: 1000}
+
+	tests := []struct {
+		name      string
+		call      func(qs *QuotaService) error
+		responses func(mt *mtest.T) []bson.D
+		wantErr   error
+		// wantDetails are expected in the error, besides the quota name
+		wantDetails map[string]interface{}
+		// wantUpdates lists the usage documents updated, in order, with the
+		// storage they add ("+") or remove ("-")
+		wantUpdates []string
+	}{
+		{
+			name: "reserve",
+			call: func(qs *QuotaService) error { return qs.Reserve(context.Background(), "user", 40) },
+			responses: func(*mtest.T) []bson.D {
+				return []bson.D{matched, matched, matched, matched}
+			},
+			wantUpdates: []string{"user init", "user +", "__global__ init", "__global__ +"},
+		},
+		{
+			name: "storage quota exceeded",
+			call: func(qs *QuotaService) error { return qs.Reserve(context.Background(), "user", 40) },
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{matched, missed, usage(mt, 90, 0)}
+			},
+			wantErr:     ErrStorageQuotaExceeded,
+			wantDetails: map[string]interface{}{"quota": "storage", "limit_bytes": int64(100), "used_bytes": int64(90)},
+			wantUpdates: []string{"user init", "user +"},
+		},
+		{
+			name: "daily limit reached",
+			call: func(qs *QuotaService) error { return qs.Reserve(context.Background(), "user", 40) },
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{matched, missed, usage(mt, 10, 5)}
+			},
+			wantErr:     ErrDailyUploadLimitReached,
+			wantDetails: map[string]interface{}{"quota": "daily_uploads", "limit": 5},
+			wantUpdates: []string{"user init", "user +"},
+		},
+		{
+			name: "global quota exceeded releases the user's reservation",
+			call: func(qs *QuotaService) error { return qs.Reserve(context.Background(), "user", 40) },
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{matched, matched, matched, missed, usage(mt, 990, 0), matched, matched}
+			},
+			wantErr:     ErrGlobalStorageQuotaExceeded,
+			wantUpdates: []string{"user init", "user +", "__global__ init", "__global__ +", "user -", "user refund"},
+		},
+		{
+			name: "adjust up",
+			call: func(qs *QuotaService) error { return qs.Adjust(context.Background(), "user", 10) },
+			responses: func(*mtest.T) []bson.D {
+				return []bson.D{matched, matched, matched, matched}
+			},
+			wantUpdates: []string{"user init", "user +", "__global__ init", "__global__ +"},
+		},
+		{
+			name: "adjust down frees storage",
+			call: func(qs *QuotaService) error { return qs.Adjust(context.Background(), "user", -10) },
+			responses: func(*mtest.T) []bson.D {
+				return []bson.D{matched, matched}
+			},
+			wantUpdates: []string{"user -", "__global__ -"},
+		},
+		{
+			name: "release",
+			call: func(qs *QuotaService) error {
+				qs.Release(context.Background(), "user", 40)
+				return nil
+			},
+			responses: func(*mtest.T) []bson.D {
+				return []bson.D{matched, matched, matched}
+			},
+			wantUpdates: []string{"user -", "user refund", "__global__ -"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			err := tt.call(NewQuotaService(mt.DB, limits))
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				mt.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			for key, want := range tt.wantDetails {
+				if appErr, _ := apperrors.As(err); appErr.Details[key] != want {
+					mt.Errorf("details[%s] = %v, want %v", key, appErr.Details[key], want)
+				}
+			}
+
+			var updates []string
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "update" {
+					updates = append(updates, describeUsageUpdate(event.Command))
+				}
+			}
+			if len(updates) != len(tt.wantUpdates) {
+				mt.Fatalf("updates = %v, want %v", updates, tt.wantUpdates)
+			}
+			for i := range updates {
+				if updates[i] != tt.wantUpdates[i] {
+					mt.Errorf("updates = %v, want %v", updates, tt.wantUpdates)
+					break
+				}
+			}
+		})
+	}
+}
+
+// describeUsageUpdate summarizes an update command on upload_usage as the
+// document it targets and what it does
+func describeUsageUpdate(command bson.Raw) string {
+	update := command.Lookup("updates").Array().Index(0).Value().Document()
+	id := update.Lookup("q", "_id").StringValue()
+	u := update.Lookup("u")
+	switch {
+	case u.Type == bson.TypeArray:
+		return id + " +"
+	case u.Document().Lookup("$setOnInsert").Type != 0:
+		return id + " init"
+	case u.Document().Lookup("$inc", "day_count").Type != 0:
+		return id + " refund"
+	}
+	return id + " -"
+}
+
+func TestQuotaServiceReserveFilter(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	matched := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	tests := []struct {
+		name          string
+		call          func(qs *QuotaService) error
+		wantMaxBefore int64
+		wantDaily     bool
+	}{
+		{name: "reserve", call: func(qs *QuotaService) error { return qs.Reserve(context.Background(), "user", 40) }, wantMaxBefore: 60, wantDaily: true},
+		{name: "adjust does not count an upload", call: func(qs *QuotaService) error { return qs.Adjust(context.Background(), "user", 30) }, wantMaxBefore: 70},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(matched, matched, matched, matched)
+			qs := NewQuotaService(mt.DB, QuotaLimits{UserStorageBytes: 100, UserDailyUploads: 5})
+			if err := tt.call(qs); err != nil {
+				mt.Fatalf("error = %v", err)
+			}
+			mt.GetStartedEvent() // Initialization
+			filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+			if got := filter.Lookup("storage_bytes", "$lte").AsInt64(); got != tt.wantMaxBefore {
+				mt.Errorf("storage_bytes must be at most %d, want %d", got, tt.wantMaxBefore)
+			}
+			if daily := filter.Lookup("$or").Type != 0; daily != tt.wantDaily {
+				mt.Errorf("daily limit checked = %v, want %v", daily, tt.wantDaily)
+			}
+		})
+	}
+}
+
+func TestQuotaErrors(t *testing.T) {
+	for _, err := range []*apperrors.Error{ErrStorageQuotaExceeded, ErrDailyUploadLimitReached} {
+		if err.Code != apperrors.CodeQuotaExceeded {
+			t.Errorf("%q has code %s, want %s", err.Message, err.Code, apperrors.CodeQuotaExceeded)
+		}
+	}
+	if errors.Is(ErrDailyUploadLimitReached, ErrStorageQuotaExceeded) {
+		t.Error("the daily limit and storage quota errors cannot be told apart")
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"video-service/apperrors"
+)
+
+// ErrMalwareDetected is returned, wrapped in an *InfectedError, for uploads
+// the scanner rejected
+var ErrMalwareDetected = apperrors.Unprocessable("Upload was rejected: malware detected")
+
+// ScanResult is a scanner's verdict on one file
+type ScanResult struct {
+	Infected  bool
+	Signature string // Name of the malware found
+}
+
+// Scanner checks uploads for malware before they become available. Scan
+// reads r to the end unless it fails.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+// NoopScanner accepts every file without looking at it
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	_, err := io.Copy(io.Discard, r)
+	return ScanResult{}, err
+}
+
+// NewScanner initializes the scanner named by kind: none or clamav
+func NewScanner(kind, clamdAddress string, timeout time.Duration) (Scanner, error) {
+	switch kind {
+	case "", "none":
+		return NoopScanner{}, nil
+	case "clamav":
+		scanner, err := NewClamAVScanner(clamdAddress, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return scanner, nil
+	}
+	return nil, fmt.Errorf("unknown malware scanner %q", kind)
+}
+
+// InfectedError reports an upload the scanner found malware in. The stored
+// object has been moved to quarantine.
+type InfectedError struct {
+	Signature     string
+	QuarantineKey string
+}
+
+func (e *InfectedError) Error() string {
+	return fmt.Sprintf("malware detected: %s", e.Signature)
+}
+
+// Unwrap lets the error be reported as ErrMalwareDetected. The signature is
+// kept for operators rather than shown to the uploader.
+func (e *InfectedError) Unwrap() error {
+	return ErrMalwareDetected
+}
+
+// AsInfected returns the *InfectedError in err's chain, if any
+func AsInfected(err error) (*InfectedError, bool) {
+	var infected *InfectedError
+	if errors.As(err, &infected) {
+		return infected, true
+	}
+	return nil, false
+}
+
+// clamdChunkSize is the size of the chunks streamed to clamd. It must stay
+// below clamd's StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// ClamAVScanner streams files to a clamd daemon with the INSTREAM command.
+// clamd refuses streams longer than its StreamMaxLength setting, which must
+// therefore be at least the largest allowed upload.
+type ClamAVScanner struct {
+	Network string        // tcp or unix
+	Address string        // host:port, or the socket path
+	Timeout time.Duration // Longest clamd may take to accept data or answer
+}
+
+// NewClamAVScanner initializes a new ClamAVScanner for an address of the form
+// tcp://host:port or unix:///path/to/clamd.sock
+func NewClamAVScanner(address string, timeout time.Duration) (*ClamAVScanner, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address %q: %w", address, err)
+	}
+	switch {
+	case u.Scheme == "tcp" && u.Host != "":
+		return &ClamAVScanner{Network: "tcp", Address: u.Host, Timeout: timeout}, nil
+	case u.Scheme == "unix" && u.Path != "":
+		return &ClamAVScanner{Network: "unix", Address: u.Path, Timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("invalid clamd address %q: must be tcp://host:port or unix:///path", address)
+}
+
+// Scan streams r to clamd and returns its verdict
+func (s *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+
+	if err := s.write(conn, []byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, err
+	}
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			if err := s.write(conn, chunk[:4+n]); err != nil {
+				return ScanResult{}, s.replyAfter(conn, err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return ScanResult{}, readErr
+		}
+	}
+	if err := s.write(conn, []byte{0, 0, 0, 0}); err != nil {
+		return ScanResult{}, s.replyAfter(conn, err)
+	}
+
+	reply, err := s.reply(conn)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// Ping checks that clamd answers
+func (s *ClamAVScanner) Ping(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := s.write(conn, []byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := s.reply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// dial connects to clamd. The connection is closed if ctx ends, which
+// unblocks any pending read or write.
+func (s *ClamAVScanner) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: s.Timeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &clamdConn{Conn: conn, stop: stop}, nil
+}
+
+func (s *ClamAVScanner) write(conn net.Conn, data []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(s.Timeout))
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("failed to send to clamd: %w", err)
+	}
+	return nil
+}
+
+// reply reads clamd's null-terminated answer
+func (s *ClamAVScanner) reply(conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(s.Timeout))
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(errors.Is(err, io.EOF) && len(reply) > 0) {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// replyAfter explains a failed write with the reply clamd sent before
+// closing the connection, such as when a stream exceeds StreamMaxLength
+func (s *ClamAVScanner) replyAfter(conn net.Conn, err error) error {
+	if reply, replyErr := s.reply(conn); replyErr == nil && reply != "" {
+		_, err = parseClamdReply(reply)
+	}
+	return err
+}
+
+// clamdConn stops watching the scan's context once closed
+type clamdConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *clamdConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// parseClamdReply reads replies such as "stream: OK" and
+// "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (ScanResult, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	}
+	return ScanResult{}, fmt.Errorf("clamd failed to scan: %s", reply)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"video-service/apperrors"
+	"video-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ScheduleSettings describes the publishing window of a video. Nil times
+// mean "immediately" and "never" respectively.
+type ScheduleSettings struct {
+	PublishAt *time.Time `json:"publish_at"`
+	ExpireAt  *time.Time `json:"expire_at"`
+}
+
+// Validate checks that the window is well formed
+func (s ScheduleSettings) Validate() error {
+	if s.PublishAt != nil && s.ExpireAt != nil && !s.ExpireAt.After(*s.PublishAt) {
+		return apperrors.InvalidArgument("expire_at must be after publish_at")
+	}
+	if s.ExpireAt != nil && !s.ExpireAt.After(time.Now()) {
+		return apperrors.InvalidArgument("expire_at must be in the future")
+	}
+	return nil
+}
+
+// applySchedule copies the settings onto metadata and derives its availability
+func applySchedule(metadata *models.VideoMetadata, settings ScheduleSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	metadata.PublishAt = settings.PublishAt
+	metadata.ExpireAt = settings.ExpireAt
+	metadata.Availability = models.AvailabilityLive
+	if settings.PublishAt != nil && settings.PublishAt.After(time.Now()) {
+		metadata.Availability = models.AvailabilityScheduled
+	}
+	return nil
+}
+
+// availableFilter matches videos whose publishing window contains now.
+// Documents stored before scheduling existed have neither field.
+func availableFilter(now time.Time) bson.M {
+	return bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{bson.M{"publish_at": nil}, bson.M{"publish_at": bson.M{"$lte": now}}}},
+		bson.M{"$or": bson.A{bson.M{"expire_at": nil}, bson.M{"expire_at": bson.M{"$gt": now}}}},
+	}}
+}
+
+// UpdateSchedule changes the publishing window of an existing video
+func (vs *VideoService) UpdateSchedule(ctx context.Context, id string, settings ScheduleSettings) (*models.VideoMetadata, error) {
+	metadata, err := vs.GetVideoMetadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySchedule(metadata, settings); err != nil {
+		return nil, err
+	}
+
+	collection := vs.DB.Collection("videos")
+	err = vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err := collection.UpdateOne(sc, bson.M{"_id": metadata.ID, "deleted_at": nil}, bson.M{"$set": bson.M{
+			"publish_at":   metadata.PublishAt,
+			"expire_at":    metadata.ExpireAt,
+			"availability": metadata.Availability,
+		}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			// Deleted since it was read
+			return apperrors.NotFound("Video not found").WithDetail("id", id)
+		}
+		return vs.recordEvent(sc, EventVideoUpdated, metadata)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpdateScheduleDeletedVideo(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("deleted", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(deletedSinceRead(mt, id)...)
+		vs := &VideoService{DB: mt.DB}
+		publishAt := time.Now().Add(time.Hour)
+		_, err := vs.UpdateSchedule(context.Background(), id.Hex(), ScheduleSettings{PublishAt: &publishAt})
+		assertDeletedSinceRead(mt, err)
+	})
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Scheduler moves videos between availability states as their publishing
+// windows open and close, recording an event for each transition
+type Scheduler struct {
+	Service  *VideoService
+	Interval time.Duration
+}
+
+// NewScheduler initializes a new Scheduler
+func NewScheduler(service *VideoService, interval time.Duration) *Scheduler {
+	return &Scheduler{Service: service, Interval: interval}
+}
+
+// Run checks for due transitions every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		err := s.Tick(ctx)
+		metrics.ObserveJobTick("scheduler", start, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "Scheduler tick failed", logging.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick applies every transition that is due now
+func (s *Scheduler) Tick(ctx context.Context) error {
+	now := time.Now()
+
+	// Expire first so a video whose whole window has passed goes straight to
+	// expired. Imports are left alone until they are ready.
+	err := s.transition(ctx,
+		bson.M{"availability": bson.M{"$ne": models.AvailabilityExpired}, "expire_at": bson.M{"$lte": now}, "deleted_at": nil, "status": readyStatus},
+		models.AvailabilityExpired, EventVideoExpired)
+	if err != nil {
+		return err
+	}
+
+	return s.transition(ctx,
+		bson.M{"availability": models.AvailabilityScheduled, "publish_at": bson.M{"$lte": now}, "deleted_at": nil, "status": readyStatus},
+		models.AvailabilityLive, EventVideoPublished)
+}
+
+// transition claims matching videos one at a time, recording an event for
+// each in the same transaction, so that several replicas can run the
+// scheduler without emitting an event twice
+func (s *Scheduler) transition(ctx context.Context, filter bson.M, to models.Availability, eventType EventType) error {
+	collection := s.Service.DB.Collection("videos")
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	for ctx.Err() == nil {
+		err := s.Service.inTransaction(ctx, func(sc mongo.SessionContext) error {
+			var metadata models.VideoMetadata
+			err := collection.FindOneAndUpdate(sc, filter, bson.M{"$set": bson.M{"availability": to}}, opts).Decode(&metadata)
+			if err != nil {
+				return err
+			}
+			return s.Service.recordEvent(sc, eventType, &metadata)
+		})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
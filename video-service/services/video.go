@@ -2,21 +2,31 @@ package services
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"video-service/apperrors"
+	"video-service/metrics"
 	"video-service/models"
+	"video-service/tracing"
 	"video-service/utils"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type VideoService struct {
@@ -24,12 +34,22 @@ type VideoService struct {
 	S3Client  *s3.Client
 	Bucket    string
 	Uploader  *manager.Uploader
+	// FFprobePath is the ffprobe binary used to read video durations
+	FFprobePath string
+	// ScratchDir is where uploads are staged; empty means the system temporary directory
+	ScratchDir  string
+	// Scanner checks uploads for malware before they are made public
+	Scanner     Scanner
+	// QuarantinePrefix is where infected uploads are moved in the bucket
+	QuarantinePrefix string
+	// Moderated holds new videos private until moderation approves them
+	Moderated   bool
 }
 
 // NewVideoService initializes a new VideoService
-func NewVideoService(client *mongo.Client) (*VideoService, error) {
+func NewVideoService(ctx context.Context, db *mongo.Database, region, bucket string) (*VideoService, error) {
 	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(utils.GetEnv("AWS_REGION", "")))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
@@ -38,59 +58,112 @@ func NewVideoService(client *mongo.Client) (*VideoService, error) {
 	uploader := manager.NewUploader(s3Client)
 
 	return &VideoService{
-		DB:       client.Database("video_service_meta"),
-		S3Client: s3Client,
-		Bucket:   utils.GetEnv("AWS_S3_BUCKET", ""),
-		Uploader: uploader,
+		DB:          db,
+		S3Client:    s3Client,
+		Bucket:      bucket,
+		Uploader:    uploader,
+		FFprobePath: "ffprobe",
+		Scanner:     NoopScanner{},
+		QuarantinePrefix: "quarantine/",
 	}, nil
 }
 
-func (vs *VideoService) SaveVideoMetadata(metadata models.VideoMetadata) (models.VideoMetadata, error) {
+// SaveVideoMetadata inserts a new video and records its video.uploaded event
+func (vs *VideoService) SaveVideoMetadata(ctx context.Context, metadata models.VideoMetadata) (models.VideoMetadata, error) {
+    return vs.insertVideo(ctx, metadata, EventVideoUploaded)
+}
+
+// insertVideo inserts a new video and records eventType for it
+func (vs *VideoService) insertVideo(ctx context.Context, metadata models.VideoMetadata, eventType EventType) (models.VideoMetadata, error) {
     collection := vs.DB.Collection("videos")
-    result, err := collection.InsertOne(context.TODO(), metadata)
+    err := vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+        metadata.ID = primitive.NilObjectID
+        result, err := collection.InsertOne(sc, metadata)
+        if err != nil {
+            return err
+        }
+
+        // Assert that the InsertedID is of type primitive.ObjectID
+        if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+            metadata.ID = oid // Assign the ObjectID to the metadata struct
+        } else {
+            return fmt.Errorf("failed to cast InsertedID to ObjectID")
+        }
+
+        return vs.recordEvent(sc, eventType, &metadata)
+    })
     if err != nil {
         return metadata, err
     }
 
-    // Assert that the InsertedID is of type primitive.ObjectID
-    if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
-        metadata.ID = oid // Assign the ObjectID to the metadata struct
-    } else {
-        return metadata, fmt.Errorf("failed to cast InsertedID to ObjectID")
-    }
-
     return metadata, nil
 }
 
-func (vs *VideoService) CreateAndSaveMetadata(title string, tags []string, duration int, videoURL, thumbnailURL, thumbnailType, contentType string) (models.VideoMetadata, error) {
+// VideoDetails holds the fields of a new video supplied by its uploader
+type VideoDetails struct {
+    OwnerID    string
+    Title      string
+    Tags       []string
+    Visibility VisibilitySettings
+    Schedule   ScheduleSettings
+    ContentHash string // Optional hex SHA-256 of the video file
+}
+
+func (vs *VideoService) CreateAndSaveMetadata(ctx context.Context, details VideoDetails, duration int, size int64, videoURL, thumbnailURL, thumbnailType, contentType string) (models.VideoMetadata, error) {
     metadata := models.VideoMetadata{
-        Title:         title,
-        Tags:          tags,
+        OwnerID:       details.OwnerID,
+        Title:         details.Title,
+        Tags:          details.Tags,
         Duration:      duration,
         URL:           videoURL,
         Thumbnail:     thumbnailURL,
         ThumbnailType: thumbnailType,
         UploadedAt:    time.Now(),
         ContentType:   contentType,
+        Size:          size,
+        ContentHash:   details.ContentHash,
+        Status:        models.StatusReady,
     }
-	return vs.SaveVideoMetadata(metadata); 
+    vs.holdForModeration(&metadata, metadata.UploadedAt)
+    if err := applyVisibility(&metadata, details.Visibility); err != nil {
+        return metadata, err
+    }
+    if err := applySchedule(&metadata, details.Schedule); err != nil {
+        return metadata, err
+    }
+    if mediaReadable(&metadata) {
+        if err := vs.syncMediaACL(ctx, &metadata); err != nil {
+            return metadata, err
+        }
+    }
+	return vs.SaveVideoMetadata(ctx, metadata); 
 }
 
-// GetVideoMetadata retrieves video metadata by ID
-func (vs *VideoService) GetVideoMetadata(id string) (*models.VideoMetadata, error) {
+// GetVideoMetadata retrieves video metadata by ID. Deleted videos are not found.
+func (vs *VideoService) GetVideoMetadata(ctx context.Context, id string) (*models.VideoMetadata, error) {
+	return vs.findVideo(ctx, id, false)
+}
+
+// findVideo retrieves a video by ID, skipping deleted videos unless includeDeleted is set
+func (vs *VideoService) findVideo(ctx context.Context, id string, includeDeleted bool) (*models.VideoMetadata, error) {
 	collection := vs.DB.Collection("videos")
 
 	// Convert the id string to a MongoDB ObjectID
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New("invalid video ID format")
+		return nil, apperrors.InvalidArgument("Invalid video ID format").WithDetail("id", id)
+	}
+
+	filter := bson.M{"_id": objectID}
+	if !includeDeleted {
+		filter["deleted_at"] = nil
 	}
 
 	var metadata models.VideoMetadata
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&metadata)
+	err = collection.FindOne(ctx, filter).Decode(&metadata)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("metadata not found")
+			return nil, apperrors.NotFound("Video not found").WithDetail("id", id)
 		}
 		return nil, err
 	}
@@ -98,56 +171,204 @@ func (vs *VideoService) GetVideoMetadata(id string) (*models.VideoMetadata, erro
 	return &metadata, nil
 }
 
-// ProcessAndUploadVideo handles S3 upload and duration calculation
-func (vs *VideoService) ProcessAndUploadVideo(fileName, contentType string, file io.Reader) (string, int, error) {
+// MaxBatchSize caps the number of IDs accepted by GetVideosByIDs
+const MaxBatchSize = 100
+
+// GetVideosByIDs retrieves several videos with a single query. Found videos
+// are returned in the order of ids; malformed and unknown IDs, and those of
+// videos visible rejects, are returned separately, also in request order. A
+// nil visible accepts every video.
+func (vs *VideoService) GetVideosByIDs(ctx context.Context, ids []string, visible func(*models.VideoMetadata) bool) ([]models.VideoMetadata, []string, error) {
+	if len(ids) > MaxBatchSize {
+		return nil, nil, apperrors.InvalidArgument(fmt.Sprintf("At most %d IDs can be requested at once", MaxBatchSize)).WithDetail("max", MaxBatchSize)
+	}
+	collection := vs.DB.Collection("videos")
+
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+
+	byID := make(map[primitive.ObjectID]models.VideoMetadata, len(objectIDs))
+	if len(objectIDs) > 0 {
+		cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": objectIDs}, "deleted_at": nil})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to look up videos: %w", err)
+		}
+		var videos []models.VideoMetadata
+		if err := cursor.All(ctx, &videos); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode videos: %w", err)
+		}
+		for _, video := range videos {
+			byID[video.ID] = video
+		}
+	}
+
+	// IDs are matched parsed, since hex is accepted in either case
+	found := []models.VideoMetadata{}
+	missing := []string{}
+	for _, id := range ids {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		video, ok := byID[objectID]
+		if err == nil && ok && (visible == nil || visible(&video)) {
+			found = append(found, video)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing, nil
+}
+
+// readyStatus matches videos that are playable, including those stored
+// before statuses existed
+var readyStatus = bson.M{"$in": bson.A{models.StatusReady, nil}}
+
+// ListVideos returns public videos, newest first, optionally filtered by a
+// title search and a tag. Unlisted, private and password-protected videos are
+// never returned, nor are videos outside their publishing window or still
+// being imported.
+func (vs *VideoService) ListVideos(ctx context.Context, query, tag string, limit, offset int64) ([]models.VideoMetadata, error) {
+	collection := vs.DB.Collection("videos")
+
+	// Documents stored before visibility existed have no field and are public
+	filter := availableFilter(time.Now())
+	filter["visibility"] = bson.M{"$in": bson.A{models.VisibilityPublic, nil}}
+	filter["deleted_at"] = nil
+	filter["status"] = readyStatus
+	if query != "" {
+		filter["title"] = primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+	}
+	if tag != "" {
+		filter["tags"] = tag
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "uploaded_at", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+
+	videos := []models.VideoMetadata{}
+	if err := cursor.All(ctx, &videos); err != nil {
+		return nil, fmt.Errorf("failed to decode videos: %w", err)
+	}
+	return videos, nil
+}
+
+// ProcessAndUploadVideo streams a video to S3 under key, which should come
+// from NewObjectKey, and calculates its duration. The stream is copied to a
+// temporary file as it uploads so ffprobe can read it afterwards without
+// buffering the video in memory.
+func (vs *VideoService) ProcessAndUploadVideo(ctx context.Context, key, contentType string, file io.Reader) (string, int, error) {
 	// Ensure the content type is a video
 	if !utils.IsVideoContentType(contentType) {
-		return "", 0, fmt.Errorf("unsupported file type: %s", contentType)
+		return "", 0, apperrors.Unsupported(fmt.Sprintf("Unsupported file type: %s", contentType))
 	}
 
-	// Upload the video to S3
-	result, err := vs.Uploader.Upload(context.TODO(), &s3.PutObjectInput{
-		Bucket:      &vs.Bucket,
-		Key:         &fileName,
-		Body:        file,
-		ContentType: &contentType,
-		ACL:         "public-read",
-	})
+	tmpFile, err := utils.CreateTemporaryFile(vs.ScratchDir, key)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to upload to S3: %w", err)
+		return "", 0, err
 	}
+	defer utils.RemoveTemporaryFile(tmpFile)
 
-	// Save the file temporarily to calculate duration
-	tmpFilePath, err := utils.SaveTemporaryFile(fileName, file)
+	// Upload the video to S3, scanning it on the way
+	location, err := vs.uploadScanned(ctx, "upload_video", key, contentType, io.TeeReader(file, tmpFile))
 	if err != nil {
-		return result.Location, 0, fmt.Errorf("failed to create temporary file: %w", err)
+		if _, ok := apperrors.As(err); ok {
+			return "", 0, err
+		}
+		return "", 0, apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to upload video to storage")
 	}
-	defer os.Remove(tmpFilePath)
 
 	// Calculate video duration using ffprobe
-	duration, err := utils.CalculateVideoDuration(tmpFilePath)
+	duration, err := utils.CalculateVideoDuration(ctx, vs.FFprobePath, tmpFile.Name())
 	if err != nil {
-		return result.Location, 0, fmt.Errorf("failed to calculate video duration: %w", err)
+		vs.RemoveFiles(ctx, location)
+		return "", 0, fmt.Errorf("failed to calculate video duration: %w", err)
 	}
 
-	return result.Location, duration, nil
+	return location, duration, nil
 }
 
-func (vs *VideoService) UploadThumbnail(fileName, contentType string, file io.Reader) (string, error) {
+// UploadThumbnail streams a thumbnail to S3 under key, which should come
+// from NewObjectKey
+func (vs *VideoService) UploadThumbnail(ctx context.Context, key, contentType string, file io.Reader) (string, error) {
 	if !utils.IsVideoContentType(contentType) && !utils.IsImageContentType(contentType) {
-		return "", fmt.Errorf("invalid thumbnail type: %s", contentType)
+		return "", apperrors.Unsupported(fmt.Sprintf("Invalid thumbnail type: %s", contentType))
+	}
+
+	location, err := vs.uploadScanned(ctx, "upload_thumbnail", key, contentType, file)
+	if err != nil {
+		if _, ok := apperrors.As(err); ok {
+			return "", err
+		}
+		return "", apperrors.Wrap(apperrors.CodeUnavailable, err, "Failed to upload thumbnail to storage")
 	}
 
-	result, err := vs.Uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	return location, nil
+}
+
+// NewObjectKey returns a fresh, unique key for a file uploaded by ownerID:
+// <ownerID>/<uuid><ext>. Only the extension of the client's file name is
+// kept, so an upload can never replace, or get deleted in place of, another
+// object.
+func NewObjectKey(ownerID, fileName string) string {
+	return keySegment(ownerID) + "/" + uuid.NewString() + keyExtension(fileName)
+}
+
+// keySegment reduces s to characters that are safe in a key segment
+func keySegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
+		}
+		return '_'
+	}, s)
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// keyExtension returns the lowercased extension of fileName, or nothing if it
+// is not a short alphanumeric one
+func keyExtension(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// upload streams body to the bucket under key with the given ACL, timing it
+// as operation
+func (vs *VideoService) upload(ctx context.Context, operation, key, contentType string, acl types.ObjectCannedACL, body io.Reader) (string, error) {
+	ctx, span := tracing.Start(ctx, "s3."+operation,
+		attribute.String("aws.s3.bucket", vs.Bucket),
+		attribute.String("aws.s3.key", key))
+	start := time.Now()
+	result, err := vs.Uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:      &vs.Bucket,
-		Key:         &fileName,
-		Body:        file,
+		Key:         &key,
+		Body:        body,
 		ContentType: &contentType,
-		ACL:         "public-read",
+		ACL:         acl,
 	})
+	metrics.ObserveStorage(operation, start, err)
+	tracing.End(span, err)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload thumbnail: %w", err)
+		return "", err
 	}
-
 	return result.Location, nil
 }
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewObjectKey(t *testing.T) {
+	tests := []struct {
+		ownerID    string
+		fileName   string
+		wantPrefix string
+		wantExt    string
+	}{
+		{ownerID: "user-1", fileName: "clip.mp4", wantPrefix: "user-1/", wantExt: ".mp4"},
+		{ownerID: "user_1", fileName: "Clip.MOV", wantPrefix: "user_1/", wantExt: ".mov"},
+		{ownerID: "../../etc", fileName: "clip.mp4", wantPrefix: "______etc/", wantExt: ".mp4"},
+		{ownerID: "", fileName: "clip.mp4", wantPrefix: "_/", wantExt: ".mp4"},
+		{ownerID: "ünïcode", fileName: "clip", wantPrefix: "_n_code/"},
+		{ownerID: "user", fileName: "../../clip.mp4?x=1", wantPrefix: "user/"},
+		{ownerID: "user", fileName: "clip.tar.gz", wantPrefix: "user/", wantExt: ".gz"},
+		{ownerID: "user", fileName: "clip.verylongextension", wantPrefix: "user/"},
+	}
+	for _, tt := range tests {
+		key := NewObjectKey(tt.ownerID, tt.fileName)
+		id, found := strings.CutPrefix(key, tt.wantPrefix)
+		if !found {
+			t.Errorf("NewObjectKey(%q, %q) = %q, want prefix %q", tt.ownerID, tt.fileName, key, tt.wantPrefix)
+			continue
+		}
+		id, found = strings.CutSuffix(id, tt.wantExt)
+		if _, err := uuid.Parse(id); !found || err != nil {
+			t.Errorf("NewObjectKey(%q, %q) = %q, want %s<uuid>%s", tt.ownerID, tt.fileName, key, tt.wantPrefix, tt.wantExt)
+		}
+	}
+}
+
+func TestNewObjectKeyUnique(t *testing.T) {
+	if NewObjectKey("user", "clip.mp4") == NewObjectKey("user", "clip.mp4") {
+		t.Error("NewObjectKey returned the same key twice")
+	}
+}
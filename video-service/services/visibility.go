@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"video-service/apperrors"
+	"video-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// VisibilitySettings describes the requested visibility of a video
+type VisibilitySettings struct {
+	Visibility   models.Visibility `json:"visibility"`
+	AllowedUsers []string          `json:"allowed_users"`
+	Password     string            `json:"password"`
+}
+
+// Validate checks that the settings are complete for the requested visibility
+func (s VisibilitySettings) Validate() error {
+	if !s.Visibility.IsValid() {
+		return apperrors.InvalidArgument(fmt.Sprintf("Invalid visibility: %q", s.Visibility))
+	}
+	if s.Visibility == models.VisibilityPasswordProtected && s.Password == "" {
+		return apperrors.InvalidArgument("Password is required for password-protected videos")
+	}
+	return nil
+}
+
+// applyVisibility copies the settings onto metadata, hashing any password
+func applyVisibility(metadata *models.VideoMetadata, settings VisibilitySettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	metadata.Visibility = settings.Visibility
+	metadata.AllowedUsers = nil
+	metadata.PasswordHash = ""
+
+	switch settings.Visibility {
+	case models.VisibilityPrivate:
+		metadata.AllowedUsers = settings.AllowedUsers
+	case models.VisibilityPasswordProtected:
+		hash, err := bcrypt.GenerateFromPassword([]byte(settings.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		metadata.PasswordHash = string(hash)
+	}
+	return nil
+}
+
+// UpdateVisibility changes the visibility of an existing video
+func (vs *VideoService) UpdateVisibility(ctx context.Context, id string, settings VisibilitySettings) (*models.VideoMetadata, error) {
+	metadata, err := vs.GetVideoMetadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyVisibility(metadata, settings); err != nil {
+		return nil, err
+	}
+
+	// Files are locked down before the video stops being public, and opened
+	// up only after it has become public
+	public := mediaReadable(metadata)
+	if !public {
+		if err := vs.syncMediaACL(ctx, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	collection := vs.DB.Collection("videos")
+	err = vs.inTransaction(ctx, func(sc mongo.SessionContext) error {
+		result, err := collection.UpdateOne(sc, bson.M{"_id": metadata.ID, "deleted_at": nil}, bson.M{"$set": bson.M{
+			"visibility":    metadata.Visibility,
+			"allowed_users": metadata.AllowedUsers,
+			"password_hash": metadata.PasswordHash,
+		}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			// Deleted since it was read
+			return apperrors.NotFound("Video not found").WithDetail("id", id)
+		}
+		return vs.recordEvent(sc, EventVideoUpdated, metadata)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update visibility: %w", err)
+	}
+	if public {
+		if err := vs.syncMediaACL(ctx, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return metadata, nil
+}
+
+// mediaLinkTTL is how long the links to files of non-public videos work
+const mediaLinkTTL = time.Hour
+
+// mediaReadable reports whether anyone may read a video's files straight
+// from the bucket: the video is public and ready to play
+func mediaReadable(metadata *models.VideoMetadata) bool {
+	return metadata.EffectiveVisibility() == models.VisibilityPublic && metadata.EffectiveStatus() == models.StatusReady
+}
+
+// syncMediaACL makes the video's files public-read if mediaReadable, and
+// private otherwise
+func (vs *VideoService) syncMediaACL(ctx context.Context, metadata *models.VideoMetadata) error {
+	public := mediaReadable(metadata)
+	for _, location := range []string{metadata.URL, metadata.Thumbnail} {
+		if key, ok := vs.ObjectKey(location); ok {
+			if err := vs.setACL(ctx, key, public); err != nil {
+				return fmt.Errorf("failed to update access to %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SignMediaLinks replaces the file URLs of a video that is not publicly
+// readable with time-limited links. Call it only once the caller has been
+// allowed to watch the video.
+func (vs *VideoService) SignMediaLinks(ctx context.Context, metadata *models.VideoMetadata) error {
+	if mediaReadable(metadata) {
+		return nil
+	}
+	var err error
+	if metadata.URL, err = vs.PresignVideo(ctx, metadata.URL, mediaLinkTTL); err != nil {
+		return err
+	}
+	if metadata.Thumbnail != "" {
+		if metadata.Thumbnail, err = vs.PresignVideo(ctx, metadata.Thumbnail, mediaLinkTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckVideoPassword reports whether password unlocks a password-protected video
+func (vs *VideoService) CheckVideoPassword(metadata *models.VideoMetadata, password string) bool {
+	if metadata.EffectiveVisibility() != models.VisibilityPasswordProtected {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(metadata.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"video-service/apperrors"
+	"video-service/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMediaReadable(t *testing.T) {
+	tests := []struct {
+		visibility models.Visibility
+		status     models.Status
+		want       bool
+	}{
+		{visibility: models.VisibilityPublic, status: models.StatusReady, want: true},
+		{visibility: "", status: "", want: true}, // Stored before visibility and statuses existed
+		{visibility: models.VisibilityPublic, status: models.StatusInReview, want: false},
+		{visibility: models.VisibilityPublic, status: models.StatusModerating, want: false},
+		{visibility: models.VisibilityPublic, status: models.StatusRejected, want: false},
+		{visibility: models.VisibilityUnlisted, status: models.StatusReady, want: false},
+		{visibility: models.VisibilityPrivate, status: models.StatusReady, want: false},
+		{visibility: models.VisibilityPasswordProtected, status: models.StatusReady, want: false},
+	}
+	for _, tt := range tests {
+		metadata := &models.VideoMetadata{Visibility: tt.visibility, Status: tt.status}
+		if got := mediaReadable(metadata); got != tt.want {
+			t.Errorf("mediaReadable(%q, %q) = %v, want %v", tt.visibility, tt.status, got, tt.want)
+		}
+	}
+}
+
+// assertDeletedSinceRead checks that an update of a video that was deleted
+// after it was read fails as not found, without recording an event
+func assertDeletedSinceRead(mt *mtest.T, err error) {
+	mt.Helper()
+	if appErr, ok := apperrors.As(err); !ok || appErr.Code != apperrors.CodeNotFound {
+		mt.Fatalf("error = %v, want not found", err)
+	}
+	var update *event.CommandStartedEvent
+	for _, started := range mt.GetAllStartedEvents() {
+		switch started.CommandName {
+		case "update":
+			update = started
+		case "insert", "findAndModify":
+			mt.Errorf("recorded an event for a deleted video: %s", started.Command)
+		}
+	}
+	if update == nil {
+		mt.Fatal("the video was not updated")
+	}
+	filter := update.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+	if deleted, err := filter.LookupErr("deleted_at"); err != nil || deleted.Type != bson.TypeNull {
+		mt.Errorf("update filter %s does not exclude deleted videos", filter)
+	}
+}
+
+// deletedSinceRead returns the replies for a video that is found by the
+// read and then missed by the update
+func deletedSinceRead(mt *mtest.T, id primitive.ObjectID, fields ...bson.E) []bson.D {
+	doc := append(bson.D{{Key: "_id", Value: id}, {Key: "owner_id", Value: "owner"}}, fields...)
+	return []bson.D{
+		mtest.CreateCursorResponse(0, mt.DB.Name()+".videos", mtest.FirstBatch, doc),
+		mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		mtest.CreateSuccessResponse(), // abortTransaction
+	}
+}
+
+func TestUpdateVisibilityDeletedVideo(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("deleted", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(deletedSinceRead(mt, id)...)
+		vs := &VideoService{DB: mt.DB}
+		_, err := vs.UpdateVisibility(context.Background(), id.Hex(), VisibilitySettings{Visibility: models.VisibilityUnlisted})
+		assertDeletedSinceRead(mt, err)
+	})
+}
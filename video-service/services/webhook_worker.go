@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"video-service/logging"
+	"video-service/metrics"
+	"video-service/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers sent with every webhook request
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookRetryPolicy controls how deliveries are retried
+type WebhookRetryPolicy struct {
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	BaseDelay    time.Duration // Delay before the first retry, doubled for each one after
+	MaxDelay     time.Duration // Cap on the delay between retries
+	DisableAfter int           // Consecutive failed attempts before a webhook is disabled
+}
+
+// Backoff returns the delay before the retry that follows attempt n (1-based)
+func (p WebhookRetryPolicy) Backoff(n int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < n && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// webhookTimeout bounds one delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// WebhookWorker sends due webhook deliveries. Deliveries are claimed one at a
+// time, so several replicas can run workers side by side. Its client only
+// connects to addresses the network policy permits and does not follow
+// redirects, which would resend the delivery as a GET without its payload.
+type WebhookWorker struct {
+	DB       *mongo.Database
+	Client   *http.Client
+	Retry    WebhookRetryPolicy
+	Interval time.Duration
+}
+
+// NewWebhookWorker initializes a new WebhookWorker
+func NewWebhookWorker(db *mongo.Database, retry WebhookRetryPolicy, network NetworkPolicy, interval time.Duration) *WebhookWorker {
+	client := network.NewClient(webhookTimeout, webhookTimeout, 0)
+	client.Timeout = webhookTimeout
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &WebhookWorker{
+		DB:       db,
+		Client:   client,
+		Retry:    retry,
+		Interval: interval,
+	}
+}
+
+// Run sends due deliveries every Interval until ctx is cancelled
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		err := w.Tick(ctx)
+		metrics.ObserveJobTick("webhook_worker", start, err)
+		if err != nil {
+			slog.ErrorContext(ctx, "Webhook worker tick failed", logging.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick sends every delivery that is due now
+func (w *WebhookWorker) Tick(ctx context.Context) error {
+	for ctx.Err() == nil {
+		delivery, err := w.claim(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.deliver(ctx, delivery); err != nil {
+			slog.ErrorContext(ctx, "Failed to record webhook delivery", slog.String("delivery_id", delivery.ID.Hex()), logging.Err(err))
+		}
+	}
+	return ctx.Err()
+}
+
+// Pending counts the deliveries waiting for their next attempt, including
+// retries that are not due yet
+func (w *WebhookWorker) Pending(ctx context.Context) (int64, error) {
+	return w.DB.Collection("webhook_deliveries").CountDocuments(ctx, bson.M{"status": DeliveryPending})
+}
+
+// claim takes the next due delivery by pushing its next attempt past the
+// request timeout, so no other worker picks it up meanwhile
+func (w *WebhookWorker) claim(ctx context.Context) (*WebhookDelivery, error) {
+	now := time.Now()
+	var delivery WebhookDelivery
+	err := w.DB.Collection("webhook_deliveries").FindOneAndUpdate(ctx,
+		bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(w.Client.Timeout + time.Minute)}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// deliver makes one attempt and records its outcome on the delivery and the
+// subscription, in a span that continues the trace of the event
+func (w *WebhookWorker) deliver(ctx context.Context, delivery *WebhookDelivery) (err error) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, delivery.TraceContext), "webhook.deliver "+string(delivery.EventType),
+		trace.WithAttributes(
+			attribute.String("webhook.delivery_id", delivery.ID.Hex()),
+			attribute.Int("webhook.attempt", delivery.Attempts+1),
+		))
+	defer func() { tracing.End(span, err) }()
+
+	subs := w.DB.Collection("webhooks")
+	deliveries := w.DB.Collection("webhook_deliveries")
+
+	var sub WebhookSubscription
+	err = subs.FindOne(ctx, bson.M{"_id": delivery.SubscriptionID}).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		_, err = deliveries.DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !sub.Active {
+		// Parked until the webhook is re-enabled and the delivery redelivered
+		_, err = deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{"status": DeliveryFailed}})
+		return err
+	}
+
+	attempt := w.send(ctx, &sub, delivery)
+	attempts := delivery.Attempts + 1
+	update := bson.M{
+		"$set":  bson.M{"attempts": attempts},
+		"$push": bson.M{"attempt_log": bson.M{"$each": bson.A{attempt}, "$slice": -maxAttemptLog}},
+	}
+	set := update["$set"].(bson.M)
+
+	if attempt.Error == "" {
+		set["status"] = DeliverySucceeded
+		set["delivered_at"] = attempt.At
+		if _, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, update); err != nil {
+			return err
+		}
+		_, err := subs.UpdateOne(ctx, bson.M{"_id": sub.ID}, bson.M{"$set": bson.M{"consecutive_failures": 0}})
+		return err
+	}
+
+	if attempts >= w.Retry.MaxAttempts {
+		set["status"] = DeliveryFailed
+	} else {
+		set["next_attempt_at"] = time.Now().Add(w.Retry.Backoff(attempts))
+	}
+	if _, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, update); err != nil {
+		return err
+	}
+	return w.recordFailure(ctx, &sub)
+}
+
+// recordFailure counts a failed attempt against the subscription and
+// disables it once DisableAfter consecutive attempts have failed
+func (w *WebhookWorker) recordFailure(ctx context.Context, sub *WebhookSubscription) error {
+	var updated WebhookSubscription
+	err := w.DB.Collection("webhooks").FindOneAndUpdate(ctx,
+		bson.M{"_id": sub.ID},
+		bson.M{"$inc": bson.M{"consecutive_failures": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return err
+	}
+	if w.Retry.DisableAfter <= 0 || updated.ConsecutiveFailures < w.Retry.DisableAfter || !updated.Active {
+		return nil
+	}
+
+	slog.WarnContext(ctx, "Disabling webhook after consecutive failures", slog.String("webhook_id", sub.ID.Hex()), slog.Int("failures", updated.ConsecutiveFailures))
+	_, err = w.DB.Collection("webhooks").UpdateOne(ctx, bson.M{"_id": sub.ID}, bson.M{"$set": bson.M{
+		"active":      false,
+		"disabled_at": time.Now(),
+	}})
+	return err
+}
+
+// send POSTs the delivery's payload, signed with the subscription secret and
+// carrying the trace context
+func (w *WebhookWorker) send(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) (attempt WebhookAttempt) {
+	start := time.Now()
+	attempt = WebhookAttempt{At: start}
+
+	ctx, span := tracing.Tracer().Start(ctx, "POST",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", sub.URL)))
+	defer func() {
+		if attempt.StatusCode != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", attempt.StatusCode))
+		}
+		if attempt.Error != "" {
+			span.SetStatus(codes.Error, attempt.Error)
+		}
+		span.End()
+	}()
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "video-service-webhooks/1.0")
+	req.Header.Set(WebhookIDHeader, delivery.ID.Hex())
+	req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, timestamp, []byte(delivery.Payload)))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		attempt.DurationMS = time.Since(start).Milliseconds()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode <= 399:
+		attempt.Error = fmt.Sprintf("unexpected redirect %d to %q; webhooks do not follow redirects", resp.StatusCode, resp.Header.Get("Location"))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	return attempt
+}
+
+// SignWebhook returns the signature header value for a payload: the hex
+// HMAC-SHA256, keyed by the webhook secret, of "<timestamp>.<payload>"
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
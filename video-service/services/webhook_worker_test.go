@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		payload   string
+		want      string
+	}{
+		{
+			name:      "payload",
+			secret:    "whsec_test",
+			timestamp: "1700000000",
+			payload:   `{"id":"1"}`,
+			want:      "sha256=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5",
+		},
+		{
+			name:      "empty",
+			secret:    "",
+			timestamp: "0",
+			payload:   "",
+			want:      "sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhook(tt.secret, tt.timestamp, []byte(tt.payload)); got != tt.want {
+				t.Errorf("SignWebhook() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignWebhookCoversTimestamp(t *testing.T) {
+	payload := []byte(`{"id":"1"}`)
+	if SignWebhook("secret", "1700000000", payload) == SignWebhook("secret", "1700000001", payload) {
+		t.Error("signatures for different timestamps are equal")
+	}
+	if SignWebhook("secret", "1700000000", payload) == SignWebhook("other", "1700000000", payload) {
+		t.Error("signatures for different secrets are equal")
+	}
+}
+
+func TestWebhookRetryPolicyBackoff(t *testing.T) {
+	policy := WebhookRetryPolicy{BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 30 * time.Second},
+		{attempt: 2, want: time.Minute},
+		{attempt: 3, want: 2 * time.Minute},
+		{attempt: 7, want: 32 * time.Minute},
+		{attempt: 8, want: time.Hour},
+		{attempt: 1000, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookWorkerSend(t *testing.T) {
+	var followed atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	})
+	mux.HandleFunc("/hook/{status}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get(WebhookSignatureHeader) == "" {
+			t.Errorf("got %s without a signature", r.Method)
+		}
+		if strings.HasPrefix(r.PathValue("status"), "3") {
+			w.Header().Set("Location", "/moved")
+		}
+		status, _ := strconv.Atoi(r.PathValue("status"))
+		w.WriteHeader(status)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	network, err := ParseNetworkPolicy([]string{"127.0.0.0/8", "::1/128"})
+	if err != nil {
+		t.Fatalf("ParseNetworkPolicy() error = %v", err)
+	}
+	worker := NewWebhookWorker(nil, WebhookRetryPolicy{}, network, time.Minute)
+
+	tests := []struct {
+		status    string
+		wantError string
+	}{
+		{status: "200"},
+		{status: "204"},
+		{status: "301", wantError: "redirect"},
+		{status: "302", wantError: "redirect"},
+		{status: "307", wantError: "redirect"},
+		{status: "410", wantError: "unexpected status 410"},
+		{status: "500", wantError: "unexpected status 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			sub := &WebhookSubscription{URL: server.URL + "/hook/" + tt.status, Secret: "whsec_test"}
+			delivery := &WebhookDelivery{ID: primitive.NewObjectID(), EventType: EventVideoUploaded, Payload: `{"id":"1"}`}
+			attempt := worker.send(context.Background(), sub, delivery)
+			if tt.wantError == "" && attempt.Error != "" {
+				t.Errorf("send() error = %q, want none", attempt.Error)
+			}
+			if !strings.Contains(attempt.Error, tt.wantError) {
+				t.Errorf("send() error = %q, want %q", attempt.Error, tt.wantError)
+			}
+		})
+	}
+	if followed.Load() {
+		t.Error("a redirect was followed")
+	}
+}
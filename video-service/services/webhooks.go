@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+	"video-service/apperrors"
+	"video-service/tracing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeliveryStatus tracks a webhook delivery through its retries
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"   // Waiting for its next attempt
+	DeliverySucceeded DeliveryStatus = "succeeded" // Acknowledged with a 2xx response
+	DeliveryFailed    DeliveryStatus = "failed"    // Gave up after the last attempt
+)
+
+// maxAttemptLog caps the attempts kept in a delivery's log
+const maxAttemptLog = 20
+
+// WebhookSubscription asks for a user's video events to be pushed to a URL
+type WebhookSubscription struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty"`
+	OwnerID             string             `bson:"owner_id"`
+	URL                 string             `bson:"url"`
+	Secret              string             `bson:"secret"`
+	Events              []EventType        `bson:"events"` // Empty means every event
+	Active              bool               `bson:"active"`
+	ConsecutiveFailures int                `bson:"consecutive_failures"`
+	DisabledAt          *time.Time         `bson:"disabled_at,omitempty"`
+	CreatedAt           time.Time          `bson:"created_at"`
+}
+
+// Wants reports whether the subscription filters in events of type t
+func (s *WebhookSubscription) Wants(t EventType) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAttempt records one try at delivering a webhook
+type WebhookAttempt struct {
+	At         time.Time `bson:"at"`
+	StatusCode int       `bson:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty"`
+	DurationMS int64     `bson:"duration_ms"`
+}
+
+// WebhookDelivery is one event to be sent to one subscription, and its log
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id"`
+	EventID        string             `bson:"event_id"`
+	EventType      EventType          `bson:"event_type"`
+	VideoID        string             `bson:"video_id"`
+	Payload        string             `bson:"payload"`
+	Status         DeliveryStatus     `bson:"status"`
+	Attempts       int                `bson:"attempts"`
+	NextAttemptAt  time.Time          `bson:"next_attempt_at"`
+	AttemptLog     []WebhookAttempt   `bson:"attempt_log"`
+	CreatedAt      time.Time          `bson:"created_at"`
+	DeliveredAt    *time.Time         `bson:"delivered_at,omitempty"`
+	TraceContext   map[string]string  `bson:"trace_context,omitempty"` // Trace of the event's relay
+}
+
+// WebhookSettings are the user-editable fields of a subscription
+type WebhookSettings struct {
+	URL    string
+	Events []EventType
+}
+
+// Validate checks the URL and event filters
+func (s WebhookSettings) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return apperrors.InvalidArgument("url must be an absolute http or https URL")
+	}
+	for _, e := range s.Events {
+		if !e.IsValid() {
+			return apperrors.InvalidArgument(fmt.Sprintf("Unknown event type: %s", e))
+		}
+	}
+	return nil
+}
+
+// ErrWebhookAddressNotAllowed is returned when a webhook URL resolves to an
+// address the service may not connect to
+var ErrWebhookAddressNotAllowed = apperrors.InvalidArgument("Webhook address is not allowed")
+
+// WebhookService stores webhook subscriptions and turns events into
+// deliveries for them. It is an EventPublisher fed by the outbox relay;
+// WebhookWorker performs the deliveries.
+type WebhookService struct {
+	DB      *mongo.Database
+	Network NetworkPolicy // Addresses webhook URLs may resolve to
+}
+
+// NewWebhookService initializes a new WebhookService
+func NewWebhookService(db *mongo.Database, network NetworkPolicy) *WebhookService {
+	return &WebhookService{DB: db, Network: network}
+}
+
+// EnsureWebhookIndexes creates the indexes used to find subscriptions and due
+// deliveries, and the one that makes fan-out idempotent
+func (ws *WebhookService) EnsureWebhookIndexes(ctx context.Context) error {
+	_, err := ws.DB.Collection("webhooks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "active", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook index: %w", err)
+	}
+	_, err = ws.DB.Collection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+	return nil
+}
+
+// CreateSubscription registers a webhook with a freshly generated secret
+func (ws *WebhookService) CreateSubscription(ctx context.Context, ownerID string, settings WebhookSettings) (*WebhookSubscription, error) {
+	if err := ws.validate(ctx, settings); err != nil {
+		return nil, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := WebhookSubscription{
+		OwnerID:   ownerID,
+		URL:       settings.URL,
+		Secret:    secret,
+		Events:    settings.Events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	if sub.Events == nil {
+		sub.Events = []EventType{}
+	}
+	result, err := ws.DB.Collection("webhooks").InsertOne(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %w", err)
+	}
+	sub.ID = result.InsertedID.(primitive.ObjectID)
+	return &sub, nil
+}
+
+// validate checks settings and refuses URLs whose host resolves to loopback,
+// private or other addresses the network policy blocks. WebhookWorker checks
+// again on every connection, which covers DNS changes.
+func (ws *WebhookService) validate(ctx context.Context, settings WebhookSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	u, _ := url.Parse(settings.URL)
+	err := ws.Network.Check(ctx, u.Hostname())
+	switch {
+	case isAddressNotAllowed(err):
+		return ErrWebhookAddressNotAllowed.WithDetail("host", u.Hostname())
+	case err != nil:
+		return apperrors.Wrap(apperrors.CodeInvalidArgument, err, "Webhook host could not be resolved").WithDetail("host", u.Hostname())
+	}
+	return nil
+}
+
+// ListSubscriptions returns the webhooks of ownerID
+func (ws *WebhookService) ListSubscriptions(ctx context.Context, ownerID string) ([]WebhookSubscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := ws.DB.Collection("webhooks").Find(ctx, bson.M{"owner_id": ownerID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	subs := []WebhookSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+	return subs, nil
+}
+
+// GetSubscription returns a webhook of ownerID. Other users' webhooks are
+// reported as not found.
+func (ws *WebhookService) GetSubscription(ctx context.Context, ownerID, id string) (*WebhookSubscription, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("Invalid webhook ID format").WithDetail("id", id)
+	}
+
+	var sub WebhookSubscription
+	err = ws.DB.Collection("webhooks").FindOne(ctx, bson.M{"_id": objectID, "owner_id": ownerID}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, apperrors.NotFound("Webhook not found").WithDetail("id", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// UpdateSubscription changes a webhook's URL and filters. A non-nil active
+// enables or disables the webhook; enabling it clears its failure count.
+func (ws *WebhookService) UpdateSubscription(ctx context.Context, ownerID, id string, settings WebhookSettings, active *bool) (*WebhookSubscription, error) {
+	if err := ws.validate(ctx, settings); err != nil {
+		return nil, err
+	}
+	sub, err := ws.GetSubscription(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.URL = settings.URL
+	sub.Events = settings.Events
+	if sub.Events == nil {
+		sub.Events = []EventType{}
+	}
+	set := bson.M{"url": sub.URL, "events": sub.Events}
+	update := bson.M{"$set": set}
+	if active != nil {
+		sub.Active = *active
+		set["active"] = sub.Active
+		if sub.Active {
+			sub.ConsecutiveFailures, sub.DisabledAt = 0, nil
+			set["consecutive_failures"] = 0
+			update["$unset"] = bson.M{"disabled_at": ""}
+		}
+	}
+
+	if _, err := ws.DB.Collection("webhooks").UpdateOne(ctx, bson.M{"_id": sub.ID}, update); err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return sub, nil
+}
+
+// DeleteSubscription removes a webhook and its pending deliveries
+func (ws *WebhookService) DeleteSubscription(ctx context.Context, ownerID, id string) error {
+	sub, err := ws.GetSubscription(ctx, ownerID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.DB.Collection("webhooks").DeleteOne(ctx, bson.M{"_id": sub.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if _, err := ws.DB.Collection("webhook_deliveries").DeleteMany(ctx, bson.M{"subscription_id": sub.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns a webhook's deliveries, newest first
+func (ws *WebhookService) ListDeliveries(ctx context.Context, ownerID, id string, limit, offset int64) ([]WebhookDelivery, error) {
+	sub, err := ws.GetSubscription(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit).SetSkip(offset)
+	cursor, err := ws.DB.Collection("webhook_deliveries").Find(ctx, bson.M{"subscription_id": sub.ID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	deliveries := []WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver queues a delivery to be sent again right away, whatever its
+// status. The webhook must be active.
+func (ws *WebhookService) Redeliver(ctx context.Context, ownerID, id, deliveryID string) (*WebhookDelivery, error) {
+	sub, err := ws.GetSubscription(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.Active {
+		return nil, apperrors.Conflict("Webhook is disabled; re-enable it before redelivering")
+	}
+	objectID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return nil, apperrors.InvalidArgument("Invalid delivery ID format").WithDetail("id", deliveryID)
+	}
+
+	var delivery WebhookDelivery
+	err = ws.DB.Collection("webhook_deliveries").FindOneAndUpdate(ctx,
+		bson.M{"_id": objectID, "subscription_id": sub.ID},
+		bson.M{"$set": bson.M{"status": DeliveryPending, "next_attempt_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, apperrors.NotFound("Delivery not found").WithDetail("id", deliveryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Publish queues a delivery of the event for each matching active webhook of
+// the video's owner. Redelivered events are ignored by the unique index.
+func (ws *WebhookService) Publish(ctx context.Context, event VideoEvent) error {
+	if event.OwnerID == "" {
+		return nil
+	}
+	cursor, err := ws.DB.Collection("webhooks").Find(ctx, bson.M{"owner_id": event.OwnerID, "active": true})
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	var subs []WebhookSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, sub := range subs {
+		if !sub.Wants(event.Type) {
+			continue
+		}
+		_, err := ws.DB.Collection("webhook_deliveries").InsertOne(ctx, WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			VideoID:        event.VideoID,
+			Payload:        string(payload),
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+			AttemptLog:     []WebhookAttempt{},
+			CreatedAt:      now,
+			TraceContext:   tracing.Inject(ctx),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mongoSpanKey identifies a command in flight; request IDs are only unique
+// per connection
+type mongoSpanKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// MongoMonitor starts a client span for every MongoDB command issued with a
+// traced context, as a child of its span. It chains to next, which may be
+// nil, so it can wrap another monitor.
+func MongoMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	var spans sync.Map
+	if next == nil {
+		next = &event.CommandMonitor{}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if next.Started != nil {
+				next.Started(ctx, e)
+			}
+			// Commands outside a trace, such as background polling, are not traced
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+			attrs := []attribute.KeyValue{
+				semconv.DBSystemMongoDB,
+				semconv.DBNamespace(e.DatabaseName),
+				semconv.DBOperationName(e.CommandName),
+			}
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, semconv.DBCollectionName(collection))
+			}
+			_, span := Tracer().Start(ctx, "mongodb."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			spans.Store(mongoSpanKey{e.ConnectionID, e.RequestID}, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			if span, ok := spans.LoadAndDelete(mongoSpanKey{e.ConnectionID, e.RequestID}); ok {
+				span.(trace.Span).End()
+			}
+			if next.Succeeded != nil {
+				next.Succeeded(ctx, e)
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			if span, ok := spans.LoadAndDelete(mongoSpanKey{e.ConnectionID, e.RequestID}); ok {
+				span.(trace.Span).SetStatus(codes.Error, e.Failure)
+				span.(trace.Span).End()
+			}
+			if next.Failed != nil {
+				next.Failed(ctx, e)
+			}
+		},
+	}
+}
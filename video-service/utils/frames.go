@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"video-service/metrics"
+	"video-service/tracing"
+)
+
+// SampleFrames extracts up to count JPEG frames, spread evenly over a video
+// of the given duration in seconds, into dir and returns their paths. Files
+// are named prefix-N.jpg. Images give a single frame.
+func SampleFrames(ctx context.Context, ffmpegPath, filePath, dir, prefix string, duration, count int) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "ffmpeg")
+	frames, err := sampleFrames(ctx, ffmpegPath, filePath, dir, prefix, duration, count)
+	tracing.End(span, err)
+	return frames, err
+}
+
+func sampleFrames(ctx context.Context, ffmpegPath, filePath, dir, prefix string, duration, count int) ([]string, error) {
+	if duration < 1 {
+		count = 1
+	}
+	frames := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		at := float64(duration) * (float64(i) + 0.5) / float64(count)
+		out := filepath.Join(dir, fmt.Sprintf("%s-%d.jpg", prefix, i))
+		cmd := exec.CommandContext(ctx, ffmpegPath, "-v", "error", "-ss", strconv.FormatFloat(at, 'f', 3, 64),
+			"-i", filePath, "-frames:v", "1", "-vf", "scale=640:-2", "-q:v", "3", "-y", out)
+		start := time.Now()
+		output, err := cmd.CombinedOutput()
+		metrics.ObserveMediaTool("ffmpeg", start, err)
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				slog.ErrorContext(ctx, "ffmpeg failed",
+					slog.String("file", filePath),
+					slog.Int("exit_code", exitErr.ExitCode()),
+					slog.String("output", strings.TrimSpace(string(output))))
+			}
+			return frames, fmt.Errorf("failed to run ffmpeg: %w", err)
+		}
+		// Seeking near the end of some streams yields no frame
+		if _, err := os.Stat(out); err == nil {
+			frames = append(frames, out)
+		}
+	}
+	return frames, nil
+}
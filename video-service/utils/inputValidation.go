@@ -1,46 +1,89 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
-
-	"github.com/gin-gonic/gin"
+	"path/filepath"
+	"sync"
+	"video-service/apperrors"
 )
 
-// ValidateFile checks if a file exists in the request and retrieves its details
-func ValidateFile(c *gin.Context, fieldName string) (multipart.File, *multipart.FileHeader, error) {
-	file, header, err := c.Request.FormFile(fieldName)
-	if err != nil {
-		return nil, nil, errors.New("failed to retrieve file: " + err.Error())
-	}
-	return file, header, nil
+// ErrFileTooLarge is returned by a SizeLimitedReader once its limit is crossed
+var ErrFileTooLarge = apperrors.PayloadTooLarge("Upload exceeds the maximum file size")
+
+// ErrFieldTooLarge is returned by ReadFormValue for oversized form fields
+var ErrFieldTooLarge = apperrors.PayloadTooLarge("Form field is too large")
+
+// SizeLimitedReader counts the bytes read from R and fails with
+// ErrFileTooLarge as soon as more than Limit bytes have been read.
+// A Limit of 0 disables the check.
+type SizeLimitedReader struct {
+	R     io.Reader
+	Limit int64
+	N     int64
 }
 
-// ValidateRequiredField ensures that a required field is provided
-func ValidateRequiredField(c *gin.Context, fieldName, errorMessage string) (string, error) {
-	value := c.PostForm(fieldName)
-	if value == "" {
-		return "", errors.New(errorMessage)
+func (r *SizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.N += int64(n)
+	if r.Limit > 0 && r.N > r.Limit {
+		return n, ErrFileTooLarge
 	}
-	return value, nil
+	return n, err
+}
+
+// Exceeded reports whether more than Limit bytes were read
+func (r *SizeLimitedReader) Exceeded() bool {
+	return r.Limit > 0 && r.N > r.Limit
 }
 
-// SaveTemporaryFile saves a file temporarily for processing
-func SaveTemporaryFile(fileName string, file io.Reader) (string, error) {
-	tmpFilePath := "/tmp/" + fileName
-	tmpFile, err := os.Create(tmpFilePath)
+// ReadFormValue reads a text form field of at most maxSize bytes
+func ReadFormValue(r io.Reader, maxSize int64) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %w", err)
+		return "", err
 	}
-	defer tmpFile.Close()
+	if int64(len(data)) > maxSize {
+		return "", ErrFieldTooLarge
+	}
+	return string(data), nil
+}
+
+// temporaryFiles holds the paths of temporary files that have not been
+// removed yet, so they can be cleaned up on shutdown
+var temporaryFiles sync.Map
 
-	_, err = io.Copy(tmpFile, file)
+// CreateTemporaryFile creates a uniquely named temporary file in dir, or the
+// system temporary directory if dir is empty, that keeps the extension of
+// fileName, so tools that sniff by extension still work. It must be disposed
+// of with RemoveTemporaryFile.
+func CreateTemporaryFile(dir, fileName string) (*os.File, error) {
+	tmpFile, err := os.CreateTemp(dir, "upload-*"+filepath.Ext(fileName))
 	if err != nil {
-		return "", fmt.Errorf("failed to write to temporary file: %w", err)
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
 	}
+	temporaryFiles.Store(tmpFile.Name(), struct{}{})
+	return tmpFile, nil
+}
+
+// RemoveTemporaryFile closes and deletes a file made by CreateTemporaryFile
+func RemoveTemporaryFile(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+	temporaryFiles.Delete(f.Name())
+}
 
-	return tmpFilePath, nil
+// RemoveTemporaryFiles deletes every temporary file still in use, for work
+// that was aborted on shutdown. It returns how many files were removed.
+func RemoveTemporaryFiles() int {
+	removed := 0
+	temporaryFiles.Range(func(key, _ any) bool {
+		if err := os.Remove(key.(string)); err == nil {
+			removed++
+		}
+		temporaryFiles.Delete(key)
+		return true
+	})
+	return removed
 }
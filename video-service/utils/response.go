@@ -1,11 +1,57 @@
 package utils
 
 import (
+	"log/slog"
+	"net/http"
+	"video-service/apperrors"
+	"video-service/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
-func RespondWithError(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{"error": message})
+// RequestIDKey is the gin context key holding the request ID
+const RequestIDKey = "request_id"
+
+// ErrorBody is the envelope returned for every failed request
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes a failed request
+type ErrorDetail struct {
+	Code      apperrors.Code         `json:"code" example:"not_found"`
+	Message   string                 `json:"message" example:"Video not found"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// RespondWithError maps err to its HTTP status and writes the error envelope,
+// aborting the remaining handlers. Untyped errors are reported as internal
+// errors without exposing their text. Server errors, and client errors that
+// wrap a cause, are logged with the full error chain.
+func RespondWithError(c *gin.Context, err error) {
+	detail := ErrorDetail{
+		Code:      apperrors.CodeInternal,
+		Message:   "Internal server error",
+		RequestID: c.GetString(RequestIDKey),
+	}
+	appErr, ok := apperrors.As(err)
+	if ok {
+		detail.Code = appErr.Code
+		detail.Message = appErr.Message
+		detail.Details = appErr.Details
+	}
+
+	status := apperrors.HTTPStatus(detail.Code)
+	attrs := []any{slog.String("route", c.FullPath()), slog.String("code", string(detail.Code)), logging.Err(err)}
+	switch {
+	case status >= http.StatusInternalServerError:
+		slog.ErrorContext(c.Request.Context(), "Request failed", attrs...)
+	case ok && appErr.Err != nil:
+		slog.WarnContext(c.Request.Context(), "Request failed", attrs...)
+	}
+
+	c.AbortWithStatusJSON(status, ErrorBody{Error: detail})
 }
 
 // RespondWithSuccess sends a success response in a consistent format
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"video-service/apperrors"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondWithErrorLogging(t *testing.T) {
+	cause := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantLevel  string // Empty when nothing is logged
+	}{
+		{name: "untyped", err: cause, wantStatus: http.StatusInternalServerError, wantLevel: "ERROR"},
+		{name: "wrapped unavailable", err: apperrors.Wrap(apperrors.CodeUnavailable, cause, "Storage is unavailable"), wantStatus: http.StatusServiceUnavailable, wantLevel: "ERROR"},
+		{name: "unavailable", err: apperrors.Unavailable("Service is shutting down"), wantStatus: http.StatusServiceUnavailable, wantLevel: "ERROR"},
+		{name: "wrapped client error", err: apperrors.Wrap(apperrors.CodeInvalidArgument, cause, "Failed to read request body"), wantStatus: http.StatusBadRequest, wantLevel: "WARN"},
+		{name: "client error", err: apperrors.NotFound("Video not found"), wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer slog.SetDefault(slog.Default())
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			RespondWithError(c, tt.err)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantLevel == "" {
+				if logs.Len() > 0 {
+					t.Errorf("logged %q, want nothing", logs.String())
+				}
+				return
+			}
+			if !strings.Contains(logs.String(), "level="+tt.wantLevel) {
+				t.Errorf("logged %q, want level %s", logs.String(), tt.wantLevel)
+			}
+			if errors.Is(tt.err, cause) && !strings.Contains(logs.String(), cause.Error()) {
+				t.Errorf("logged %q without the cause", logs.String())
+			}
+		})
+	}
+}
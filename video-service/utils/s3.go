@@ -2,12 +2,18 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"encoding/json"
+	"log/slog"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"video-service/metrics"
+	"video-service/tracing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -16,8 +22,8 @@ import (
 )
 
 // UploadFileToS3 uploads a file to an AWS S3 bucket
-func UploadFileToS3(uploader *manager.Uploader, bucket, fileName, contentType string, file io.Reader, acl types.ObjectCannedACL) (string, error) {
-	result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
+func UploadFileToS3(ctx context.Context, uploader *manager.Uploader, bucket, fileName, contentType string, file io.Reader, acl types.ObjectCannedACL) (string, error) {
+	result, err := uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(bucket),
 		Key:         aws.String(fileName),
 		Body:        file,
@@ -40,6 +46,24 @@ func IsVideoContentType(contentType string) bool {
 	return false
 }
 
+// VideoContentTypeByExtension returns the video content type implied by a
+// file name's extension, or "" if it is not a supported video format
+func VideoContentTypeByExtension(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".mp4", ".m4v":
+		return "video/mp4"
+	case ".avi":
+		return "video/avi"
+	case ".mpg", ".mpeg":
+		return "video/mpeg"
+	case ".mov":
+		return "video/quicktime"
+	case ".mkv":
+		return "video/x-matroska"
+	}
+	return ""
+}
+
 // IsImageContentType checks if the content type represents an Image
 func IsImageContentType(contentType string) bool {
 	imageContentTypes := []string{"image/jpeg", "image/png", "image/webp"}
@@ -52,11 +76,29 @@ func IsImageContentType(contentType string) bool {
 }
 
 // CalculateVideoDuration ca`lculates the duration of a video file in seconds
-func CalculateVideoDuration(filePath string) (int, error) {
+func CalculateVideoDuration(ctx context.Context, ffprobePath, filePath string) (int, error) {
+	ctx, span := tracing.Start(ctx, "ffprobe")
+	duration, err := probeDuration(ctx, ffprobePath, filePath)
+	tracing.End(span, err)
+	return duration, err
+}
+
+// probeDuration runs ffprobe and parses the duration it reports
+func probeDuration(ctx context.Context, ffprobePath, filePath string) (int, error) {
 	// Run ffprobe to get video metadata
-	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "json", filePath)
+	cmd := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-show_entries", "format=duration", "-of", "json", filePath)
+	start := time.Now()
 	output, err := cmd.Output()
+	metrics.ObserveMediaTool("ffprobe", start, err)
 	if err != nil {
+		// Output keeps stderr on the error, which is the only clue to why it failed
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			slog.ErrorContext(ctx, "ffprobe failed",
+				slog.String("file", filePath),
+				slog.Int("exit_code", exitErr.ExitCode()),
+				slog.String("stderr", strings.TrimSpace(string(exitErr.Stderr))))
+		}
 		return 0, fmt.Errorf("failed to run ffprobe: %w", err)
 	}
 